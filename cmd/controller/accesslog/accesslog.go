@@ -0,0 +1,155 @@
+// Package accesslog writes a line per request served by the proxy, in JSON,
+// logfmt or the NGINX combined format, to stdout, stderr or a file rotated
+// by size.
+package accesslog
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Entry is the access log entry of a request.
+type Entry struct {
+	Time          time.Time
+	RequestID     string
+	ClientIP      string
+	RemoteUser    string
+	Method        string
+	URI           string
+	Protocol      string
+	Host          string
+	Status        int
+	BytesSent     int64
+	BytesReceived int64
+	Duration      time.Duration
+	Referer       string
+	UserAgent     string
+
+	// Namespace and Ingress name the Ingress of the matched route, RouteHost
+	// and RoutePath its rule. They are empty when no route matched.
+	Namespace string
+	Ingress   string
+	RouteHost string
+	RoutePath string
+
+	// Upstreams are the attempts sent to the upstream, in order.
+	Upstreams []Upstream
+}
+
+// Upstream is an attempt of a request to reach an upstream endpoint.
+type Upstream struct {
+	Addr string
+	// Status is that of the response, 0 when the attempt failed without one.
+	Status int
+	// Duration is the time until the response headers or the failure.
+	Duration time.Duration
+}
+
+type entryKey struct{}
+
+// NewContext returns a copy of ctx carrying e, for the upstream attempts of
+// the request to be recorded to.
+func NewContext(ctx context.Context, e *Entry) context.Context {
+	return context.WithValue(ctx, entryKey{}, e)
+}
+
+// ObserveUpstream records an attempt to the entry of ctx, if any.
+func ObserveUpstream(ctx context.Context, addr string, status int, duration time.Duration) {
+	if e, ok := ctx.Value(entryKey{}).(*Entry); ok {
+		e.Upstreams = append(e.Upstreams, Upstream{Addr: addr, Status: status, Duration: duration})
+	}
+}
+
+// Logger writes the entries of a sample of the requests. Server errors are
+// always written.
+type Logger struct {
+	mu            sync.Mutex
+	w             io.Writer
+	format        Format
+	samplePercent int
+	buf           []byte
+}
+
+// New returns a Logger writing samplePercent percent of the entries to w.
+func New(w io.Writer, format Format, samplePercent int) *Logger {
+	return &Logger{w: w, format: format, samplePercent: samplePercent}
+}
+
+// Sampled reports whether the entry of a request with status is written.
+func (l *Logger) Sampled(status int) bool {
+	if status >= http.StatusInternalServerError || l.samplePercent >= 100 {
+		return true
+	}
+	return l.samplePercent > 0 && rand.IntN(100) < l.samplePercent
+}
+
+// Log writes e if it is sampled.
+func (l *Logger) Log(e *Entry) {
+	if !l.Sampled(e.Status) {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.buf = l.format.append(l.buf[:0], e)
+	l.buf = append(l.buf, '\n')
+	_, _ = l.w.Write(l.buf)
+}
+
+// Close closes the file the entries are written to. Standard output and
+// error are left open.
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if f, ok := l.w.(*lumberjack.Logger); ok {
+		return f.Close()
+	}
+	return nil
+}
+
+// Rotation sets when an access log file is rotated and how long the rotated
+// files are kept.
+type Rotation struct {
+	// MaxSize is the size in megabytes at which the file is rotated.
+	MaxSize int
+	// MaxBackups is the number of rotated files kept, 0 for all of them.
+	MaxBackups int
+	// MaxAge is the number of days rotated files are kept, 0 for no limit.
+	MaxAge int
+}
+
+// Open returns the writer of output: stdout, stderr or the path of a file
+// rotated as set by rotation.
+func Open(output string, rotation Rotation) (io.Writer, error) {
+	switch output {
+	case "stdout":
+		return os.Stdout, nil
+	case "stderr":
+		return os.Stderr, nil
+	}
+
+	// The file is opened once here so that a wrong path fails on startup
+	// rather than on the first request.
+	f, err := os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening access log: %v", err)
+	}
+	f.Close()
+
+	return &lumberjack.Logger{
+		Filename:   output,
+		MaxSize:    rotation.MaxSize,
+		MaxBackups: rotation.MaxBackups,
+		MaxAge:     rotation.MaxAge,
+	}, nil
+}
@@ -0,0 +1,210 @@
+package accesslog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testEntry() *Entry {
+	return &Entry{
+		Time:          time.Date(2026, time.October, 16, 9, 30, 15, 0, time.UTC),
+		RequestID:     "7f3c9a",
+		ClientIP:      "10.0.0.7",
+		Method:        "GET",
+		URI:           "/api/items?page=2",
+		Protocol:      "HTTP/1.1",
+		Host:          "app.example.com",
+		Status:        200,
+		BytesSent:     512,
+		BytesReceived: 0,
+		Duration:      42 * time.Millisecond,
+		Referer:       "https://example.com/",
+		UserAgent:     `curl/8.5 "quoted"`,
+		Namespace:     "default",
+		Ingress:       "app",
+		RouteHost:     "app.example.com",
+		RoutePath:     "/api",
+		Upstreams: []Upstream{
+			{Addr: "10.1.0.4:8080", Status: 0, Duration: 10 * time.Millisecond},
+			{Addr: "10.1.0.5:8080", Status: 200, Duration: 25 * time.Millisecond},
+		},
+	}
+}
+
+func TestFormats(t *testing.T) {
+	t.Run("json", func(t *testing.T) {
+		var fields map[string]any
+		line := FormatJSON.append(nil, testEntry())
+		if err := json.Unmarshal(line, &fields); err != nil {
+			t.Fatalf("Expected valid JSON, got %s: %v", line, err)
+		}
+		expected := map[string]any{
+			"time":              "2026-10-16T09:30:15.000Z",
+			"request_id":        "7f3c9a",
+			"client_ip":         "10.0.0.7",
+			"uri":               "/api/items?page=2",
+			"status":            float64(200),
+			"bytes_sent":        float64(512),
+			"duration":          0.042,
+			"upstream_addr":     "10.1.0.4:8080, 10.1.0.5:8080",
+			"upstream_status":   "-, 200",
+			"upstream_duration": 0.035,
+			"ingress":           "app",
+			"route":             "app.example.com/api",
+			"user_agent":        `curl/8.5 "quoted"`,
+		}
+		for key, value := range expected {
+			if fields[key] != value {
+				t.Errorf("Expected %s to be %v, got %v", key, value, fields[key])
+			}
+		}
+	})
+
+	t.Run("json without upstream", func(t *testing.T) {
+		e := testEntry()
+		e.Upstreams = nil
+		if line := string(FormatJSON.append(nil, e)); !strings.Contains(line, `"upstream_duration":null`) {
+			t.Errorf("Expected a null upstream duration, got %s", line)
+		}
+	})
+
+	t.Run("logfmt", func(t *testing.T) {
+		line := string(FormatLogfmt.append(nil, testEntry()))
+		for _, expected := range []string{
+			"time=2026-10-16T09:30:15.000Z request_id=7f3c9a client_ip=10.0.0.7 method=GET",
+			`uri="/api/items?page=2"`,
+			"status=200 bytes_sent=512 bytes_received=0 duration=0.042",
+			`upstream_addr="10.1.0.4:8080, 10.1.0.5:8080" upstream_status="-, 200" upstream_duration=0.035`,
+			`user_agent="curl/8.5 \"quoted\""`,
+		} {
+			if !strings.Contains(line, expected) {
+				t.Errorf("Expected %q in %s", expected, line)
+			}
+		}
+	})
+
+	t.Run("combined", func(t *testing.T) {
+		line := string(FormatCombined.append(nil, testEntry()))
+		expected := `10.0.0.7 - - [16/Oct/2026:09:30:15 +0000] "GET /api/items?page=2 HTTP/1.1" 200 512 "https://example.com/" "curl/8.5 \x22quoted\x22" ` +
+			`0 0.042 [default/app] [app.example.com/api] 10.1.0.4:8080, 10.1.0.5:8080 0.035 -, 200 7f3c9a`
+		if line != expected {
+			t.Errorf("Expected\n%s\ngot\n%s", expected, line)
+		}
+	})
+
+	t.Run("combined without route", func(t *testing.T) {
+		e := &Entry{Time: testEntry().Time, ClientIP: "10.0.0.7", Method: "GET", URI: "/", Protocol: "HTTP/1.1", Status: 404, RequestID: "abc"}
+		line := string(FormatCombined.append(nil, e))
+		if !strings.HasSuffix(line, `"-" "-" 0 0.000 [] [] - - - abc`) {
+			t.Errorf("Expected dashes for the missing fields, got %s", line)
+		}
+	})
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, name := range []string{"json", "logfmt", "combined"} {
+		format, err := ParseFormat(name)
+		if err != nil || format.String() != name {
+			t.Errorf("Expected format %s, got %s (%v)", name, format, err)
+		}
+	}
+	if _, err := ParseFormat("apache"); err == nil {
+		t.Errorf("Expected an error for an unknown format")
+	}
+}
+
+func TestSampling(t *testing.T) {
+	tests := []struct {
+		name     string
+		percent  int
+		status   int
+		expected int
+	}{
+		{name: "all", percent: 100, status: 200, expected: 100},
+		{name: "none", percent: 0, status: 200, expected: 0},
+		{name: "server errors always", percent: 0, status: 502, expected: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			l := New(&buf, FormatJSON, tt.percent)
+			e := testEntry()
+			e.Status = tt.status
+			for range 100 {
+				l.Log(e)
+			}
+			if lines := strings.Count(buf.String(), "\n"); lines != tt.expected {
+				t.Errorf("Expected %d lines, got %d", tt.expected, lines)
+			}
+		})
+	}
+
+	t.Run("some", func(t *testing.T) {
+		l := New(&bytes.Buffer{}, FormatJSON, 50)
+		sampled := 0
+		for range 1000 {
+			if l.Sampled(200) {
+				sampled++
+			}
+		}
+		if sampled < 350 || sampled > 650 {
+			t.Errorf("Expected about half of the requests to be sampled, got %d of 1000", sampled)
+		}
+	})
+}
+
+func TestObserveUpstream(t *testing.T) {
+	e := &Entry{}
+	ctx := NewContext(context.Background(), e)
+	ObserveUpstream(ctx, "10.1.0.4:8080", 503, time.Millisecond)
+	ObserveUpstream(ctx, "10.1.0.5:8080", 200, time.Millisecond)
+	if len(e.Upstreams) != 2 || e.Upstreams[1].Addr != "10.1.0.5:8080" {
+		t.Errorf("Expected both attempts to be recorded, got %+v", e.Upstreams)
+	}
+
+	// Requests without an entry are not logged.
+	ObserveUpstream(context.Background(), "10.1.0.4:8080", 200, time.Millisecond)
+}
+
+func TestOpen(t *testing.T) {
+	t.Run("file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "access.log")
+		w, err := Open(path, Rotation{MaxSize: 1})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		l := New(w, FormatLogfmt, 100)
+		l.Log(testEntry())
+		if err := l.Close(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !strings.HasPrefix(string(data), "time=") || !strings.HasSuffix(string(data), "\n") {
+			t.Errorf("Expected a logfmt line in the file, got %q", data)
+		}
+	})
+
+	t.Run("missing directory", func(t *testing.T) {
+		if _, err := Open(filepath.Join(t.TempDir(), "missing", "access.log"), Rotation{}); err == nil {
+			t.Errorf("Expected an error opening a file in a missing directory")
+		}
+	})
+
+	t.Run("stdout", func(t *testing.T) {
+		w, err := Open("stdout", Rotation{})
+		if err != nil || w != os.Stdout {
+			t.Errorf("Expected stdout, got %v (%v)", w, err)
+		}
+	})
+}
@@ -0,0 +1,255 @@
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Format is the format of the access log lines.
+type Format int
+
+const (
+	// FormatJSON writes an object per line.
+	FormatJSON Format = iota
+	// FormatLogfmt writes key=value pairs.
+	FormatLogfmt
+	// FormatCombined writes the NGINX combined format followed by the
+	// request size and duration, the Ingress and route matched, the upstream
+	// attempts and the request ID, so that combined parsers read the lines
+	// and ignore the rest.
+	FormatCombined
+)
+
+// ParseFormat returns the format named json, logfmt or combined.
+func ParseFormat(name string) (Format, error) {
+	switch name {
+	case "json":
+		return FormatJSON, nil
+	case "logfmt":
+		return FormatLogfmt, nil
+	case "combined":
+		return FormatCombined, nil
+	default:
+		return 0, fmt.Errorf("unknown access log format %q, expected json, logfmt or combined", name)
+	}
+}
+
+func (f Format) String() string {
+	switch f {
+	case FormatJSON:
+		return "json"
+	case FormatLogfmt:
+		return "logfmt"
+	case FormatCombined:
+		return "combined"
+	default:
+		return "unknown"
+	}
+}
+
+func (f Format) append(b []byte, e *Entry) []byte {
+	switch f {
+	case FormatLogfmt:
+		return appendLogfmt(b, e)
+	case FormatCombined:
+		return appendCombined(b, e)
+	default:
+		return appendJSON(b, e)
+	}
+}
+
+// field is a field of the JSON and logfmt formats. Numbers are written as
+// they are, and an empty number is null in JSON.
+type field struct {
+	key    string
+	value  string
+	number bool
+}
+
+func (e *Entry) fields() []field {
+	return []field{
+		{key: "time", value: e.Time.Format("2006-01-02T15:04:05.000Z07:00")},
+		{key: "request_id", value: e.RequestID},
+		{key: "client_ip", value: e.ClientIP},
+		{key: "method", value: e.Method},
+		{key: "uri", value: e.URI},
+		{key: "protocol", value: e.Protocol},
+		{key: "host", value: e.Host},
+		{key: "status", value: strconv.Itoa(e.Status), number: true},
+		{key: "bytes_sent", value: strconv.FormatInt(e.BytesSent, 10), number: true},
+		{key: "bytes_received", value: strconv.FormatInt(e.BytesReceived, 10), number: true},
+		{key: "duration", value: seconds(e.Duration), number: true},
+		{key: "upstream_addr", value: e.upstreamAddrs()},
+		{key: "upstream_status", value: e.upstreamStatuses()},
+		{key: "upstream_duration", value: e.upstreamDuration(), number: true},
+		{key: "namespace", value: e.Namespace},
+		{key: "ingress", value: e.Ingress},
+		{key: "route", value: e.route()},
+		{key: "referer", value: e.Referer},
+		{key: "user_agent", value: e.UserAgent},
+	}
+}
+
+func seconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// route returns the host and path of the matched rule, such as
+// app.example.com/api.
+func (e *Entry) route() string {
+	return e.RouteHost + e.RoutePath
+}
+
+// upstreamAddrs returns the addresses of the attempts, separated by commas
+// as NGINX does.
+func (e *Entry) upstreamAddrs() string {
+	addrs := make([]string, len(e.Upstreams))
+	for i, u := range e.Upstreams {
+		addrs[i] = u.Addr
+	}
+	return strings.Join(addrs, ", ")
+}
+
+// upstreamStatuses returns the statuses of the attempts, - for the attempts
+// that failed without a response.
+func (e *Entry) upstreamStatuses() string {
+	statuses := make([]string, len(e.Upstreams))
+	for i, u := range e.Upstreams {
+		statuses[i] = "-"
+		if u.Status != 0 {
+			statuses[i] = strconv.Itoa(u.Status)
+		}
+	}
+	return strings.Join(statuses, ", ")
+}
+
+// upstreamDuration returns the time spent on the attempts, empty when the
+// request did not reach the upstream.
+func (e *Entry) upstreamDuration() string {
+	if len(e.Upstreams) == 0 {
+		return ""
+	}
+	var d time.Duration
+	for _, u := range e.Upstreams {
+		d += u.Duration
+	}
+	return seconds(d)
+}
+
+func appendJSON(b []byte, e *Entry) []byte {
+	b = append(b, '{')
+	for i, f := range e.fields() {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = strconv.AppendQuote(b, f.key)
+		b = append(b, ':')
+		switch {
+		case f.number && f.value == "":
+			b = append(b, "null"...)
+		case f.number:
+			b = append(b, f.value...)
+		default:
+			value, _ := json.Marshal(f.value)
+			b = append(b, value...)
+		}
+	}
+	return append(b, '}')
+}
+
+func appendLogfmt(b []byte, e *Entry) []byte {
+	for i, f := range e.fields() {
+		if i > 0 {
+			b = append(b, ' ')
+		}
+		b = append(b, f.key...)
+		b = append(b, '=')
+		if needsQuoting(f.value) {
+			b = strconv.AppendQuote(b, f.value)
+		} else {
+			b = append(b, f.value...)
+		}
+	}
+	return b
+}
+
+// needsQuoting reports whether a logfmt value must be quoted: when it is
+// empty or holds spaces, quotes, equal signs or unprintable characters.
+func needsQuoting(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == '\\' || r == utf8.RuneError || r == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+func appendCombined(b []byte, e *Entry) []byte {
+	b = appendOrDash(b, e.ClientIP)
+	b = append(b, " - "...)
+	b = appendOrDash(b, e.RemoteUser)
+	b = append(b, " ["...)
+	b = e.Time.AppendFormat(b, "02/Jan/2006:15:04:05 -0700")
+	b = append(b, "] \""...)
+	b = appendEscaped(b, e.Method+" "+e.URI+" "+e.Protocol)
+	b = append(b, "\" "...)
+	b = strconv.AppendInt(b, int64(e.Status), 10)
+	b = append(b, ' ')
+	b = strconv.AppendInt(b, e.BytesSent, 10)
+	b = append(b, " \""...)
+	b = appendEscaped(b, orDash(e.Referer))
+	b = append(b, "\" \""...)
+	b = appendEscaped(b, orDash(e.UserAgent))
+	b = append(b, "\" "...)
+
+	b = strconv.AppendInt(b, e.BytesReceived, 10)
+	b = append(b, ' ')
+	b = append(b, seconds(e.Duration)...)
+	b = append(b, " ["...)
+	if e.Ingress != "" {
+		b = appendEscaped(b, e.Namespace+"/"+e.Ingress)
+	}
+	b = append(b, "] ["...)
+	b = appendEscaped(b, e.route())
+	b = append(b, "] "...)
+	b = appendOrDash(b, e.upstreamAddrs())
+	b = append(b, ' ')
+	b = appendOrDash(b, e.upstreamDuration())
+	b = append(b, ' ')
+	b = appendOrDash(b, e.upstreamStatuses())
+	b = append(b, ' ')
+	return appendOrDash(b, e.RequestID)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func appendOrDash(b []byte, s string) []byte {
+	return appendEscaped(b, orDash(s))
+}
+
+// appendEscaped appends s with quotes, backslashes and unprintable bytes
+// escaped as \xHH, as NGINX does, so that a field cannot break the line.
+func appendEscaped(b []byte, s string) []byte {
+	const hex = "0123456789ABCDEF"
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < ' ' || c == '"' || c == '\\' || c >= 0x7f {
+			b = append(b, '\\', 'x', hex[c>>4], hex[c&0xf])
+			continue
+		}
+		b = append(b, c)
+	}
+	return b
+}
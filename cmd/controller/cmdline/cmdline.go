@@ -1,9 +1,12 @@
 package cmdline
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 
 	. "github.com/danCrespo/panacea-ingress-controller/config"
 	"github.com/danCrespo/panacea-ingress-controller/controller"
@@ -29,13 +32,81 @@ var _ CmdLine = (*cmdline)(nil)
 func New() CmdLine {
 	return &cmdline{
 		flags: ControllerFlags{
-			IngressClass: "",
-			Listen:       "",
-			Kubeconfig:   "",
-			ResyncPeriod: "",
-			Namespace:    "",
-			Help:         false,
-			Verbosity:    0,
+			IngressClass:     "",
+			Listen:           "",
+			ListenTLS:        "",
+			DefaultTLSSecret: "",
+			ServiceUpstream:  false,
+			LoadBalance:      "",
+			SessionCookieKey: "",
+			Kubeconfig:       "",
+			ResyncPeriod:     "",
+			Namespace:        "",
+			Help:             false,
+			Verbosity:        0,
+
+			HealthCheckPath:               "",
+			HealthCheckInterval:           0,
+			HealthCheckTimeout:            0,
+			HealthCheckHealthyThreshold:   0,
+			HealthCheckUnhealthyThreshold: 0,
+
+			OutlierConsecutiveErrors:  0,
+			OutlierBaseEjectionTime:   0,
+			OutlierMaxEjectionTime:    0,
+			OutlierMaxEjectionPercent: 0,
+			MaxConcurrentRequests:     0,
+			MaxPendingRequests:        0,
+
+			RetryAttempts:         0,
+			RetryOn:               "",
+			RetryPerTryTimeout:    0,
+			RetryNonIdempotent:    false,
+			RetryBudgetPercent:    0,
+			RetryBudgetMinRetries: 0,
+
+			ServerReadHeaderTimeout:       0,
+			ServerReadTimeout:             0,
+			ServerWriteTimeout:            0,
+			ServerIdleTimeout:             0,
+			UpstreamConnectTimeout:        0,
+			UpstreamResponseHeaderTimeout: 0,
+			UpstreamRequestTimeout:        0,
+
+			DefaultBackendService: "",
+
+			NamespaceSelector: "",
+
+			ControllerName: "",
+
+			PublishService:       "",
+			PublishStatusAddress: "",
+
+			LeaderElect:                 false,
+			LeaderElectionNamespace:     "",
+			LeaderElectionID:            "",
+			LeaderElectionLeaseDuration: 0,
+			LeaderElectionRenewDeadline: 0,
+			LeaderElectionRetryPeriod:   0,
+
+			AdminListen: "",
+
+			ShutdownDelay:   0,
+			ShutdownTimeout: 0,
+
+			AccessLog:              "",
+			AccessLogFormat:        "",
+			AccessLogSamplePercent: 0,
+			AccessLogMaxSize:       0,
+			AccessLogMaxBackups:    0,
+			AccessLogMaxAge:        0,
+
+			TracingExporter:      "",
+			TracingEndpoint:      "",
+			TracingInsecure:      false,
+			TracingSamplePercent: 0,
+			TracingPropagators:   "",
+			TracingServiceName:   "",
 		},
 		config: Config{},
 	}
@@ -43,8 +114,7 @@ func New() CmdLine {
 
 func (c *cmdline) Execute() error {
 	rootCmd := c.newPanaceaIngressCommand()
-	rootCmd.Execute()
-	return nil
+	return rootCmd.Execute()
 }
 
 func (c *cmdline) newPanaceaIngressCommand() *cobra.Command {
@@ -53,6 +123,8 @@ func (c *cmdline) newPanaceaIngressCommand() *cobra.Command {
 		Args:              cobra.ExactArgs(1),
 		DisableAutoGenTag: true,
 		Short:             "Panacea Ingress Controller startup command",
+		// Errors are printed by main.
+		SilenceErrors: true,
 		Run: func(cmd *cobra.Command, args []string) {
 			fmt.Println(cmd.UsageString())
 		},
@@ -82,12 +154,80 @@ func (c *cmdline) initConfiguration() {
 	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 	c.flags.BindViper()
 	c.config = Config{
-		IngressClass: c.flags.IngressClass,
-		Listen:       c.flags.Listen,
-		Kubeconfig:   c.flags.Kubeconfig,
-		ResyncPeriod: c.flags.ResyncPeriod,
-		Namespace:    c.flags.Namespace,
-		Verbosity:    c.flags.Verbosity,
+		IngressClass:     c.flags.IngressClass,
+		Listen:           c.flags.Listen,
+		ListenTLS:        c.flags.ListenTLS,
+		DefaultTLSSecret: c.flags.DefaultTLSSecret,
+		ServiceUpstream:  c.flags.ServiceUpstream,
+		LoadBalance:      c.flags.LoadBalance,
+		SessionCookieKey: c.flags.SessionCookieKey,
+		Kubeconfig:       c.flags.Kubeconfig,
+		ResyncPeriod:     c.flags.ResyncPeriod,
+		Namespace:        c.flags.Namespace,
+		Verbosity:        c.flags.Verbosity,
+
+		HealthCheckPath:               c.flags.HealthCheckPath,
+		HealthCheckInterval:           c.flags.HealthCheckInterval,
+		HealthCheckTimeout:            c.flags.HealthCheckTimeout,
+		HealthCheckHealthyThreshold:   c.flags.HealthCheckHealthyThreshold,
+		HealthCheckUnhealthyThreshold: c.flags.HealthCheckUnhealthyThreshold,
+
+		OutlierConsecutiveErrors:  c.flags.OutlierConsecutiveErrors,
+		OutlierBaseEjectionTime:   c.flags.OutlierBaseEjectionTime,
+		OutlierMaxEjectionTime:    c.flags.OutlierMaxEjectionTime,
+		OutlierMaxEjectionPercent: c.flags.OutlierMaxEjectionPercent,
+		MaxConcurrentRequests:     c.flags.MaxConcurrentRequests,
+		MaxPendingRequests:        c.flags.MaxPendingRequests,
+
+		RetryAttempts:         c.flags.RetryAttempts,
+		RetryOn:               c.flags.RetryOn,
+		RetryPerTryTimeout:    c.flags.RetryPerTryTimeout,
+		RetryNonIdempotent:    c.flags.RetryNonIdempotent,
+		RetryBudgetPercent:    c.flags.RetryBudgetPercent,
+		RetryBudgetMinRetries: c.flags.RetryBudgetMinRetries,
+
+		ServerReadHeaderTimeout:       c.flags.ServerReadHeaderTimeout,
+		ServerReadTimeout:             c.flags.ServerReadTimeout,
+		ServerWriteTimeout:            c.flags.ServerWriteTimeout,
+		ServerIdleTimeout:             c.flags.ServerIdleTimeout,
+		UpstreamConnectTimeout:        c.flags.UpstreamConnectTimeout,
+		UpstreamResponseHeaderTimeout: c.flags.UpstreamResponseHeaderTimeout,
+		UpstreamRequestTimeout:        c.flags.UpstreamRequestTimeout,
+
+		DefaultBackendService: c.flags.DefaultBackendService,
+
+		NamespaceSelector: c.flags.NamespaceSelector,
+
+		ControllerName: c.flags.ControllerName,
+
+		PublishService:       c.flags.PublishService,
+		PublishStatusAddress: c.flags.PublishStatusAddress,
+
+		LeaderElect:                 c.flags.LeaderElect,
+		LeaderElectionNamespace:     c.flags.LeaderElectionNamespace,
+		LeaderElectionID:            c.flags.LeaderElectionID,
+		LeaderElectionLeaseDuration: c.flags.LeaderElectionLeaseDuration,
+		LeaderElectionRenewDeadline: c.flags.LeaderElectionRenewDeadline,
+		LeaderElectionRetryPeriod:   c.flags.LeaderElectionRetryPeriod,
+
+		AdminListen: c.flags.AdminListen,
+
+		ShutdownDelay:   c.flags.ShutdownDelay,
+		ShutdownTimeout: c.flags.ShutdownTimeout,
+
+		AccessLog:              c.flags.AccessLog,
+		AccessLogFormat:        c.flags.AccessLogFormat,
+		AccessLogSamplePercent: c.flags.AccessLogSamplePercent,
+		AccessLogMaxSize:       c.flags.AccessLogMaxSize,
+		AccessLogMaxBackups:    c.flags.AccessLogMaxBackups,
+		AccessLogMaxAge:        c.flags.AccessLogMaxAge,
+
+		TracingExporter:      c.flags.TracingExporter,
+		TracingEndpoint:      c.flags.TracingEndpoint,
+		TracingInsecure:      c.flags.TracingInsecure,
+		TracingSamplePercent: c.flags.TracingSamplePercent,
+		TracingPropagators:   c.flags.TracingPropagators,
+		TracingServiceName:   c.flags.TracingServiceName,
 	}
 }
 
@@ -108,12 +248,20 @@ func (c *cmdline) newRunCommand() *cobra.Command {
 		},
 		DisableFlagsInUseLine: false,
 		Args:                  cobra.NoArgs,
-		Run: func(cmd *cobra.Command, args []string) {
+		SilenceUsage:          true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, stop := signal.NotifyContext(cmd.Context(), syscall.SIGTERM, os.Interrupt)
+			defer stop()
+			// A second signal stops the controller without waiting for the
+			// graceful shutdown.
+			context.AfterFunc(ctx, stop)
+
 			ctrl := controller.NewController(&c.config)
-			if err := ctrl.Run(); err != nil {
+			if err := ctrl.Run(ctx); err != nil {
 				ctrl.Log(fmt.Sprintf("failed to run Panacea Ingress Controller: %v", err))
-				os.Exit(1)
+				return err
 			}
+			return nil
 		},
 	}
 
@@ -135,7 +283,6 @@ func (c *cmdline) newVersionCommand() *cobra.Command {
 			fmt.Printf("\tVersion: %s\n", Version)
 			fmt.Printf("\tGit Commit: %s\n", GitCommit)
 			fmt.Printf("\tBuild Date: %s\n", BuildDate)
-			os.Exit(0)
 		},
 	}
 	return cmd
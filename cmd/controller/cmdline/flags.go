@@ -4,19 +4,88 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 type ControllerFlags struct {
-	IngressClass string `flag:"ingress-class,c" help:"IngressClass name to reconcile" default:"panacea-ingress-class"`
-	Listen       string `flag:"listen,l" help:"Address to listen on for HTTP requests" default:"0.0.0.0:80"`
-	Kubeconfig   string `flag:"kubeconfig,k" help:"Path to a kubeconfig. Only required if out-of-cluster" default:""`
-	ResyncPeriod string `flag:"resync-period,r" help:"Resync period in seconds" default:"30"`
-	Namespace    string `flag:"namespace,n" help:"Namespace to watch for Ingress resources. Leave empty to watch all namespaces." default:""`
-	Help         bool   `flag:"help,h" help:"Help for panacea-ingress-controller" default:"false"`
-	Verbosity    int    `flag:"verbosity,v" help:"Logging verbosity level" default:"0"`
+	IngressClass     string `flag:"ingress-class,c" help:"Class name of the Ingresses using the legacy kubernetes.io/ingress.class annotation to reconcile" default:"panacea-ingress-class"`
+	Listen           string `flag:"listen,l" help:"Address to listen on for HTTP requests" default:"0.0.0.0:80"`
+	ListenTLS        string `flag:"listen-tls" help:"Address to listen on for HTTPS requests. Leave empty to disable TLS termination." default:"0.0.0.0:443"`
+	DefaultTLSSecret string `flag:"default-tls-secret" help:"Secret (namespace/name) holding the certificate served when no Ingress certificate matches" default:""`
+	ServiceUpstream  bool   `flag:"service-upstream" help:"Proxy to Service DNS names instead of the pod endpoints from EndpointSlices" default:"false"`
+	LoadBalance      string `flag:"load-balance" help:"Default load-balancing algorithm: round-robin, weighted-round-robin, least-conn, ewma or consistent-hash" default:"round-robin"`
+	SessionCookieKey string `flag:"session-cookie-key" help:"Key used to sign session affinity cookies. Must be shared by all replicas; a random key is generated when empty." default:""`
+	Kubeconfig       string `flag:"kubeconfig,k" help:"Path to a kubeconfig. Only required if out-of-cluster" default:""`
+	ResyncPeriod     string `flag:"resync-period,r" help:"Period at which informers replay their cache, such as 30s or 5m. A plain number is seconds and 0 disables resyncs." default:"30s"`
+	Namespace        string `flag:"namespace,n" help:"Comma-separated namespaces to watch for Ingress resources. Leave empty to watch all namespaces." default:""`
+	Help             bool   `flag:"help,h" help:"Help for panacea-ingress-controller" default:"false"`
+	Verbosity        int    `flag:"verbosity,v" help:"Logging verbosity level" default:"0"`
+
+	HealthCheckPath               string        `flag:"health-check-path" help:"Default path probed on every endpoint. Leave empty to disable active health checks." default:""`
+	HealthCheckInterval           time.Duration `flag:"health-check-interval" help:"Default time between two health check probes" default:"10s"`
+	HealthCheckTimeout            time.Duration `flag:"health-check-timeout" help:"Default timeout of a health check probe" default:"2s"`
+	HealthCheckHealthyThreshold   int           `flag:"health-check-healthy-threshold" help:"Default number of consecutive successful probes that bring an endpoint back" default:"2"`
+	HealthCheckUnhealthyThreshold int           `flag:"health-check-unhealthy-threshold" help:"Default number of consecutive failed probes that eject an endpoint" default:"3"`
+
+	OutlierConsecutiveErrors  int           `flag:"outlier-consecutive-errors" help:"Default number of consecutive 5xx responses or connection errors that eject an endpoint. 0 disables outlier detection." default:"0"`
+	OutlierBaseEjectionTime   time.Duration `flag:"outlier-base-ejection-time" help:"Default ejection time of an outlier endpoint, doubled on every new ejection" default:"30s"`
+	OutlierMaxEjectionTime    time.Duration `flag:"outlier-max-ejection-time" help:"Default maximum ejection time of an outlier endpoint" default:"5m"`
+	OutlierMaxEjectionPercent int           `flag:"outlier-max-ejection-percent" help:"Default maximum percentage of the endpoints of a backend that can be ejected at once" default:"10"`
+	MaxConcurrentRequests     int           `flag:"max-concurrent-requests" help:"Default maximum number of requests in flight to a backend. 0 means unlimited." default:"0"`
+	MaxPendingRequests        int           `flag:"max-pending-requests" help:"Default maximum number of requests waiting for a backend at its concurrency limit. Requests over the limit fail with 503." default:"0"`
+
+	RetryAttempts         int           `flag:"retry-attempts" help:"Default maximum number of attempts of a request, the first one included. 1 disables retries." default:"1"`
+	RetryOn               string        `flag:"retry-on" help:"Default comma-separated conditions a request is retried on: connect-failure, reset, 502, 503 and 504" default:"connect-failure,reset,502,503,504"`
+	RetryPerTryTimeout    time.Duration `flag:"retry-per-try-timeout" help:"Default time an attempt may wait for response headers before it is retried. 0 means no per-try timeout." default:"0s"`
+	RetryNonIdempotent    bool          `flag:"retry-non-idempotent" help:"Retry requests with non-idempotent methods such as POST by default" default:"false"`
+	RetryBudgetPercent    int           `flag:"retry-budget-percent" help:"Maximum retries in flight as a percentage of the requests in flight, shared by all backends" default:"20"`
+	RetryBudgetMinRetries int           `flag:"retry-budget-min-retries" help:"Retries in flight always allowed by the retry budget" default:"3"`
+
+	ServerReadHeaderTimeout       time.Duration `flag:"server-read-header-timeout" help:"Time allowed to read the headers of a client request" default:"10s"`
+	ServerReadTimeout             time.Duration `flag:"server-read-timeout" help:"Time allowed to read a whole client request, body included. 0 means no timeout." default:"60s"`
+	ServerWriteTimeout            time.Duration `flag:"server-write-timeout" help:"Time allowed to write a response to a client. 0 means no timeout." default:"0s"`
+	ServerIdleTimeout             time.Duration `flag:"server-idle-timeout" help:"Time a client keep-alive connection is kept open between requests" default:"120s"`
+	UpstreamConnectTimeout        time.Duration `flag:"upstream-connect-timeout" help:"Default time allowed to connect to a backend" default:"5s"`
+	UpstreamResponseHeaderTimeout time.Duration `flag:"upstream-response-header-timeout" help:"Default time a backend has to send response headers. 0 means no timeout." default:"60s"`
+	UpstreamRequestTimeout        time.Duration `flag:"upstream-request-timeout" help:"Default time allowed for a whole request to a backend, retries and response body included. 0 means no timeout." default:"0s"`
+
+	DefaultBackendService string `flag:"default-backend-service" help:"Service serving requests no Ingress matches, as namespace/name:port" default:""`
+
+	NamespaceSelector string `flag:"namespace-selector" help:"Label selector of the namespaces to watch for Ingress resources, such as team=payments. Requires permission to watch namespaces." default:""`
+
+	ControllerName string `flag:"controller-name" help:"IngressClasses whose spec.controller is this name are reconciled" default:"panacea.io/ingress-controller"`
+
+	PublishService       string `flag:"publish-service" help:"Service (namespace/name) whose load balancer addresses are published to the status of our Ingresses" default:""`
+	PublishStatusAddress string `flag:"publish-status-address" help:"Comma-separated IPs or hostnames published to the status of our Ingresses, instead of those of --publish-service" default:""`
+
+	LeaderElect                 bool          `flag:"leader-elect" help:"Elect a leader among the replicas with a Lease, which needs the RBAC to get, create and update leases in coordination.k8s.io. Every replica serves traffic, only the leader writes to the API." default:"false"`
+	LeaderElectionNamespace     string        `flag:"leader-election-namespace" help:"Namespace of the leader election Lease. Defaults to the namespace of the pod." default:""`
+	LeaderElectionID            string        `flag:"leader-election-id" help:"Name of the leader election Lease" default:"panacea-ingress-controller-leader"`
+	LeaderElectionLeaseDuration time.Duration `flag:"leader-election-lease-duration" help:"Time the other replicas wait before taking over from a leader that stopped renewing its Lease" default:"15s"`
+	LeaderElectionRenewDeadline time.Duration `flag:"leader-election-renew-deadline" help:"Time the leader keeps trying to renew its Lease before it stops leading" default:"10s"`
+	LeaderElectionRetryPeriod   time.Duration `flag:"leader-election-retry-period" help:"Time between two attempts to acquire or renew the Lease" default:"2s"`
+
+	AdminListen string `flag:"admin-listen" help:"Address of the admin listener serving the health probes (/livez, /readyz), the Prometheus metrics (/metrics) and the state of the controller. Leave empty to disable it." default:":10254"`
+
+	ShutdownDelay   time.Duration `flag:"shutdown-delay" help:"Time to keep serving with readiness failed after SIGTERM, while the controller is removed from the endpoints of its Service" default:"5s"`
+	ShutdownTimeout time.Duration `flag:"shutdown-timeout" help:"Time to wait for requests in flight on shutdown before their connections are closed" default:"25s"`
+
+	AccessLog              string `flag:"access-log" help:"Destination of the access log: stdout, stderr or the path of a file rotated by size. Leave empty to disable it." default:"stdout"`
+	AccessLogFormat        string `flag:"access-log-format" help:"Format of the access log: json, logfmt or combined (the NGINX combined format followed by the request duration, the Ingress, the upstream and the request ID)" default:"json"`
+	AccessLogSamplePercent int    `flag:"access-log-sample-percent" help:"Percentage of the requests written to the access log. Server errors (5xx) are always written." default:"100"`
+	AccessLogMaxSize       int    `flag:"access-log-max-size" help:"Size in megabytes at which the access log file is rotated" default:"100"`
+	AccessLogMaxBackups    int    `flag:"access-log-max-backups" help:"Rotated access log files to keep. 0 keeps them all." default:"5"`
+	AccessLogMaxAge        int    `flag:"access-log-max-age" help:"Days to keep rotated access log files. 0 keeps them regardless of their age." default:"0"`
+
+	TracingExporter      string `flag:"tracing-exporter" help:"Exporter of the OpenTelemetry traces of the proxied requests: otlp-grpc or otlp-http. Leave empty to disable tracing." default:""`
+	TracingEndpoint      string `flag:"tracing-endpoint" help:"Address (host:port) or URL of the OpenTelemetry collector. Defaults to localhost:4317 for otlp-grpc and localhost:4318 for otlp-http." default:""`
+	TracingInsecure      bool   `flag:"tracing-insecure" help:"Send the traces to the collector without TLS" default:"false"`
+	TracingSamplePercent int    `flag:"tracing-sample-percent" help:"Percentage of the traces started by the controller that are sampled. Requests carrying a trace context follow the sampling decision of their caller." default:"100"`
+	TracingPropagators   string `flag:"tracing-propagators" help:"Comma-separated formats the trace context is read from and written to the upstream requests in: tracecontext (W3C), baggage, b3 (single header) and b3multi" default:"tracecontext,baggage,b3"`
+	TracingServiceName   string `flag:"tracing-service-name" help:"Service name of the spans of the controller" default:"panacea-ingress-controller"`
 }
 
 func bindFlags(cmd *cobra.Command, target any) error {
@@ -55,6 +124,11 @@ func bindFlags(cmd *cobra.Command, target any) error {
 		case reflect.Int:
 			def, _ := strconv.Atoi(defaultVal)
 			cmd.Flags().IntVarP(fieldPtr.(*int), name, shorthand, def, help)
+		case reflect.Int64:
+			if field.Type == reflect.TypeFor[time.Duration]() {
+				def, _ := time.ParseDuration(defaultVal)
+				cmd.Flags().DurationVarP(fieldPtr.(*time.Duration), name, shorthand, def, help)
+			}
 		case reflect.Slice:
 			if field.Type.Elem().Kind() == reflect.String {
 				cmd.Flags().StringSliceVarP(fieldPtr.(*[]string), name, shorthand, nil, help)
@@ -79,6 +153,61 @@ func (cf *ControllerFlags) BindViper() error {
 
 	viper.SetDefault("ingress-class", cf.IngressClass)
 	viper.SetDefault("listen", cf.Listen)
+	viper.SetDefault("listen-tls", cf.ListenTLS)
+	viper.SetDefault("default-tls-secret", cf.DefaultTLSSecret)
+	viper.SetDefault("service-upstream", cf.ServiceUpstream)
+	viper.SetDefault("load-balance", cf.LoadBalance)
+	viper.SetDefault("session-cookie-key", cf.SessionCookieKey)
+	viper.SetDefault("health-check-path", cf.HealthCheckPath)
+	viper.SetDefault("health-check-interval", cf.HealthCheckInterval)
+	viper.SetDefault("health-check-timeout", cf.HealthCheckTimeout)
+	viper.SetDefault("health-check-healthy-threshold", cf.HealthCheckHealthyThreshold)
+	viper.SetDefault("health-check-unhealthy-threshold", cf.HealthCheckUnhealthyThreshold)
+	viper.SetDefault("outlier-consecutive-errors", cf.OutlierConsecutiveErrors)
+	viper.SetDefault("outlier-base-ejection-time", cf.OutlierBaseEjectionTime)
+	viper.SetDefault("outlier-max-ejection-time", cf.OutlierMaxEjectionTime)
+	viper.SetDefault("outlier-max-ejection-percent", cf.OutlierMaxEjectionPercent)
+	viper.SetDefault("max-concurrent-requests", cf.MaxConcurrentRequests)
+	viper.SetDefault("max-pending-requests", cf.MaxPendingRequests)
+	viper.SetDefault("retry-attempts", cf.RetryAttempts)
+	viper.SetDefault("retry-on", cf.RetryOn)
+	viper.SetDefault("retry-per-try-timeout", cf.RetryPerTryTimeout)
+	viper.SetDefault("retry-non-idempotent", cf.RetryNonIdempotent)
+	viper.SetDefault("retry-budget-percent", cf.RetryBudgetPercent)
+	viper.SetDefault("retry-budget-min-retries", cf.RetryBudgetMinRetries)
+	viper.SetDefault("server-read-header-timeout", cf.ServerReadHeaderTimeout)
+	viper.SetDefault("server-read-timeout", cf.ServerReadTimeout)
+	viper.SetDefault("server-write-timeout", cf.ServerWriteTimeout)
+	viper.SetDefault("server-idle-timeout", cf.ServerIdleTimeout)
+	viper.SetDefault("upstream-connect-timeout", cf.UpstreamConnectTimeout)
+	viper.SetDefault("upstream-response-header-timeout", cf.UpstreamResponseHeaderTimeout)
+	viper.SetDefault("upstream-request-timeout", cf.UpstreamRequestTimeout)
+	viper.SetDefault("default-backend-service", cf.DefaultBackendService)
+	viper.SetDefault("namespace-selector", cf.NamespaceSelector)
+	viper.SetDefault("controller-name", cf.ControllerName)
+	viper.SetDefault("publish-service", cf.PublishService)
+	viper.SetDefault("publish-status-address", cf.PublishStatusAddress)
+	viper.SetDefault("leader-elect", cf.LeaderElect)
+	viper.SetDefault("leader-election-namespace", cf.LeaderElectionNamespace)
+	viper.SetDefault("leader-election-id", cf.LeaderElectionID)
+	viper.SetDefault("leader-election-lease-duration", cf.LeaderElectionLeaseDuration)
+	viper.SetDefault("leader-election-renew-deadline", cf.LeaderElectionRenewDeadline)
+	viper.SetDefault("leader-election-retry-period", cf.LeaderElectionRetryPeriod)
+	viper.SetDefault("admin-listen", cf.AdminListen)
+	viper.SetDefault("shutdown-delay", cf.ShutdownDelay)
+	viper.SetDefault("shutdown-timeout", cf.ShutdownTimeout)
+	viper.SetDefault("access-log", cf.AccessLog)
+	viper.SetDefault("access-log-format", cf.AccessLogFormat)
+	viper.SetDefault("access-log-sample-percent", cf.AccessLogSamplePercent)
+	viper.SetDefault("access-log-max-size", cf.AccessLogMaxSize)
+	viper.SetDefault("access-log-max-backups", cf.AccessLogMaxBackups)
+	viper.SetDefault("access-log-max-age", cf.AccessLogMaxAge)
+	viper.SetDefault("tracing-exporter", cf.TracingExporter)
+	viper.SetDefault("tracing-endpoint", cf.TracingEndpoint)
+	viper.SetDefault("tracing-insecure", cf.TracingInsecure)
+	viper.SetDefault("tracing-sample-percent", cf.TracingSamplePercent)
+	viper.SetDefault("tracing-propagators", cf.TracingPropagators)
+	viper.SetDefault("tracing-service-name", cf.TracingServiceName)
 	viper.SetDefault("kubeconfig", cf.Kubeconfig)
 	viper.SetDefault("resync-period", cf.ResyncPeriod)
 	viper.SetDefault("namespace", cf.Namespace)
@@ -3,15 +3,84 @@ package config
 import (
 	"os"
 	strutil "strconv"
+	"time"
 )
 
 type Config struct {
-	IngressClass string
-	Listen       string
-	Kubeconfig   string
-	ResyncPeriod string
-	Namespace    string
-	Verbosity   int
+	IngressClass     string
+	Listen           string
+	ListenTLS        string
+	DefaultTLSSecret string
+	ServiceUpstream  bool
+	LoadBalance      string
+	SessionCookieKey string
+	Kubeconfig       string
+	ResyncPeriod     string
+	Namespace        string
+	Verbosity        int
+
+	HealthCheckPath               string
+	HealthCheckInterval           time.Duration
+	HealthCheckTimeout            time.Duration
+	HealthCheckHealthyThreshold   int
+	HealthCheckUnhealthyThreshold int
+
+	OutlierConsecutiveErrors  int
+	OutlierBaseEjectionTime   time.Duration
+	OutlierMaxEjectionTime    time.Duration
+	OutlierMaxEjectionPercent int
+	MaxConcurrentRequests     int
+	MaxPendingRequests        int
+
+	RetryAttempts         int
+	RetryOn               string
+	RetryPerTryTimeout    time.Duration
+	RetryNonIdempotent    bool
+	RetryBudgetPercent    int
+	RetryBudgetMinRetries int
+
+	ServerReadHeaderTimeout       time.Duration
+	ServerReadTimeout             time.Duration
+	ServerWriteTimeout            time.Duration
+	ServerIdleTimeout             time.Duration
+	UpstreamConnectTimeout        time.Duration
+	UpstreamResponseHeaderTimeout time.Duration
+	UpstreamRequestTimeout        time.Duration
+
+	DefaultBackendService string
+
+	NamespaceSelector string
+
+	ControllerName string
+
+	PublishService       string
+	PublishStatusAddress string
+
+	LeaderElect                 bool
+	LeaderElectionNamespace     string
+	LeaderElectionID            string
+	LeaderElectionLeaseDuration time.Duration
+	LeaderElectionRenewDeadline time.Duration
+	LeaderElectionRetryPeriod   time.Duration
+
+	AdminListen string
+
+	ShutdownDelay   time.Duration
+	ShutdownTimeout time.Duration
+
+	AccessLog              string
+	AccessLogFormat        string
+	AccessLogSamplePercent int
+	AccessLogMaxSize       int
+	AccessLogMaxBackups    int
+	AccessLogMaxAge        int
+
+	TracingExporter      string
+	TracingEndpoint      string
+	TracingInsecure      bool
+	TracingSamplePercent int
+	TracingPropagators   string
+	TracingServiceName   string
 }
 
 var (
@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/danCrespo/panacea-ingress-controller/metrics"
+)
+
+// health is the state of the controller reported to the probes of the
+// admin listener.
+type health struct {
+	// synced is set once the informer caches synced and the first routing
+	// table is built.
+	synced       atomic.Bool
+	shuttingDown atomic.Bool
+}
+
+// live serves the liveness probe, which passes as long as the controller
+// answers.
+func (h *health) live(w http.ResponseWriter, _ *http.Request) {
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// ready serves the readiness probe, which passes once the controller has
+// routes to serve and fails again once it shuts down, so that it stops
+// receiving new connections.
+func (h *health) ready(w http.ResponseWriter, _ *http.Request) {
+	switch {
+	case h.shuttingDown.Load():
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+	case !h.synced.Load():
+		http.Error(w, "routing table not built yet", http.StatusServiceUnavailable)
+	default:
+		_, _ = w.Write([]byte("ok\n"))
+	}
+}
+
+// newAdminHandler returns the handler of the admin listener, which serves the
+// state of the controller rather than proxied traffic.
+func newAdminHandler(leader *leader, health *health) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /leader", leader)
+	mux.HandleFunc("GET /livez", health.live)
+	// /healthz is the older name of /livez.
+	mux.HandleFunc("GET /healthz", health.live)
+	mux.HandleFunc("GET /readyz", health.ready)
+	mux.Handle("GET /metrics", metrics.Handler())
+	return mux
+}
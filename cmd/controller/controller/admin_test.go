@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminHandlerProbes(t *testing.T) {
+	h := &health{}
+	handler := newAdminHandler(newTestLeader(t, nil, "replica-a", false), h)
+
+	get := func(path string) int {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code
+	}
+
+	tests := []struct {
+		name         string
+		synced       bool
+		shuttingDown bool
+		ready        int
+	}{
+		{name: "syncing", ready: http.StatusServiceUnavailable},
+		{name: "synced", synced: true, ready: http.StatusOK},
+		{name: "shutting down", synced: true, shuttingDown: true, ready: http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h.synced.Store(tt.synced)
+			h.shuttingDown.Store(tt.shuttingDown)
+
+			if code := get("/readyz"); code != tt.ready {
+				t.Errorf("Expected /readyz to return %d, got %d", tt.ready, code)
+			}
+			for _, path := range []string{"/livez", "/healthz"} {
+				if code := get(path); code != http.StatusOK {
+					t.Errorf("Expected %s to return 200, got %d", path, code)
+				}
+			}
+		})
+	}
+
+	if code := get("/unknown"); code != http.StatusNotFound {
+		t.Errorf("Expected unknown paths to return 404, got %d", code)
+	}
+}
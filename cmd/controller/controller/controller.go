@@ -1,23 +1,32 @@
 package controller
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
 	"net/http"
-	"os"
 	"strings"
+	"time"
 
+	"github.com/danCrespo/panacea-ingress-controller/accesslog"
 	"github.com/danCrespo/panacea-ingress-controller/config"
 	"github.com/danCrespo/panacea-ingress-controller/helpers"
 	"github.com/danCrespo/panacea-ingress-controller/logger"
 	"github.com/danCrespo/panacea-ingress-controller/routing"
+	"github.com/danCrespo/panacea-ingress-controller/tracing"
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 )
 
 type Controller interface {
-	Run() error
+	Run(ctx context.Context) error
 	Log(msg ...string)
 }
 
@@ -47,91 +56,390 @@ func (c *controller) Log(msg ...string) {
 	}
 }
 
-func (c *controller) Run() error {
+// Run runs the controller until ctx is done, then shuts it down gracefully.
+func (c *controller) Run(ctx context.Context) error {
 	cfg, err := utils.InClusterOrKubeconfig(*c.Config)
 	if err != nil {
-		c.Log(fmt.Sprintf("failed to get kubeconfig: %s", c.Kubeconfig))
-	} else {
-		c.Log(fmt.Sprintf("Using kubeconfig: %s", c.Kubeconfig))
+		return fmt.Errorf("failed to get kubeconfig: %v", err)
 	}
+	c.Log(fmt.Sprintf("Using kubeconfig: %s", c.Kubeconfig))
 
-  
 	clientset, err := kubernetes.NewForConfig(cfg)
 	if err != nil {
-		c.Log(fmt.Sprintf("failed to create kubernetes clientset: %v", err))
-		os.Exit(1)
+		return fmt.Errorf("failed to create kubernetes clientset: %v", err)
+	}
+
+	resync, err := parseResyncPeriod(c.ResyncPeriod)
+	if err != nil {
+		return fmt.Errorf("invalid resync period: %v", err)
+	}
+
+	namespaces := parseNamespaces(c.Namespace)
+	var namespaceSelector labels.Selector
+	if c.NamespaceSelector != "" {
+		namespaceSelector, err = labels.Parse(c.NamespaceSelector)
+		if err != nil {
+			return fmt.Errorf("invalid namespace selector: %v", err)
+		}
+	}
+	if len(namespaces) > 0 {
+		c.Log(fmt.Sprintf("Watching namespaces %s.", strings.Join(namespaces, ", ")))
+	}
+
+	if c.DefaultBackendService != "" {
+		if _, _, err := routing.ParseServiceBackend(c.DefaultBackendService); err != nil {
+			return fmt.Errorf("invalid default backend service: %v", err)
+		}
 	}
-  
-  utils.SetLogger(c.log)
+
+	var publishNamespace, publishName string
+	if c.PublishService != "" && c.PublishStatusAddress == "" {
+		publishNamespace, publishName, err = parsePublishService(c.PublishService)
+		if err != nil {
+			return fmt.Errorf("invalid publish service: %v", err)
+		}
+	}
+
+	var access *accesslog.Logger
+	if c.AccessLog != "" {
+		format, err := accesslog.ParseFormat(c.AccessLogFormat)
+		if err != nil {
+			return fmt.Errorf("invalid access log format: %v", err)
+		}
+		w, err := accesslog.Open(c.AccessLog, accesslog.Rotation{
+			MaxSize:    c.AccessLogMaxSize,
+			MaxBackups: c.AccessLogMaxBackups,
+			MaxAge:     c.AccessLogMaxAge,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to open access log: %v", err)
+		}
+		access = accesslog.New(w, format, c.AccessLogSamplePercent)
+		defer access.Close()
+
+		c.Log(fmt.Sprintf("Writing the access log to %s in the %s format.", c.AccessLog, format))
+	}
+
+	if c.TracingExporter != "" {
+		stopTracing, err := tracing.Start(ctx, tracing.Config{
+			Exporter:      c.TracingExporter,
+			Endpoint:      c.TracingEndpoint,
+			Insecure:      c.TracingInsecure,
+			SamplePercent: c.TracingSamplePercent,
+			Propagators:   strings.Split(c.TracingPropagators, ","),
+			ServiceName:   c.TracingServiceName,
+		}, c.log)
+		if err != nil {
+			return fmt.Errorf("invalid tracing: %v", err)
+		}
+		// The spans of the requests drained on shutdown are flushed last.
+		defer func() {
+			flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+			defer cancel()
+			if err := stopTracing(flushCtx); err != nil {
+				c.log.Error(err, "error flushing traces")
+			}
+		}()
+
+		c.Log(fmt.Sprintf("Exporting traces with %s.", c.TracingExporter))
+	}
+
+	utils.SetLogger(c.log)
 	router := routing.New(*c.Config)
 	router.SetLogger(c.log)
 
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	defer broadcaster.Shutdown()
+
+	leader, err := newLeader(clientset, leaderConfig{
+		Enabled:       c.LeaderElect,
+		Namespace:     c.LeaderElectionNamespace,
+		Name:          c.LeaderElectionID,
+		LeaseDuration: c.LeaderElectionLeaseDuration,
+		RenewDeadline: c.LeaderElectionRenewDeadline,
+		RetryPeriod:   c.LeaderElectionRetryPeriod,
+	}, c.log)
+	if err != nil {
+		return fmt.Errorf("invalid leader election: %v", err)
+	}
+
+	// Every replica builds the same routes, so only the leader reports their
+	// problems.
+	recorder := broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "panacea-ingress-controller"})
+	router.SetEventRecorder(&leaderRecorder{EventRecorder: recorder, leader: leader})
+
 	c.Log("Routing table created.")
 
-	factory := informers.NewSharedInformerFactory(clientset, 0)
+	factories := newInformerFactories(clientset, namespaces, resync)
 
 	c.Log("Informer factory created.")
-	ingInformer := factory.Networking().V1().Ingresses()
+	ingresses := factories.ingressLister()
 
-	c.Log("Ingress informer created.")
+	// IngressClasses are cluster-scoped and decide which Ingresses are ours.
+	clusterFactory := informers.NewSharedInformerFactory(clientset, resync)
+	classInformer := clusterFactory.Networking().V1().IngressClasses()
+	classes := routing.NewIngressClasses(classInformer.Lister(), c.ControllerName, c.IngressClass)
+	reconciler := newIngressReconciler(ingresses, router, classes, c.log)
 
-	ingInformer.Informer().AddEventHandlerWithOptions(utils.GetOnAnyHandler(func() {
-		utils.Sync.SyncIngresses(clientset, router, c.IngressClass)
-	}), cache.HandlerOptions{
+	classInformer.Informer().AddEventHandlerWithOptions(countEvents("ingressclass", reconciler.ingressClassHandler()), cache.HandlerOptions{
 		Logger:       &c.log,
 		ResyncPeriod: nil,
 	})
 
+	c.Log(fmt.Sprintf("IngressClass informer created for controller %s.", c.ControllerName))
+
+	factories.each(func(factory informers.SharedInformerFactory) {
+		factory.Networking().V1().Ingresses().Informer().AddEventHandlerWithOptions(countEvents("ingress", reconciler), cache.HandlerOptions{
+			Logger:       &c.log,
+			ResyncPeriod: nil,
+		})
+	})
+
+	c.Log("Ingress informer created.")
+
+	clusterFactories := []informers.SharedInformerFactory{clusterFactory}
+	if namespaceSelector != nil {
+		namespaceFactory := newNamespaceFactory(clientset, namespaceSelector, resync)
+		clusterFactories = append(clusterFactories, namespaceFactory)
+		namespaceInformer := namespaceFactory.Core().V1().Namespaces()
+		namespaceLister := namespaceInformer.Lister()
+		ingresses.selected = func(namespace string) bool {
+			_, err := namespaceLister.Get(namespace)
+			return err == nil
+		}
+
+		// Namespaces entering or leaving the selection add or remove the
+		// routes of their Ingresses.
+		namespaceInformer.Informer().AddEventHandlerWithOptions(countEvents("namespace", reconciler.namespaceHandler(&ingressLister{listers: ingresses.listers})), cache.HandlerOptions{
+			Logger:       &c.log,
+			ResyncPeriod: nil,
+		})
+
+		c.Log(fmt.Sprintf("Namespace informer created for selector %s.", namespaceSelector))
+	}
+
+	// The leader reports the problems of our Ingresses, and publishes the
+	// addresses of the controller to their status.
+	writers := []func(ctx context.Context){reconciler.revalidate}
+	if c.PublishStatusAddress != "" || c.PublishService != "" {
+		addresses := &statusAddresses{static: parseStatusAddresses(c.PublishStatusAddress)}
+		status := newStatusUpdater(clientset, ingresses, classes, addresses, c.log)
+		writers = append(writers, status.Run)
+
+		factories.each(func(factory informers.SharedInformerFactory) {
+			factory.Networking().V1().Ingresses().Informer().AddEventHandlerWithOptions(status, cache.HandlerOptions{
+				Logger:       &c.log,
+				ResyncPeriod: nil,
+			})
+		})
+
+		if publishName != "" {
+			publishFactory := newPublishServiceFactory(clientset, publishNamespace, publishName, resync)
+			clusterFactories = append(clusterFactories, publishFactory)
+			serviceInformer := publishFactory.Core().V1().Services()
+			addresses.services = serviceInformer.Lister()
+			addresses.namespace, addresses.name = publishNamespace, publishName
+
+			serviceInformer.Informer().AddEventHandlerWithOptions(status.serviceHandler(), cache.HandlerOptions{
+				Logger:       &c.log,
+				ResyncPeriod: nil,
+			})
+		}
+
+		c.Log("Ingress status updater created.")
+	}
+
 	c.Log("Event handlers added to informer.")
 
-	stop := make(chan struct{})
-	defer close(stop)
+	// Only Secrets referenced by our Ingresses keep their data in the cache.
+	var transformErr error
+	factories.each(func(factory informers.SharedInformerFactory) {
+		secretInformer := factory.Core().V1().Secrets().Informer()
+		if err := secretInformer.SetTransform(router.Certificates().Transform); err != nil {
+			transformErr = err
+		}
+
+		secretInformer.AddEventHandlerWithOptions(countEvents("secret", router.Certificates()), cache.HandlerOptions{
+			Logger:       &c.log,
+			ResyncPeriod: nil,
+		})
+	})
+	if transformErr != nil {
+		return fmt.Errorf("failed to set secret informer transform: %v", transformErr)
+	}
+
+	c.Log("Secret informer created.")
+
+	if !c.ServiceUpstream {
+		router.SetEndpointResolver(routing.NewEndpointResolver(factories.serviceLister(), factories.endpointSliceLister()))
+
+		factories.each(func(factory informers.SharedInformerFactory) {
+			resources := map[string]cache.SharedIndexInformer{
+				"service":       factory.Core().V1().Services().Informer(),
+				"endpointslice": factory.Discovery().V1().EndpointSlices().Informer(),
+			}
+			for resource, informer := range resources {
+				informer.AddEventHandlerWithOptions(countEvents(resource, router.EndpointsHandler()), cache.HandlerOptions{
+					Logger:       &c.log,
+					ResyncPeriod: nil,
+				})
+			}
+		})
 
-	factory.Start(stop)
+		c.Log("EndpointSlice informer created.")
+	}
+
+	errCh := make(chan error, 3)
+
+	// The probes are answered while the caches sync, so that the controller
+	// is not ready until it has routes to serve.
+	health := &health{}
+	var adminSrv *http.Server
+	if c.AdminListen != "" {
+		adminSrv = &http.Server{
+			Addr:              c.AdminListen,
+			Handler:           newAdminHandler(leader, health),
+			ReadHeaderTimeout: c.ServerReadHeaderTimeout,
+		}
+
+		go func() {
+			c.Log(fmt.Sprintf("panacea-controller admin listening on %s", c.AdminListen))
+			if err := adminSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				errCh <- fmt.Errorf("admin server failed: %v", err)
+			}
+		}()
+	}
+
+	// The informers, the reconciler and the leader outlive ctx until the
+	// servers are drained, so that the routes stay current meanwhile.
+	informersCtx, stopInformers := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopInformers()
+	stop := informersCtx.Done()
+
+	for _, factory := range clusterFactories {
+		factory.Start(stop)
+	}
+	factories.each(func(factory informers.SharedInformerFactory) {
+		factory.Start(stop)
+	})
 
 	c.Log("Informer factory started.")
 
-	if !utils.Sync.CacheSync(factory, stop) {
+	synced := true
+	for _, factory := range clusterFactories {
+		synced = synced && utils.Sync.CacheSync(factory, ctx.Done())
+	}
+	for _, factory := range factories {
+		synced = synced && utils.Sync.CacheSync(factory, ctx.Done())
+	}
+	if ctx.Err() != nil {
+		c.Log("Shutting down before caches synced.")
+		return nil
+	}
+	if !synced {
 		c.Log("failed to sync caches")
 		return fmt.Errorf("failed to sync caches")
 	}
 
 	c.Log("Caches synced.")
-	utils.Sync.SyncIngresses(clientset, router, c.IngressClass)
+	utils.Sync.SyncIngresses(ingresses, router, classes)
 
-	c.Log(fmt.Sprintf("Ingress class %s sync complete.", c.IngressClass))
+	c.Log(fmt.Sprintf("Ingresses of controller %s synced.", c.ControllerName))
+	health.synced.Store(true)
 
-	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		host := r.Host
+	// Ingresses changed from now on are rebuilt one by one.
+	go reconciler.Run(stop)
 
-		if i := strings.IndexByte(host, ':'); i > 0 {
-			host = host[:i]
-		}
+	// Losing the leadership on shutdown releases the Lease to the next
+	// replica.
+	leaderDone := make(chan struct{})
+	go func() {
+		leader.Run(informersCtx, writers...)
+		close(leaderDone)
+	}()
 
-		c.Log(fmt.Sprintf("Received request host=%s path=%s", host, r.URL.Path))
+	h := &proxyHandler{router: router, access: access, log: c.log}
 
-		if rt := router.Match(host, r.URL.Path); rt != nil {
-			r.Host = rt.Backend.Host
-			r.Header.Set("X-Forwarded-Host", host)
-			r.Header.Set("X-Forwarded-Proto", rt.Backend.Scheme)
-			r.Header.Set("X-Forwarded-For", rt.Backend.Host)
-			w.Header().Set("X-Proxy-By", "panacea-controller")
-			rt.Proxy.ServeHTTP(w, r)
-			return
-		}
-		w.WriteHeader(http.StatusNotFound)
-		_, _ = w.Write([]byte("panacea-controller: no route found\n"))
-	})
+	// Accept h2c so that gRPC clients can use the plain listener.
+	protos := &http.Protocols{}
+	protos.SetHTTP1(true)
+	protos.SetUnencryptedHTTP2(true)
 
 	srv := &http.Server{
-		Addr:    c.Listen,
-		Handler: h,
+		Addr:              c.Listen,
+		Protocols:         protos,
+		Handler:           h,
+		ReadHeaderTimeout: c.ServerReadHeaderTimeout,
+		ReadTimeout:       c.ServerReadTimeout,
+		WriteTimeout:      c.ServerWriteTimeout,
+		IdleTimeout:       c.ServerIdleTimeout,
 	}
+	servers := []*http.Server{srv}
 
-	c.Log(fmt.Sprintf("panacea-controller listening on %s", c.Listen))
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		c.Log(fmt.Sprintf("HTTP server failed: %v", err))
-		os.Exit(1)
+	go func() {
+		c.Log(fmt.Sprintf("panacea-controller listening on %s", c.Listen))
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			errCh <- fmt.Errorf("HTTP server failed: %v", err)
+		}
+	}()
+
+	if c.ListenTLS != "" {
+		tlsSrv := &http.Server{
+			Addr:              c.ListenTLS,
+			Handler:           h,
+			ReadHeaderTimeout: c.ServerReadHeaderTimeout,
+			ReadTimeout:       c.ServerReadTimeout,
+			WriteTimeout:      c.ServerWriteTimeout,
+			IdleTimeout:       c.ServerIdleTimeout,
+			TLSConfig: &tls.Config{
+				MinVersion:     tls.VersionTLS12,
+				GetCertificate: router.GetCertificate,
+			},
+		}
+		servers = append(servers, tlsSrv)
+
+		go func() {
+			c.Log(fmt.Sprintf("panacea-controller listening on %s (TLS)", c.ListenTLS))
+			// Certificates are served by router.GetCertificate.
+			if err := tlsSrv.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+				errCh <- fmt.Errorf("HTTPS server failed: %v", err)
+			}
+		}()
 	}
-	return nil
+
+	var runErr error
+	select {
+	case runErr = <-errCh:
+		c.log.Error(runErr, "error serving, shutting down")
+	case <-ctx.Done():
+		// Failing readiness first lets the endpoints of the controller's
+		// Service drop the pod before it stops accepting connections.
+		c.Log(fmt.Sprintf("Shutting down, failing readiness for %s.", c.ShutdownDelay))
+		health.shuttingDown.Store(true)
+		time.Sleep(c.ShutdownDelay)
+	}
+
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), c.ShutdownTimeout)
+	defer cancelDrain()
+	if err := drain(drainCtx, servers...); err != nil {
+		c.log.Error(err, "error draining connections")
+	} else {
+		c.Log("Connections drained.")
+	}
+
+	stopInformers()
+	<-leaderDone
+	for _, upstream := range router.Upstreams() {
+		upstream.Close()
+	}
+
+	if adminSrv != nil {
+		if err := drain(drainCtx, adminSrv); err != nil {
+			c.log.Error(err, "error stopping admin server")
+		}
+	}
+
+	c.Log("panacea-controller stopped.")
+	return runErr
 }
@@ -0,0 +1,233 @@
+package controller
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danCrespo/panacea-ingress-controller/metrics"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
+	networkinglisters "k8s.io/client-go/listers/networking/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// parseResyncPeriod parses the --resync-period flag. A plain number is a
+// number of seconds.
+func parseResyncPeriod(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return parseResyncPeriod(strconv.Itoa(seconds) + "s")
+	}
+	period, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing resync period %q: %v", value, err)
+	}
+	if period < 0 {
+		return 0, fmt.Errorf("error parsing resync period %q: must not be negative", value)
+	}
+	return period, nil
+}
+
+// parseNamespaces parses the comma-separated --namespace flag. No namespace
+// means all of them.
+func parseNamespaces(value string) []string {
+	var namespaces []string
+	for namespace := range strings.SplitSeq(value, ",") {
+		namespace = strings.TrimSpace(namespace)
+		if namespace != "" && !slices.Contains(namespaces, namespace) {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces
+}
+
+// informerFactories holds an informer factory per watched namespace, or a
+// single one for all namespaces under metav1.NamespaceAll. Separate factories
+// let the controller run with Roles limited to its namespaces.
+type informerFactories map[string]informers.SharedInformerFactory
+
+func newInformerFactories(clientset kubernetes.Interface, namespaces []string, resync time.Duration) informerFactories {
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	factories := make(informerFactories, len(namespaces))
+	for _, namespace := range namespaces {
+		factories[namespace] = informers.NewSharedInformerFactoryWithOptions(clientset, resync, informers.WithNamespace(namespace))
+	}
+	return factories
+}
+
+// each calls fn with the factory of every namespace.
+func (f informerFactories) each(fn func(factory informers.SharedInformerFactory)) {
+	for _, factory := range f {
+		fn(factory)
+	}
+}
+
+func (f informerFactories) ingressLister() *ingressLister {
+	listers := make(map[string]networkinglisters.IngressLister, len(f))
+	for namespace, factory := range f {
+		listers[namespace] = factory.Networking().V1().Ingresses().Lister()
+	}
+	return &ingressLister{listers: listers}
+}
+
+func (f informerFactories) serviceLister() corelisters.ServiceLister {
+	listers := make(map[string]corelisters.ServiceLister, len(f))
+	for namespace, factory := range f {
+		listers[namespace] = factory.Core().V1().Services().Lister()
+	}
+	return &serviceLister{listers: listers}
+}
+
+func (f informerFactories) endpointSliceLister() discoverylisters.EndpointSliceLister {
+	listers := make(map[string]discoverylisters.EndpointSliceLister, len(f))
+	for namespace, factory := range f {
+		listers[namespace] = factory.Discovery().V1().EndpointSlices().Lister()
+	}
+	return &endpointSliceLister{listers: listers}
+}
+
+// emptyIndexer backs the listers of namespaces that are not watched.
+func emptyIndexer() cache.Indexer {
+	return cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+}
+
+// listerFor returns the lister of the factory watching namespace, or of the
+// factory of all namespaces.
+func listerFor[L any](listers map[string]L, namespace string) (L, bool) {
+	if lister, ok := listers[metav1.NamespaceAll]; ok {
+		return lister, true
+	}
+	lister, ok := listers[namespace]
+	return lister, ok
+}
+
+// listAll lists the objects of every lister in listers.
+func listAll[L any, T any](listers map[string]L, list func(L) ([]T, error)) ([]T, error) {
+	var all []T
+	for _, lister := range listers {
+		items, err := list(lister)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+	}
+	return all, nil
+}
+
+// ingressLister joins the Ingress listers of several namespaces. Namespaces
+// that are not watched have no Ingresses, as do those the selected function
+// rejects when it is set.
+type ingressLister struct {
+	listers  map[string]networkinglisters.IngressLister
+	selected func(namespace string) bool
+}
+
+func (l *ingressLister) List(selector labels.Selector) ([]*networkingv1.Ingress, error) {
+	ingresses, err := listAll(l.listers, func(lister networkinglisters.IngressLister) ([]*networkingv1.Ingress, error) {
+		return lister.List(selector)
+	})
+	if err != nil || l.selected == nil {
+		return ingresses, err
+	}
+	return slices.DeleteFunc(ingresses, func(ingress *networkingv1.Ingress) bool {
+		return !l.selected(ingress.Namespace)
+	}), nil
+}
+
+func (l *ingressLister) Ingresses(namespace string) networkinglisters.IngressNamespaceLister {
+	lister, ok := listerFor(l.listers, namespace)
+	if !ok || (l.selected != nil && !l.selected(namespace)) {
+		lister = networkinglisters.NewIngressLister(emptyIndexer())
+	}
+	return lister.Ingresses(namespace)
+}
+
+// serviceLister joins the Service listers of several namespaces.
+type serviceLister struct {
+	listers map[string]corelisters.ServiceLister
+}
+
+func (l *serviceLister) List(selector labels.Selector) ([]*corev1.Service, error) {
+	return listAll(l.listers, func(lister corelisters.ServiceLister) ([]*corev1.Service, error) {
+		return lister.List(selector)
+	})
+}
+
+func (l *serviceLister) Services(namespace string) corelisters.ServiceNamespaceLister {
+	lister, ok := listerFor(l.listers, namespace)
+	if !ok {
+		lister = corelisters.NewServiceLister(emptyIndexer())
+	}
+	return lister.Services(namespace)
+}
+
+// endpointSliceLister joins the EndpointSlice listers of several namespaces.
+type endpointSliceLister struct {
+	listers map[string]discoverylisters.EndpointSliceLister
+}
+
+func (l *endpointSliceLister) List(selector labels.Selector) ([]*discoveryv1.EndpointSlice, error) {
+	return listAll(l.listers, func(lister discoverylisters.EndpointSliceLister) ([]*discoveryv1.EndpointSlice, error) {
+		return lister.List(selector)
+	})
+}
+
+func (l *endpointSliceLister) EndpointSlices(namespace string) discoverylisters.EndpointSliceNamespaceLister {
+	lister, ok := listerFor(l.listers, namespace)
+	if !ok {
+		lister = discoverylisters.NewEndpointSliceLister(emptyIndexer())
+	}
+	return lister.EndpointSlices(namespace)
+}
+
+// newNamespaceFactory returns an informer factory of the namespaces matching
+// selector, which decide the namespaces Ingresses are read from.
+func newNamespaceFactory(clientset kubernetes.Interface, selector labels.Selector, resync time.Duration) informers.SharedInformerFactory {
+	return informers.NewSharedInformerFactoryWithOptions(clientset, resync, informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+		options.LabelSelector = selector.String()
+	}))
+}
+
+// countingHandler counts the events of the informer of resource before
+// passing them on to handler.
+type countingHandler struct {
+	resource string
+	handler  cache.ResourceEventHandler
+}
+
+func countEvents(resource string, handler cache.ResourceEventHandler) cache.ResourceEventHandler {
+	return &countingHandler{resource: resource, handler: handler}
+}
+
+// OnAdd implements cache.ResourceEventHandler.
+func (h *countingHandler) OnAdd(obj any, isInInitialList bool) {
+	metrics.InformerEvent(h.resource, "add")
+	h.handler.OnAdd(obj, isInInitialList)
+}
+
+// OnUpdate implements cache.ResourceEventHandler.
+func (h *countingHandler) OnUpdate(oldObj, newObj any) {
+	metrics.InformerEvent(h.resource, "update")
+	h.handler.OnUpdate(oldObj, newObj)
+}
+
+// OnDelete implements cache.ResourceEventHandler.
+func (h *countingHandler) OnDelete(obj any) {
+	metrics.InformerEvent(h.resource, "delete")
+	h.handler.OnDelete(obj)
+}
@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	networkinglisters "k8s.io/client-go/listers/networking/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestParseResyncPeriod(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected time.Duration
+		wantErr  bool
+	}{
+		{value: "", expected: 0},
+		{value: "0", expected: 0},
+		{value: "30", expected: 30 * time.Second},
+		{value: "30s", expected: 30 * time.Second},
+		{value: "5m", expected: 5 * time.Minute},
+		{value: "-1", wantErr: true},
+		{value: "-5m", wantErr: true},
+		{value: "soon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			period, err := parseResyncPeriod(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got %v", period)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if period != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, period)
+			}
+		})
+	}
+}
+
+func TestParseNamespaces(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected []string
+	}{
+		{"", nil},
+		{"team-a", []string{"team-a"}},
+		{"team-a, team-b,,team-a", []string{"team-a", "team-b"}},
+	}
+
+	for _, tt := range tests {
+		if namespaces := parseNamespaces(tt.value); !slices.Equal(namespaces, tt.expected) {
+			t.Errorf("parseNamespaces(%q): expected %v, got %v", tt.value, tt.expected, namespaces)
+		}
+	}
+}
+
+func newTestIngressLister(t *testing.T, ingresses ...*networkingv1.Ingress) networkinglisters.IngressLister {
+	t.Helper()
+
+	indexer := emptyIndexer()
+	for _, ingress := range ingresses {
+		if err := indexer.Add(ingress); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	return networkinglisters.NewIngressLister(indexer)
+}
+
+func namespacedIngress(namespace, name string) *networkingv1.Ingress {
+	return &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name}}
+}
+
+func ingressKeys(ingresses []*networkingv1.Ingress) []string {
+	keys := make([]string, 0, len(ingresses))
+	for _, ingress := range ingresses {
+		keys = append(keys, ingress.Namespace+"/"+ingress.Name)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func TestIngressLister(t *testing.T) {
+	lister := &ingressLister{listers: map[string]networkinglisters.IngressLister{
+		"team-a": newTestIngressLister(t, namespacedIngress("team-a", "app")),
+		"team-b": newTestIngressLister(t, namespacedIngress("team-b", "api"), namespacedIngress("team-b", "web")),
+	}}
+
+	t.Run("lists every watched namespace", func(t *testing.T) {
+		ingresses, err := lister.List(labels.Everything())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if keys := ingressKeys(ingresses); !slices.Equal(keys, []string{"team-a/app", "team-b/api", "team-b/web"}) {
+			t.Errorf("Unexpected ingresses %v", keys)
+		}
+	})
+
+	t.Run("gets from the lister of the namespace", func(t *testing.T) {
+		if _, err := lister.Ingresses("team-b").Get("api"); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+		if _, err := lister.Ingresses("team-a").Get("api"); err == nil {
+			t.Error("Expected team-a/api not to be found")
+		}
+		if _, err := lister.Ingresses("team-c").Get("app"); err == nil {
+			t.Error("Expected no Ingress in a namespace that is not watched")
+		}
+	})
+
+	t.Run("hides namespaces that are not selected", func(t *testing.T) {
+		selected := &ingressLister{listers: lister.listers, selected: func(namespace string) bool {
+			return namespace == "team-b"
+		}}
+
+		ingresses, err := selected.List(labels.Everything())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if keys := ingressKeys(ingresses); !slices.Equal(keys, []string{"team-b/api", "team-b/web"}) {
+			t.Errorf("Unexpected ingresses %v", keys)
+		}
+		if _, err := selected.Ingresses("team-a").Get("app"); err == nil {
+			t.Error("Expected no Ingress in a namespace that is not selected")
+		}
+	})
+
+	t.Run("uses the lister of all namespaces", func(t *testing.T) {
+		all := &ingressLister{listers: map[string]networkinglisters.IngressLister{
+			metav1.NamespaceAll: newTestIngressLister(t, namespacedIngress("team-c", "app")),
+		}}
+		if _, err := all.Ingresses("team-c").Get("app"); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	})
+}
+
+func TestIngressReconcilerNamespaceHandler(t *testing.T) {
+	r, _, _ := newTestReconciler(t)
+	r.debounce = 0
+	all := newTestIngressLister(t, namespacedIngress("team-a", "app"), namespacedIngress("team-a", "api"), namespacedIngress("team-b", "web"))
+	handler := r.namespaceHandler(all)
+
+	handler.OnDelete(cache.DeletedFinalStateUnknown{Key: "team-a", Obj: &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a"}}})
+
+	var keys []string
+	for r.queue.Len() > 0 {
+		key, _ := r.queue.Get()
+		keys = append(keys, key)
+		r.queue.Done(key)
+	}
+	slices.Sort(keys)
+	if !slices.Equal(keys, []string{"team-a/api", "team-a/app"}) {
+		t.Errorf("Expected the Ingresses of team-a to be queued, got %v", keys)
+	}
+}
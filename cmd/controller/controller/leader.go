@@ -0,0 +1,193 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"k8s.io/client-go/tools/record"
+)
+
+// namespaceFile holds the namespace of the pod's service account.
+const namespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// podNamespace returns the namespace the controller runs in, from the
+// POD_NAMESPACE environment variable or the service account, or "default"
+// outside of a cluster.
+func podNamespace() string {
+	if namespace := os.Getenv("POD_NAMESPACE"); namespace != "" {
+		return namespace
+	}
+	if data, err := os.ReadFile(namespaceFile); err == nil {
+		if namespace := strings.TrimSpace(string(data)); namespace != "" {
+			return namespace
+		}
+	}
+	return "default"
+}
+
+// leaderConfig configures the Lease based leader election.
+type leaderConfig struct {
+	Enabled       bool
+	Identity      string // Empty for the hostname
+	Namespace     string // Empty for the namespace of the pod
+	Name          string
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+}
+
+// leader tracks whether this replica holds the Lease of the controller, and
+// runs the work that writes to the API while it does. Every replica serves
+// traffic, but only the leader writes. With leader election disabled the
+// replica always leads.
+type leader struct {
+	identity string
+	elector  *leaderelection.LeaderElector // Nil when leader election is disabled
+	writers  []func(ctx context.Context)
+	leading  atomic.Bool
+	log      logr.Logger
+}
+
+func newLeader(clientset kubernetes.Interface, cfg leaderConfig, log logr.Logger) (*leader, error) {
+	identity := cfg.Identity
+	if identity == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("error getting leader election identity: %v", err)
+		}
+		identity = hostname
+	}
+
+	l := &leader{
+		identity: identity,
+		log:      log.WithValues("component", "leader", "identity", identity),
+	}
+	if !cfg.Enabled {
+		return l, nil
+	}
+
+	namespace := cfg.Namespace
+	if namespace == "" {
+		namespace = podNamespace()
+	}
+	lock, err := resourcelock.New(resourcelock.LeasesResourceLock, namespace, cfg.Name,
+		clientset.CoreV1(), clientset.CoordinationV1(), resourcelock.ResourceLockConfig{Identity: identity})
+	if err != nil {
+		return nil, fmt.Errorf("error creating leader election lock: %v", err)
+	}
+
+	l.elector, err = leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		LeaseDuration:   cfg.LeaseDuration,
+		RenewDeadline:   cfg.RenewDeadline,
+		RetryPeriod:     cfg.RetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            cfg.Name,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: l.lead,
+			OnStoppedLeading: func() {},
+			OnNewLeader: func(leader string) {
+				l.log.Info("New leader elected", "leader", leader)
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error creating leader elector: %v", err)
+	}
+	return l, nil
+}
+
+// IsLeader reports whether this replica leads.
+func (l *leader) IsLeader() bool {
+	return l.leading.Load()
+}
+
+// Run campaigns for the Lease until ctx is done. The writers run while this
+// replica holds the Lease, with a context cancelled when it is lost, after
+// which the replica campaigns again.
+func (l *leader) Run(ctx context.Context, writers ...func(ctx context.Context)) {
+	l.writers = writers
+	if l.elector == nil {
+		l.lead(ctx)
+		return
+	}
+
+	for ctx.Err() == nil {
+		l.elector.Run(ctx)
+	}
+}
+
+// lead runs the writers until ctx, the context of the term, is done.
+func (l *leader) lead(ctx context.Context) {
+	if ctx.Err() != nil {
+		return
+	}
+	l.leading.Store(true)
+	l.log.Info("Started leading")
+	context.AfterFunc(ctx, func() {
+		l.leading.Store(false)
+		l.log.Info("Stopped leading")
+	})
+
+	var wg sync.WaitGroup
+	for _, writer := range l.writers {
+		wg.Go(func() { writer(ctx) })
+	}
+	wg.Wait()
+}
+
+// ServeHTTP reports the leadership of the replica as JSON.
+func (l *leader) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	state := struct {
+		Identity string `json:"identity"`
+		Leader   bool   `json:"leader"`
+		Current  string `json:"currentLeader,omitempty"`
+	}{
+		Identity: l.identity,
+		Leader:   l.IsLeader(),
+		Current:  l.identity,
+	}
+	if l.elector != nil {
+		state.Current = l.elector.GetLeader()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(state)
+}
+
+// leaderRecorder drops the events recorded while the replica does not lead,
+// as the leader records the same ones.
+type leaderRecorder struct {
+	record.EventRecorder
+	leader *leader
+}
+
+func (r *leaderRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	if r.leader.IsLeader() {
+		r.EventRecorder.Event(object, eventtype, reason, message)
+	}
+}
+
+func (r *leaderRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...any) {
+	if r.leader.IsLeader() {
+		r.EventRecorder.Eventf(object, eventtype, reason, messageFmt, args...)
+	}
+}
+
+func (r *leaderRecorder) AnnotatedEventf(object runtime.Object, annotations map[string]string, eventtype, reason, messageFmt string, args ...any) {
+	if r.leader.IsLeader() {
+		r.EventRecorder.AnnotatedEventf(object, annotations, eventtype, reason, messageFmt, args...)
+	}
+}
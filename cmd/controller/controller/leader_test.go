@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func newTestLeader(t *testing.T, clientset kubernetes.Interface, identity string, enabled bool) *leader {
+	t.Helper()
+
+	l, err := newLeader(clientset, leaderConfig{
+		Enabled:       enabled,
+		Identity:      identity,
+		Namespace:     "ingress",
+		Name:          "panacea-ingress-controller-leader",
+		LeaseDuration: 2 * time.Second,
+		RenewDeadline: time.Second,
+		RetryPeriod:   100 * time.Millisecond,
+	}, logr.Discard())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return l
+}
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// runLeader runs l with a writer counting the terms it leads, and returns
+// the counter and the function stopping l.
+func runLeader(l *leader) (*atomic.Int32, context.CancelFunc) {
+	var terms atomic.Int32
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		l.Run(ctx, func(ctx context.Context) {
+			terms.Add(1)
+			<-ctx.Done()
+		})
+		close(done)
+	}()
+	return &terms, func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestLeaderDisabled(t *testing.T) {
+	l := newTestLeader(t, fake.NewClientset(), "replica-a", false)
+	terms, stop := runLeader(l)
+
+	waitFor(t, "the writer to run", func() bool { return terms.Load() == 1 })
+	if !l.IsLeader() {
+		t.Errorf("Expected a replica without leader election to lead")
+	}
+
+	stop()
+	waitFor(t, "the replica to stop leading", func() bool { return !l.IsLeader() })
+}
+
+func TestLeaderElection(t *testing.T) {
+	clientset := fake.NewClientset()
+	a := newTestLeader(t, clientset, "replica-a", true)
+	termsA, stopA := runLeader(a)
+	waitFor(t, "replica-a to lead", a.IsLeader)
+
+	b := newTestLeader(t, clientset, "replica-b", true)
+	termsB, stopB := runLeader(b)
+	defer stopB()
+
+	time.Sleep(300 * time.Millisecond)
+	if b.IsLeader() || termsB.Load() != 0 {
+		t.Errorf("Expected replica-b not to lead while replica-a holds the lease")
+	}
+	if termsA.Load() != 1 {
+		t.Errorf("Expected the writer of replica-a to run once, got %d", termsA.Load())
+	}
+
+	// The lease is released on shutdown, so replica-b takes over without
+	// waiting for it to expire.
+	stopA()
+	waitFor(t, "replica-a to stop leading", func() bool { return !a.IsLeader() })
+	waitFor(t, "replica-b to lead", b.IsLeader)
+	waitFor(t, "the writer of replica-b to run", func() bool { return termsB.Load() == 1 })
+}
+
+func TestLeaderServeHTTP(t *testing.T) {
+	l := newTestLeader(t, fake.NewClientset(), "replica-a", true)
+
+	get := func() map[string]any {
+		rec := httptest.NewRecorder()
+		newAdminHandler(l, &health{}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/leader", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", rec.Code)
+		}
+		var state map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &state); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return state
+	}
+
+	if state := get(); state["leader"] != false || state["identity"] != "replica-a" {
+		t.Errorf("Expected replica-a not to lead yet, got %v", state)
+	}
+
+	_, stop := runLeader(l)
+	defer stop()
+	waitFor(t, "replica-a to lead", l.IsLeader)
+
+	if state := get(); state["leader"] != true || state["currentLeader"] != "replica-a" {
+		t.Errorf("Expected replica-a to lead, got %v", state)
+	}
+}
+
+func TestLeaderRecorder(t *testing.T) {
+	fakeRecorder := record.NewFakeRecorder(10)
+	l := newTestLeader(t, fake.NewClientset(), "replica-a", true)
+	recorder := &leaderRecorder{EventRecorder: fakeRecorder, leader: l}
+	ingress := newTestIngress("ours", "panacea", "app.example.com")
+
+	recorder.Eventf(ingress, "Warning", "InvalidBackend", "backend %s not found", "app")
+	if len(fakeRecorder.Events) != 0 {
+		t.Errorf("Expected no events while not leading, got %d", len(fakeRecorder.Events))
+	}
+
+	l.leading.Store(true)
+	recorder.Eventf(ingress, "Warning", "InvalidBackend", "backend %s not found", "app")
+	if len(fakeRecorder.Events) != 1 {
+		t.Errorf("Expected the event of the leader, got %d events", len(fakeRecorder.Events))
+	}
+}
@@ -0,0 +1,247 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/danCrespo/panacea-ingress-controller/accesslog"
+	"github.com/danCrespo/panacea-ingress-controller/metrics"
+	"github.com/danCrespo/panacea-ingress-controller/routing"
+	"github.com/danCrespo/panacea-ingress-controller/tracing"
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// proxyHandler serves the requests of the data plane listeners from the
+// routes of the routing table, and writes their access log.
+type proxyHandler struct {
+	router routing.RoutingTable
+	access *accesslog.Logger // nil when the access log is disabled
+	log    logr.Logger
+}
+
+func (p *proxyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	host := r.Host
+
+	if i := strings.IndexByte(host, ':'); i > 0 {
+		host = host[:i]
+	}
+
+	// The upstream sees the request ID the access log is written with.
+	id := requestID(r)
+	r.Header.Set(requestIDHeader, id)
+
+	ctx, span := startServerSpan(r, host, id)
+	defer span.End()
+	r = r.WithContext(ctx)
+
+	var entry *accesslog.Entry
+	if p.access != nil {
+		entry = &accesslog.Entry{RequestID: id}
+		r = r.WithContext(accesslog.NewContext(r.Context(), entry))
+	}
+
+	body := &countingReader{ReadCloser: r.Body}
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = body
+	}
+	rw := &responseWriter{ResponseWriter: w}
+
+	route := p.router.Match(host, r.URL.Path)
+	if route != nil {
+		rw.Header().Set("X-Proxy-By", "panacea-controller")
+		route.Proxy.ServeHTTP(rw, r)
+	} else {
+		// Without a default backend there is nothing to serve the request.
+		rw.WriteHeader(http.StatusNotFound)
+		_, _ = rw.Write([]byte("panacea-controller: no route found\n"))
+	}
+
+	endServerSpan(span, r, route, rw.Status())
+
+	duration := time.Since(start)
+	metrics.ObserveRequest(route.Labels(), rw.Status(), body.n, rw.written, duration)
+
+	if entry != nil {
+		p.logAccess(entry, r, route, rw, body.n, start, duration)
+	}
+}
+
+// startServerSpan starts the span of r, child of the span of the client or
+// the proxy in front when the request carries its trace context.
+func startServerSpan(r *http.Request, host, id string) (context.Context, trace.Span) {
+	ctx := tracing.Extract(r.Context(), r.Header)
+	ctx, span := tracing.Tracer().Start(ctx, r.Method, trace.WithSpanKind(trace.SpanKindServer))
+	if !span.IsRecording() {
+		return ctx, span
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		clientIP = r.RemoteAddr
+	}
+	span.SetAttributes(
+		semconv.HTTPRequestMethodKey.String(r.Method),
+		semconv.URLScheme(scheme),
+		semconv.URLPath(r.URL.Path),
+		semconv.ServerAddress(host),
+		semconv.ClientAddress(clientIP),
+		semconv.UserAgentOriginal(r.UserAgent()),
+		semconv.NetworkProtocolVersion(fmt.Sprintf("%d.%d", r.ProtoMajor, r.ProtoMinor)),
+		attribute.StringSlice("http.request.header.x-request-id", []string{id}),
+	)
+	return ctx, span
+}
+
+// endServerSpan records the route r matched and the status of its response
+// to span. Server errors fail the span.
+func endServerSpan(span trace.Span, r *http.Request, route *routing.Route, status int) {
+	if !span.IsRecording() {
+		return
+	}
+
+	if route != nil {
+		// Span names are bounded by the routes as the metric labels are.
+		span.SetName(r.Method + " " + route.Path)
+		span.SetAttributes(
+			semconv.HTTPRoute(route.Path),
+			semconv.K8SNamespaceName(route.Namespace),
+			attribute.String("k8s.ingress.name", route.Ingress),
+		)
+	}
+	span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+}
+
+// logAccess completes the access log entry of r and writes it.
+func (p *proxyHandler) logAccess(entry *accesslog.Entry, r *http.Request, route *routing.Route, rw *responseWriter, received int64, start time.Time, duration time.Duration) {
+	clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		clientIP = r.RemoteAddr
+	}
+	user, _, _ := r.BasicAuth()
+
+	entry.Time = start
+	entry.ClientIP = clientIP
+	entry.RemoteUser = user
+	entry.Method = r.Method
+	entry.URI = r.RequestURI
+	entry.Protocol = r.Proto
+	entry.Host = r.Host
+	entry.Status = rw.Status()
+	entry.BytesSent = rw.written
+	entry.BytesReceived = received
+	entry.Duration = duration
+	entry.Referer = r.Referer()
+	entry.UserAgent = r.UserAgent()
+	if route != nil {
+		entry.Namespace, entry.Ingress = route.Namespace, route.Ingress
+		entry.RouteHost, entry.RoutePath = route.Host, route.Path
+	}
+	p.access.Log(entry)
+}
+
+const requestIDHeader = "X-Request-ID"
+
+// requestID returns the ID of the request: the one set by the client or a
+// proxy in front, when it is safe to log as it is, or a new random one.
+func requestID(r *http.Request) string {
+	if id := r.Header.Get(requestIDHeader); validRequestID(id) {
+		return id
+	}
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' || c == ':') {
+			return false
+		}
+	}
+	return true
+}
+
+// responseWriter records the status and the size of a response. The
+// http.ResponseController of the proxy reaches the underlying writer through
+// Unwrap to flush and hijack it.
+type responseWriter struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	// Informational responses precede the final one.
+	if w.status == 0 && status >= http.StatusOK {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.written += int64(n)
+	return n, err
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Hijack hands the connection over to the proxy for protocol upgrades, which
+// answer 101 Switching Protocols on the connection itself.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, brw, err
+}
+
+// Status returns the status of the response, 200 when the handler wrote
+// nothing.
+func (w *responseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// countingReader counts the bytes read from a request body.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,279 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/danCrespo/panacea-ingress-controller/accesslog"
+	"github.com/danCrespo/panacea-ingress-controller/metrics"
+	"github.com/danCrespo/panacea-ingress-controller/routing"
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// matchRouter routes every request for host to route.
+type matchRouter struct {
+	routing.RoutingTable
+
+	host  string
+	route *routing.Route
+}
+
+func (m *matchRouter) Match(host, _ string) *routing.Route {
+	if host == m.host {
+		return m.route
+	}
+	return nil
+}
+
+func scrapeMetrics(t *testing.T) string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	return rec.Body.String()
+}
+
+func TestProxyHandler(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write(append([]byte("echo:"), body...))
+	}))
+	defer backend.Close()
+
+	target, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	route := &routing.Route{
+		Host:      "proxy.example.com",
+		Path:      "/",
+		Namespace: "default",
+		Ingress:   "proxy",
+		Proxy:     httputil.NewSingleHostReverseProxy(target),
+	}
+	h := &proxyHandler{router: &matchRouter{host: "proxy.example.com", route: route}, log: logr.Discard()}
+
+	t.Run("proxies matched requests", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "http://proxy.example.com:8080/items", strings.NewReader("hello"))
+		h.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusCreated || rec.Body.String() != "echo:hello" {
+			t.Errorf("Expected the response of the backend, got %d %q", rec.Code, rec.Body.String())
+		}
+		if rec.Header().Get("X-Proxy-By") != "panacea-controller" {
+			t.Errorf("Expected the X-Proxy-By header")
+		}
+	})
+
+	t.Run("answers unmatched requests with 404", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://random-1234.example.com/anything", nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Expected 404, got %d", rec.Code)
+		}
+	})
+
+	t.Run("labels metrics with the matched route", func(t *testing.T) {
+		body := scrapeMetrics(t)
+		for _, expected := range []string{
+			`panacea_requests_total{host="proxy.example.com",ingress="proxy",namespace="default",path="/",status="2xx"} 1`,
+			`panacea_request_size_bytes_sum{host="proxy.example.com",ingress="proxy",namespace="default",path="/"} 5`,
+			`panacea_response_size_bytes_sum{host="proxy.example.com",ingress="proxy",namespace="default",path="/"} 10`,
+			`panacea_requests_total{host="",ingress="",namespace="",path="",status="4xx"}`,
+		} {
+			if !strings.Contains(body, expected) {
+				t.Errorf("Expected the metrics to contain %q", expected)
+			}
+		}
+		// Request hosts never become label values.
+		if strings.Contains(body, "random-1234") || strings.Contains(body, "/anything") {
+			t.Errorf("Expected unmatched requests not to create series of their own")
+		}
+	})
+}
+
+func TestProxyHandlerAccessLog(t *testing.T) {
+	var forwarded string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get("X-Request-ID")
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+
+	target, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	route := &routing.Route{
+		Host:      "logs.example.com",
+		Path:      "/api",
+		Namespace: "default",
+		Ingress:   "logs",
+		Proxy:     httputil.NewSingleHostReverseProxy(target),
+	}
+	var buf bytes.Buffer
+	h := &proxyHandler{
+		router: &matchRouter{host: "logs.example.com", route: route},
+		access: accesslog.New(&buf, accesslog.FormatJSON, 100),
+		log:    logr.Discard(),
+	}
+
+	serve := func(header http.Header) map[string]any {
+		t.Helper()
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/api/items?page=2", nil)
+		req.Host = "logs.example.com"
+		req.RemoteAddr = "10.0.0.7:52100"
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		h.ServeHTTP(httptest.NewRecorder(), req)
+
+		var entry map[string]any
+		if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+			t.Fatalf("Expected a JSON access log line, got %q: %v", buf.String(), err)
+		}
+		return entry
+	}
+
+	t.Run("logs the request and the route", func(t *testing.T) {
+		entry := serve(nil)
+		expected := map[string]any{
+			"client_ip":  "10.0.0.7",
+			"method":     http.MethodGet,
+			"uri":        "/api/items?page=2",
+			"host":       "logs.example.com",
+			"status":     float64(http.StatusOK),
+			"bytes_sent": float64(2),
+			"namespace":  "default",
+			"ingress":    "logs",
+			"route":      "logs.example.com/api",
+		}
+		for key, value := range expected {
+			if entry[key] != value {
+				t.Errorf("Expected %s to be %v, got %v", key, value, entry[key])
+			}
+		}
+		if id, _ := entry["request_id"].(string); len(id) != 32 || id != forwarded {
+			t.Errorf("Expected a generated request ID forwarded to the upstream, got %q and %q", id, forwarded)
+		}
+	})
+
+	t.Run("keeps the request ID of the client", func(t *testing.T) {
+		entry := serve(http.Header{"X-Request-Id": {"trace-42"}})
+		if entry["request_id"] != "trace-42" || forwarded != "trace-42" {
+			t.Errorf("Expected the request ID of the client, got %v and %q", entry["request_id"], forwarded)
+		}
+	})
+
+	t.Run("replaces unsafe request IDs", func(t *testing.T) {
+		entry := serve(http.Header{"X-Request-Id": {`bad "id"`}})
+		if entry["request_id"] == `bad "id"` || forwarded == `bad "id"` {
+			t.Errorf("Expected an unsafe request ID to be replaced")
+		}
+	})
+
+}
+
+func TestProxyHandlerSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	}()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer backend.Close()
+
+	target, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	route := &routing.Route{
+		Host:      "traced.example.com",
+		Path:      "/api",
+		Namespace: "default",
+		Ingress:   "traced",
+		Proxy:     httputil.NewSingleHostReverseProxy(target),
+	}
+	h := &proxyHandler{router: &matchRouter{host: "traced.example.com", route: route}, log: logr.Discard()}
+
+	req := httptest.NewRequest(http.MethodGet, "http://traced.example.com/api/items", nil)
+	req.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "http://unknown.example.com/", nil))
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected a span per request, got %d", len(spans))
+	}
+
+	matched := spans[0]
+	if matched.Name() != "GET /api" || matched.SpanKind() != trace.SpanKindServer {
+		t.Errorf("Expected a server span named after the route, got %s %q", matched.SpanKind(), matched.Name())
+	}
+	if matched.Parent().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || matched.Parent().SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("Expected the span to continue the trace of the client, got parent %v", matched.Parent())
+	}
+	if matched.Status().Code != codes.Error {
+		t.Errorf("Expected the 502 response to fail the span")
+	}
+	attributes := map[attribute.Key]attribute.Value{}
+	for _, attr := range matched.Attributes() {
+		attributes[attr.Key] = attr.Value
+	}
+	if attributes["http.route"].AsString() != "/api" || attributes["k8s.ingress.name"].AsString() != "traced" || attributes["http.response.status_code"].AsInt64() != http.StatusBadGateway {
+		t.Errorf("Expected the attributes of the route and the status, got %v", matched.Attributes())
+	}
+
+	if unmatched := spans[1]; unmatched.Name() != "GET" || unmatched.Parent().IsValid() {
+		t.Errorf("Expected a root span named after the method for unmatched requests, got %q", unmatched.Name())
+	}
+}
+
+func TestResponseWriterStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		write    func(w http.ResponseWriter)
+		expected int
+	}{
+		{name: "nothing written", write: func(http.ResponseWriter) {}, expected: http.StatusOK},
+		{name: "body only", write: func(w http.ResponseWriter) { _, _ = w.Write([]byte("ok")) }, expected: http.StatusOK},
+		{name: "explicit status", write: func(w http.ResponseWriter) { w.WriteHeader(http.StatusBadGateway) }, expected: http.StatusBadGateway},
+		{name: "early hints", write: func(w http.ResponseWriter) {
+			w.WriteHeader(http.StatusEarlyHints)
+			w.WriteHeader(http.StatusNoContent)
+		}, expected: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &responseWriter{ResponseWriter: httptest.NewRecorder()}
+			tt.write(w)
+			if status := w.Status(); status != tt.expected {
+				t.Errorf("Expected status %d, got %d", tt.expected, status)
+			}
+		})
+	}
+}
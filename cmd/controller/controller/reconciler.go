@@ -0,0 +1,270 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/danCrespo/panacea-ingress-controller/metrics"
+	"github.com/danCrespo/panacea-ingress-controller/routing"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	networkinglisters "k8s.io/client-go/listers/networking/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// ingressDebounce is how long an Ingress waits in the queue before being
+// reconciled, so that a burst of events for it rebuilds its routes once.
+const ingressDebounce = 100 * time.Millisecond
+
+// ingressReconciler keeps the routes of the routing table in sync with the
+// Ingresses in the informer cache, one Ingress at a time.
+type ingressReconciler struct {
+	queue    workqueue.TypedRateLimitingInterface[string]
+	lister   networkinglisters.IngressLister
+	router   routing.RoutingTable
+	classes  routing.IngressClassMatcher
+	debounce time.Duration
+	log      logr.Logger
+
+	mu sync.Mutex
+	// rebuild holds the Ingresses queued to be rebuilt even when their
+	// routes are up to date.
+	rebuild map[string]struct{}
+}
+
+var _ cache.ResourceEventHandler = (*ingressReconciler)(nil)
+
+func newIngressReconciler(lister networkinglisters.IngressLister, router routing.RoutingTable, classes routing.IngressClassMatcher, log logr.Logger) *ingressReconciler {
+	return &ingressReconciler{
+		queue: workqueue.NewTypedRateLimitingQueueWithConfig(
+			workqueue.DefaultTypedControllerRateLimiter[string](),
+			workqueue.TypedRateLimitingQueueConfig[string]{Name: "ingresses"},
+		),
+		lister:   lister,
+		router:   router,
+		classes:  classes,
+		debounce: ingressDebounce,
+		log:      log.WithValues("component", "reconciler"),
+		rebuild:  make(map[string]struct{}),
+	}
+}
+
+// OnAdd implements cache.ResourceEventHandler.
+func (r *ingressReconciler) OnAdd(obj any, _ bool) {
+	r.enqueue(obj)
+}
+
+// OnUpdate implements cache.ResourceEventHandler. Updates of the status
+// alone, such as the status updater makes, leave the routes as they are.
+func (r *ingressReconciler) OnUpdate(oldObj, newObj any) {
+	if statusUpdated(oldObj, newObj) {
+		return
+	}
+	r.enqueue(newObj)
+}
+
+// OnDelete implements cache.ResourceEventHandler.
+func (r *ingressReconciler) OnDelete(obj any) {
+	r.enqueue(obj)
+}
+
+// statusUpdated reports whether an Ingress update changed its status but
+// neither its spec nor its annotations.
+func statusUpdated(oldObj, newObj any) bool {
+	oldIngress, okOld := oldObj.(*networkingv1.Ingress)
+	newIngress, okNew := newObj.(*networkingv1.Ingress)
+	return okOld && okNew &&
+		oldIngress.ResourceVersion != newIngress.ResourceVersion &&
+		oldIngress.Generation == newIngress.Generation &&
+		maps.Equal(oldIngress.Annotations, newIngress.Annotations) &&
+		!equality.Semantic.DeepEqual(oldIngress.Status, newIngress.Status)
+}
+
+func (r *ingressReconciler) enqueue(obj any) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		r.log.Error(err, "error getting ingress key")
+		return
+	}
+	// A key already waiting is not added twice.
+	r.queue.AddAfter(key, r.debounce)
+}
+
+// namespaceHandler returns the event handler of the selected namespaces,
+// which queues the Ingresses of namespaces entering or leaving the selection
+// as listed by all.
+func (r *ingressReconciler) namespaceHandler(all networkinglisters.IngressLister) cache.ResourceEventHandler {
+	enqueueNamespace := func(obj any) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		namespace, ok := obj.(*corev1.Namespace)
+		if !ok {
+			return
+		}
+
+		ingresses, err := all.Ingresses(namespace.Name).List(labels.Everything())
+		if err != nil {
+			r.log.Error(err, "error listing ingresses", "namespace", namespace.Name)
+			return
+		}
+		for _, ingress := range ingresses {
+			r.enqueue(ingress)
+		}
+	}
+
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: enqueueNamespace,
+		// Label changes that keep a namespace selected change nothing.
+		DeleteFunc: enqueueNamespace,
+	}
+}
+
+// ingressClassHandler returns the event handler of IngressClasses, which
+// queues every Ingress when a class is added, changed or removed, as any of
+// them may change hands.
+func (r *ingressReconciler) ingressClassHandler() cache.ResourceEventHandler {
+	enqueueAll := func() {
+		ingresses, err := r.lister.List(labels.Everything())
+		if err != nil {
+			r.log.Error(err, "error listing ingresses")
+			return
+		}
+		for _, ingress := range ingresses {
+			r.enqueue(ingress)
+		}
+	}
+
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(any) { enqueueAll() },
+		UpdateFunc: func(oldObj, newObj any) {
+			oldClass, okOld := oldObj.(*networkingv1.IngressClass)
+			newClass, okNew := newObj.(*networkingv1.IngressClass)
+			if okOld && okNew && oldClass.ResourceVersion == newClass.ResourceVersion {
+				return
+			}
+			enqueueAll()
+		},
+		DeleteFunc: func(any) { enqueueAll() },
+	}
+}
+
+// revalidate queues our Ingresses to be rebuilt when a term starts, so that
+// the leader reports their problems: the events of the builds made before it
+// led, such as those of the initial sync, were dropped.
+func (r *ingressReconciler) revalidate(ctx context.Context) {
+	ingresses, err := r.lister.List(labels.Everything())
+	if err != nil {
+		r.log.Error(err, "error listing ingresses")
+		return
+	}
+	for _, ingress := range ingresses {
+		if ctx.Err() != nil {
+			return
+		}
+		if !routing.IsIngressOwned(ingress, r.classes) {
+			continue
+		}
+		key, err := cache.MetaNamespaceKeyFunc(ingress)
+		if err != nil {
+			r.log.Error(err, "error getting ingress key")
+			continue
+		}
+		r.mu.Lock()
+		r.rebuild[key] = struct{}{}
+		r.mu.Unlock()
+		r.queue.Add(key)
+	}
+}
+
+// mustRebuild reports whether key was queued to be rebuilt by revalidate,
+// and clears it.
+func (r *ingressReconciler) mustRebuild(key string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.rebuild[key]
+	delete(r.rebuild, key)
+	return ok
+}
+
+// Run reconciles queued Ingresses until stop is closed.
+func (r *ingressReconciler) Run(stop <-chan struct{}) {
+	go func() {
+		<-stop
+		r.queue.ShutDown()
+	}()
+
+	for r.processNextItem() {
+	}
+}
+
+func (r *ingressReconciler) processNextItem() bool {
+	key, shutdown := r.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer r.queue.Done(key)
+
+	if err := r.reconcile(key); err != nil {
+		r.log.Info("Error reconciling ingress, retrying", "ingress", key, "error", err)
+		metrics.ReconcileError()
+		r.queue.AddRateLimited(key)
+		return true
+	}
+	r.queue.Forget(key)
+	return true
+}
+
+// reconcile rebuilds the routes of the Ingress key, or removes them when the
+// Ingress is gone or no longer ours.
+func (r *ingressReconciler) reconcile(key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		r.log.Error(err, "error parsing ingress key", "ingress", key)
+		return nil
+	}
+
+	current := r.router.GetRoutes(key)
+
+	ingress, err := r.lister.Ingresses(namespace).Get(name)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("error getting ingress %s: %v", key, err)
+	}
+	rebuild := r.mustRebuild(key)
+	if err != nil || !routing.IsIngressOwned(ingress, r.classes) {
+		if current != nil {
+			r.log.Info("Removing routes of ingress", "ingress", key, "routes", len(current))
+			r.router.DeleteRoutes(key)
+		}
+		return nil
+	}
+
+	// Resyncs rebuild the routes only when a backend or Secret was missing.
+	if !rebuild && len(current) > 0 && current[0].UpToDate(ingress) {
+		return nil
+	}
+
+	start := time.Now()
+	defer func() { metrics.ObserveSync(false, time.Since(start)) }()
+
+	routes := r.router.RoutesFor(ingress)
+	if len(routes) == 0 {
+		r.log.Info("Ingress has no usable routes", "ingress", key)
+		if current != nil {
+			r.router.DeleteRoutes(key)
+		}
+		return nil
+	}
+
+	r.log.Info("Updating routes of ingress", "ingress", key, "routes", len(routes), "previous", len(current))
+	r.router.SetRoutes(key, routes)
+	return nil
+}
@@ -0,0 +1,225 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danCrespo/panacea-ingress-controller/routing"
+	"github.com/go-logr/logr"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	networkinglisters "k8s.io/client-go/listers/networking/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// fakeRouter records the routes the reconciler stores per Ingress.
+type fakeRouter struct {
+	routing.RoutingTable
+
+	mu     sync.Mutex
+	routes map[string][]*routing.Route
+	builds int
+}
+
+func newFakeRouter() *fakeRouter {
+	return &fakeRouter{routes: make(map[string][]*routing.Route)}
+}
+
+func (f *fakeRouter) RoutesFor(ingress *networkingv1.Ingress) []*routing.Route {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.builds++
+
+	var routes []*routing.Route
+	for _, rule := range ingress.Spec.Rules {
+		routes = append(routes, &routing.Route{Host: rule.Host, Path: "/", Namespace: ingress.Namespace, Ingress: ingress.Name})
+	}
+	return routes
+}
+
+func (f *fakeRouter) GetRoutes(key string) []*routing.Route {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.routes[key]
+}
+
+func (f *fakeRouter) SetRoutes(key string, routes []*routing.Route) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.routes[key] = routes
+}
+
+func (f *fakeRouter) DeleteRoutes(key string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.routes, key)
+}
+
+func (f *fakeRouter) buildCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.builds
+}
+
+func newTestIngress(name, class, host string) *networkingv1.Ingress {
+	return &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: &class,
+			Rules:            []networkingv1.IngressRule{{Host: host}},
+		},
+	}
+}
+
+// newTestClasses matches the Ingresses of the panacea IngressClass.
+func newTestClasses(t *testing.T) *routing.IngressClasses {
+	t.Helper()
+
+	const controller = "panacea.io/ingress-controller"
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	class := &networkingv1.IngressClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "panacea"},
+		Spec:       networkingv1.IngressClassSpec{Controller: controller},
+	}
+	if err := indexer.Add(class); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return routing.NewIngressClasses(networkinglisters.NewIngressClassLister(indexer), controller, "")
+}
+
+func newTestReconciler(t *testing.T, ingresses ...*networkingv1.Ingress) (*ingressReconciler, cache.Indexer, *fakeRouter) {
+	t.Helper()
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, ingress := range ingresses {
+		if err := indexer.Add(ingress); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	router := newFakeRouter()
+	r := newIngressReconciler(networkinglisters.NewIngressLister(indexer), router, newTestClasses(t), logr.Discard())
+	t.Cleanup(r.queue.ShutDown)
+	return r, indexer, router
+}
+
+func TestIngressReconcilerReconcile(t *testing.T) {
+	ours := newTestIngress("ours", "panacea", "app.example.com")
+	theirs := newTestIngress("theirs", "other", "other.example.com")
+	r, indexer, router := newTestReconciler(t, ours, theirs)
+
+	t.Run("adds routes of owned ingresses", func(t *testing.T) {
+		if err := r.reconcile("default/ours"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if routes := router.GetRoutes("default/ours"); len(routes) != 1 || routes[0].Host != "app.example.com" {
+			t.Errorf("Expected the route of app.example.com, got %v", routes)
+		}
+	})
+
+	t.Run("ignores ingresses of other classes", func(t *testing.T) {
+		if err := r.reconcile("default/theirs"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if routes := router.GetRoutes("default/theirs"); routes != nil {
+			t.Errorf("Expected no routes, got %v", routes)
+		}
+	})
+
+	t.Run("rebuilds updated ingresses", func(t *testing.T) {
+		updated := newTestIngress("ours", "panacea", "new.example.com")
+		if err := indexer.Update(updated); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := r.reconcile("default/ours"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if routes := router.GetRoutes("default/ours"); len(routes) != 1 || routes[0].Host != "new.example.com" {
+			t.Errorf("Expected the route of new.example.com, got %v", routes)
+		}
+	})
+
+	t.Run("removes routes of ingresses moved to another class", func(t *testing.T) {
+		if err := indexer.Update(newTestIngress("ours", "other", "new.example.com")); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := r.reconcile("default/ours"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if routes := router.GetRoutes("default/ours"); routes != nil {
+			t.Errorf("Expected no routes, got %v", routes)
+		}
+	})
+
+	t.Run("removes routes of deleted ingresses", func(t *testing.T) {
+		router.SetRoutes("default/gone", []*routing.Route{{Host: "gone.example.com"}})
+		if err := r.reconcile("default/gone"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if routes := router.GetRoutes("default/gone"); routes != nil {
+			t.Errorf("Expected no routes, got %v", routes)
+		}
+	})
+}
+
+func TestIngressReconcilerDebounce(t *testing.T) {
+	ingress := newTestIngress("ours", "panacea", "app.example.com")
+	r, _, router := newTestReconciler(t, ingress)
+	r.debounce = 50 * time.Millisecond
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		r.Run(stop)
+		close(done)
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	for range 10 {
+		r.OnUpdate(ingress, ingress)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for router.GetRoutes("default/ours") == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the ingress to be reconciled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(2 * r.debounce)
+
+	if builds := router.buildCount(); builds != 1 {
+		t.Errorf("Expected a burst of events to be reconciled once, got %d builds", builds)
+	}
+}
+
+func TestIngressReconcilerRevalidate(t *testing.T) {
+	ours := newTestIngress("ours", "panacea", "app.example.com")
+	theirs := newTestIngress("theirs", "other", "other.example.com")
+	r, _, router := newTestReconciler(t, ours, theirs)
+
+	// The term of the leader queues our Ingresses, whose routes the
+	// reconciler rebuilds even when they are up to date.
+	l := newTestLeader(t, fake.NewClientset(), "replica-a", false)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go l.Run(ctx, r.revalidate)
+
+	waitFor(t, "the ingresses to be queued", func() bool { return r.queue.Len() == 1 })
+	if builds := router.buildCount(); builds != 0 {
+		t.Errorf("Expected the routes to be built by the reconciler only, got %d builds", builds)
+	}
+
+	r.processNextItem()
+	if builds := router.buildCount(); builds != 1 {
+		t.Errorf("Expected the queued ingress to be rebuilt, got %d builds", builds)
+	}
+	if r.mustRebuild("default/ours") {
+		t.Errorf("Expected the rebuild to be done once")
+	}
+}
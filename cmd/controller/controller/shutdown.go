@@ -0,0 +1,27 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// drain stops the servers from accepting connections and waits for their
+// requests in flight until ctx is done, when the connections left are
+// closed.
+func drain(ctx context.Context, servers ...*http.Server) error {
+	errs := make([]error, len(servers))
+	var wg sync.WaitGroup
+	for i, srv := range servers {
+		wg.Go(func() {
+			if err := srv.Shutdown(ctx); err != nil {
+				_ = srv.Close()
+				errs[i] = fmt.Errorf("error shutting down server on %s: %v", srv.Addr, err)
+			}
+		})
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// startServer serves handler on a local port until the test ends.
+func startServer(t *testing.T, handler http.Handler) (*http.Server, string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	srv := &http.Server{Addr: listener.Addr().String(), Handler: handler}
+	go func() { _ = srv.Serve(listener) }()
+	t.Cleanup(func() { _ = srv.Close() })
+	return srv, "http://" + listener.Addr().String()
+}
+
+func TestDrain(t *testing.T) {
+	t.Run("waits for requests in flight", func(t *testing.T) {
+		started := make(chan struct{})
+		srv, url := startServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			time.Sleep(200 * time.Millisecond)
+			_, _ = w.Write([]byte("done"))
+		}))
+
+		result := make(chan string, 1)
+		go func() {
+			resp, err := http.Get(url)
+			if err != nil {
+				result <- err.Error()
+				return
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			result <- string(body)
+		}()
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := drain(ctx, srv); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if body := <-result; body != "done" {
+			t.Errorf("Expected the request in flight to complete, got %q", body)
+		}
+
+		if _, err := http.Get(url); err == nil {
+			t.Errorf("Expected new connections to be refused after draining")
+		}
+	})
+
+	t.Run("closes connections after the timeout", func(t *testing.T) {
+		started := make(chan struct{})
+		release := make(chan struct{})
+		defer close(release)
+		srv, url := startServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+		}))
+
+		failed := make(chan error, 1)
+		go func() {
+			resp, err := http.Get(url)
+			if err == nil {
+				resp.Body.Close()
+			}
+			failed <- err
+		}()
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		if err := drain(ctx, srv); err == nil {
+			t.Errorf("Expected an error draining a stuck request")
+		}
+		select {
+		case err := <-failed:
+			if err == nil {
+				t.Errorf("Expected the stuck request to fail")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for the stuck connection to be closed")
+		}
+	})
+}
+
+func TestHealthReadyOnShutdown(t *testing.T) {
+	h := &health{}
+	h.synced.Store(true)
+	handler := newAdminHandler(newTestLeader(t, nil, "replica-a", false), h)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected ready, got status %d", rec.Code)
+	}
+
+	h.shuttingDown.Store(true)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected not ready while shutting down, got status %d", rec.Code)
+	}
+}
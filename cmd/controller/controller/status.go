@@ -0,0 +1,306 @@
+package controller
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danCrespo/panacea-ingress-controller/routing"
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	networkinglisters "k8s.io/client-go/listers/networking/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// statusFieldManager is the field manager of the status the controller
+// writes, which tells the addresses it published apart from the addresses of
+// other controllers once the published ones changed.
+const statusFieldManager = "panacea-ingress-controller"
+
+// statusAddresses are the addresses the controller is reachable at, given by
+// the --publish-status-address flag or read from the --publish-service
+// Service.
+type statusAddresses struct {
+	static    []networkingv1.IngressLoadBalancerIngress
+	services  corelisters.ServiceLister
+	namespace string
+	name      string
+}
+
+// parseStatusAddresses parses the comma-separated --publish-status-address
+// flag. Values that are not IP addresses are hostnames.
+func parseStatusAddresses(value string) []networkingv1.IngressLoadBalancerIngress {
+	var addresses []networkingv1.IngressLoadBalancerIngress
+	for address := range strings.SplitSeq(value, ",") {
+		address = strings.TrimSpace(address)
+		switch {
+		case address == "":
+		case net.ParseIP(address) != nil:
+			addresses = append(addresses, networkingv1.IngressLoadBalancerIngress{IP: address})
+		default:
+			addresses = append(addresses, networkingv1.IngressLoadBalancerIngress{Hostname: address})
+		}
+	}
+	return sortStatusAddresses(addresses)
+}
+
+// get returns the addresses to publish. Those of a Service of type
+// LoadBalancer are the ones of its load balancer and its external IPs, which
+// are none until the load balancer is provisioned. Other Services publish
+// their external IPs or else their cluster IP.
+func (a *statusAddresses) get() ([]networkingv1.IngressLoadBalancerIngress, error) {
+	if a.services == nil {
+		return a.static, nil
+	}
+
+	svc, err := a.services.Services(a.namespace).Get(a.name)
+	if err != nil {
+		return nil, fmt.Errorf("error getting publish service %s/%s: %v", a.namespace, a.name, err)
+	}
+
+	var addresses []networkingv1.IngressLoadBalancerIngress
+	for _, lb := range svc.Status.LoadBalancer.Ingress {
+		addresses = append(addresses, networkingv1.IngressLoadBalancerIngress{IP: lb.IP, Hostname: lb.Hostname})
+	}
+	for _, ip := range svc.Spec.ExternalIPs {
+		addresses = append(addresses, networkingv1.IngressLoadBalancerIngress{IP: ip})
+	}
+	if len(addresses) == 0 && svc.Spec.Type != corev1.ServiceTypeLoadBalancer &&
+		svc.Spec.ClusterIP != "" && svc.Spec.ClusterIP != corev1.ClusterIPNone {
+		addresses = append(addresses, networkingv1.IngressLoadBalancerIngress{IP: svc.Spec.ClusterIP})
+	}
+	return sortStatusAddresses(addresses), nil
+}
+
+func sortStatusAddresses(addresses []networkingv1.IngressLoadBalancerIngress) []networkingv1.IngressLoadBalancerIngress {
+	addresses = slices.Clone(addresses)
+	slices.SortFunc(addresses, func(a, b networkingv1.IngressLoadBalancerIngress) int {
+		return cmp.Or(cmp.Compare(a.IP, b.IP), cmp.Compare(a.Hostname, b.Hostname))
+	})
+	return slices.CompactFunc(addresses, func(a, b networkingv1.IngressLoadBalancerIngress) bool {
+		return a.IP == b.IP && a.Hostname == b.Hostname
+	})
+}
+
+// statusUpdater writes the addresses of the controller to status.loadBalancer
+// of the Ingresses it owns, and clears them from the Ingresses leaving its
+// classes. Only the leader runs it; the Ingresses seen while not leading are
+// all queued again when it starts leading.
+type statusUpdater struct {
+	client    kubernetes.Interface
+	lister    networkinglisters.IngressLister
+	classes   routing.IngressClassMatcher
+	addresses *statusAddresses
+	log       logr.Logger
+
+	mu    sync.Mutex
+	queue workqueue.TypedRateLimitingInterface[string] // Nil while not leading
+}
+
+var _ cache.ResourceEventHandler = (*statusUpdater)(nil)
+
+func newStatusUpdater(client kubernetes.Interface, lister networkinglisters.IngressLister, classes routing.IngressClassMatcher, addresses *statusAddresses, log logr.Logger) *statusUpdater {
+	return &statusUpdater{
+		client:    client,
+		lister:    lister,
+		classes:   classes,
+		addresses: addresses,
+		log:       log.WithValues("component", "status"),
+	}
+}
+
+// OnAdd implements cache.ResourceEventHandler.
+func (s *statusUpdater) OnAdd(obj any, _ bool) {
+	s.enqueue(obj)
+}
+
+// OnUpdate implements cache.ResourceEventHandler.
+func (s *statusUpdater) OnUpdate(_, newObj any) {
+	s.enqueue(newObj)
+}
+
+// OnDelete implements cache.ResourceEventHandler. Deleted Ingresses have no
+// status to update.
+func (s *statusUpdater) OnDelete(any) {}
+
+func (s *statusUpdater) enqueue(obj any) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		s.log.Error(err, "error getting ingress key")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.queue != nil {
+		s.queue.Add(key)
+	}
+}
+
+// enqueueAll queues every Ingress, as when the published addresses change.
+func (s *statusUpdater) enqueueAll() {
+	ingresses, err := s.lister.List(labels.Everything())
+	if err != nil {
+		s.log.Error(err, "error listing ingresses")
+		return
+	}
+	for _, ingress := range ingresses {
+		s.enqueue(ingress)
+	}
+}
+
+// serviceHandler returns the event handler of the --publish-service Service.
+func (s *statusUpdater) serviceHandler() cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(any) { s.enqueueAll() },
+		UpdateFunc: func(any, any) { s.enqueueAll() },
+		DeleteFunc: func(any) { s.enqueueAll() },
+	}
+}
+
+// Run updates the status of the queued Ingresses until ctx is done.
+func (s *statusUpdater) Run(ctx context.Context) {
+	queue := workqueue.NewTypedRateLimitingQueueWithConfig(
+		workqueue.DefaultTypedControllerRateLimiter[string](),
+		workqueue.TypedRateLimitingQueueConfig[string]{Name: "ingress-status"},
+	)
+
+	s.mu.Lock()
+	s.queue = queue
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		// The next term may have started already.
+		if s.queue == queue {
+			s.queue = nil
+		}
+		s.mu.Unlock()
+	}()
+
+	go func() {
+		<-ctx.Done()
+		queue.ShutDown()
+	}()
+
+	s.log.Info("Publishing ingress status")
+	s.enqueueAll()
+	for s.processNextItem(ctx, queue) {
+	}
+}
+
+func (s *statusUpdater) processNextItem(ctx context.Context, queue workqueue.TypedRateLimitingInterface[string]) bool {
+	key, shutdown := queue.Get()
+	if shutdown {
+		return false
+	}
+	defer queue.Done(key)
+
+	if err := s.update(ctx, key); err != nil {
+		s.log.Info("Error updating ingress status, retrying", "ingress", key, "error", err)
+		queue.AddRateLimited(key)
+		return true
+	}
+	queue.Forget(key)
+	return true
+}
+
+// update publishes the addresses to the Ingress key if it is ours. The
+// status of other Ingresses is cleared only when we wrote it or it holds our
+// addresses, so that the status written by other controllers is left alone.
+func (s *statusUpdater) update(ctx context.Context, key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		s.log.Error(err, "error parsing ingress key", "ingress", key)
+		return nil
+	}
+
+	ingress, err := s.lister.Ingresses(namespace).Get(name)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error getting ingress %s: %v", key, err)
+	}
+
+	addresses, err := s.addresses.get()
+	if err != nil {
+		return err
+	}
+
+	current := sortStatusAddresses(ingress.Status.LoadBalancer.Ingress)
+	desired := addresses
+	if !s.classes.Matches(ingress) {
+		if len(current) == 0 || !ownsStatus(ingress) && !equality.Semantic.DeepEqual(current, addresses) {
+			return nil
+		}
+		desired = nil
+	}
+	if equality.Semantic.DeepEqual(current, desired) {
+		return nil
+	}
+
+	updated := ingress.DeepCopy()
+	updated.Status.LoadBalancer.Ingress = desired
+	if _, err := s.client.NetworkingV1().Ingresses(namespace).UpdateStatus(ctx, updated, metav1.UpdateOptions{FieldManager: statusFieldManager}); err != nil {
+		return fmt.Errorf("error updating status of ingress %s: %v", key, err)
+	}
+
+	s.log.Info("Updated ingress status", "ingress", key, "addresses", len(desired))
+	return nil
+}
+
+// ownsStatus reports whether the controller wrote the addresses in the
+// status of ingress, that is its field manager still owns them.
+func ownsStatus(ingress *networkingv1.Ingress) bool {
+	for _, entry := range ingress.ManagedFields {
+		if entry.Manager != statusFieldManager || entry.Subresource != "status" || entry.FieldsV1 == nil {
+			continue
+		}
+		var fields struct {
+			Status struct {
+				LoadBalancer struct {
+					Ingress *json.RawMessage `json:"f:ingress"`
+				} `json:"f:loadBalancer"`
+			} `json:"f:status"`
+		}
+		if err := json.Unmarshal(entry.FieldsV1.Raw, &fields); err == nil && fields.Status.LoadBalancer.Ingress != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePublishService parses the --publish-service flag, a Service given as
+// namespace/name.
+func parsePublishService(value string) (string, string, error) {
+	namespace, name, ok := strings.Cut(value, "/")
+	if !ok || namespace == "" || name == "" || strings.Contains(name, "/") {
+		return "", "", fmt.Errorf("error parsing service %q: expected namespace/name", value)
+	}
+	return namespace, name, nil
+}
+
+// newPublishServiceFactory returns an informer factory watching only the
+// --publish-service Service.
+func newPublishServiceFactory(clientset kubernetes.Interface, namespace, name string, resync time.Duration) informers.SharedInformerFactory {
+	return informers.NewSharedInformerFactoryWithOptions(clientset, resync, informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		}))
+}
@@ -0,0 +1,227 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	networkinglisters "k8s.io/client-go/listers/networking/v1"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestParseStatusAddresses(t *testing.T) {
+	addresses := parseStatusAddresses(" lb.example.com, 10.0.0.2,10.0.0.1,,10.0.0.2 ")
+	expected := []networkingv1.IngressLoadBalancerIngress{
+		{Hostname: "lb.example.com"},
+		{IP: "10.0.0.1"},
+		{IP: "10.0.0.2"},
+	}
+	if !equality.Semantic.DeepEqual(addresses, expected) {
+		t.Errorf("Expected %v, got %v", expected, addresses)
+	}
+}
+
+func TestParsePublishService(t *testing.T) {
+	namespace, name, err := parsePublishService("ingress/panacea")
+	if err != nil || namespace != "ingress" || name != "panacea" {
+		t.Errorf("Expected ingress/panacea, got %s/%s (%v)", namespace, name, err)
+	}
+	for _, value := range []string{"panacea", "/panacea", "ingress/", "ingress/panacea/extra"} {
+		if _, _, err := parsePublishService(value); err == nil {
+			t.Errorf("Expected an error parsing %q", value)
+		}
+	}
+}
+
+func TestStatusAddressesFromService(t *testing.T) {
+	tests := []struct {
+		name     string
+		svc      corev1.Service
+		expected []networkingv1.IngressLoadBalancerIngress
+	}{
+		{
+			name: "load balancer",
+			svc: corev1.Service{
+				Spec: corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer, ClusterIP: "10.96.0.10"},
+				Status: corev1.ServiceStatus{LoadBalancer: corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{
+					{Hostname: "lb.example.com"}, {IP: "203.0.113.10"},
+				}}},
+			},
+			expected: []networkingv1.IngressLoadBalancerIngress{{Hostname: "lb.example.com"}, {IP: "203.0.113.10"}},
+		},
+		{
+			name:     "pending load balancer",
+			svc:      corev1.Service{Spec: corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer, ClusterIP: "10.96.0.10"}},
+			expected: nil,
+		},
+		{
+			name:     "external IPs",
+			svc:      corev1.Service{Spec: corev1.ServiceSpec{Type: corev1.ServiceTypeClusterIP, ClusterIP: "10.96.0.10", ExternalIPs: []string{"198.51.100.7"}}},
+			expected: []networkingv1.IngressLoadBalancerIngress{{IP: "198.51.100.7"}},
+		},
+		{
+			name:     "cluster IP",
+			svc:      corev1.Service{Spec: corev1.ServiceSpec{Type: corev1.ServiceTypeClusterIP, ClusterIP: "10.96.0.10"}},
+			expected: []networkingv1.IngressLoadBalancerIngress{{IP: "10.96.0.10"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := tt.svc
+			svc.ObjectMeta = metav1.ObjectMeta{Namespace: "ingress", Name: "panacea"}
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			if err := indexer.Add(&svc); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			addresses := &statusAddresses{services: corelisters.NewServiceLister(indexer), namespace: "ingress", name: "panacea"}
+			got, err := addresses.get()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !equality.Semantic.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestStatusUpdaterUpdate(t *testing.T) {
+	published := []networkingv1.IngressLoadBalancerIngress{{IP: "203.0.113.10"}}
+	withStatus := func(ingress *networkingv1.Ingress, addresses ...networkingv1.IngressLoadBalancerIngress) *networkingv1.Ingress {
+		ingress.Status.LoadBalancer.Ingress = addresses
+		return ingress
+	}
+	managedBy := func(ingress *networkingv1.Ingress, manager string) *networkingv1.Ingress {
+		ingress.ManagedFields = []metav1.ManagedFieldsEntry{{
+			Manager:     manager,
+			Operation:   metav1.ManagedFieldsOperationUpdate,
+			Subresource: "status",
+			FieldsType:  "FieldsV1",
+			FieldsV1:    &metav1.FieldsV1{Raw: []byte(`{"f:status":{"f:loadBalancer":{"f:ingress":{}}}}`)},
+		}}
+		return ingress
+	}
+
+	tests := []struct {
+		name     string
+		ingress  *networkingv1.Ingress
+		expected []networkingv1.IngressLoadBalancerIngress
+		updates  int
+	}{
+		{
+			name:     "publishes to owned ingresses",
+			ingress:  newTestIngress("ours", "panacea", "app.example.com"),
+			expected: published,
+			updates:  1,
+		},
+		{
+			name:     "replaces stale addresses",
+			ingress:  withStatus(newTestIngress("ours", "panacea", "app.example.com"), networkingv1.IngressLoadBalancerIngress{IP: "192.0.2.1"}),
+			expected: published,
+			updates:  1,
+		},
+		{
+			name:     "skips up to date ingresses",
+			ingress:  withStatus(newTestIngress("ours", "panacea", "app.example.com"), published...),
+			expected: published,
+		},
+		{
+			name:     "clears ingresses leaving the class",
+			ingress:  withStatus(newTestIngress("theirs", "other", "app.example.com"), published...),
+			expected: nil,
+			updates:  1,
+		},
+		{
+			// The addresses of the publish Service changed since we wrote them.
+			name:     "clears ingresses leaving the class with former addresses",
+			ingress:  managedBy(withStatus(newTestIngress("theirs", "other", "app.example.com"), networkingv1.IngressLoadBalancerIngress{IP: "192.0.2.1"}), statusFieldManager),
+			expected: nil,
+			updates:  1,
+		},
+		{
+			name:     "leaves the status of other controllers alone",
+			ingress:  withStatus(newTestIngress("theirs", "other", "app.example.com"), networkingv1.IngressLoadBalancerIngress{IP: "192.0.2.1"}),
+			expected: []networkingv1.IngressLoadBalancerIngress{{IP: "192.0.2.1"}},
+		},
+		{
+			name:     "leaves the status written by other controllers alone",
+			ingress:  managedBy(withStatus(newTestIngress("theirs", "other", "app.example.com"), networkingv1.IngressLoadBalancerIngress{IP: "192.0.2.1"}), "other-controller"),
+			expected: []networkingv1.IngressLoadBalancerIngress{{IP: "192.0.2.1"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewClientset(tt.ingress)
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+			if err := indexer.Add(tt.ingress); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			s := newStatusUpdater(client, networkinglisters.NewIngressLister(indexer), newTestClasses(t),
+				&statusAddresses{static: published}, logr.Discard())
+			key := tt.ingress.Namespace + "/" + tt.ingress.Name
+			if err := s.update(context.Background(), key); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			updates := 0
+			for _, action := range client.Actions() {
+				if action.GetVerb() == "update" && action.GetSubresource() == "status" {
+					updates++
+					if manager := action.(k8stesting.UpdateActionImpl).UpdateOptions.FieldManager; manager != statusFieldManager {
+						t.Errorf("Expected the field manager %s, got %q", statusFieldManager, manager)
+					}
+				}
+			}
+			if updates != tt.updates {
+				t.Errorf("Expected %d status updates, got %d", tt.updates, updates)
+			}
+
+			ingress, err := client.NetworkingV1().Ingresses(tt.ingress.Namespace).Get(context.Background(), tt.ingress.Name, metav1.GetOptions{})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := ingress.Status.LoadBalancer.Ingress; !equality.Semantic.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected status %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestStatusUpdated(t *testing.T) {
+	old := newTestIngress("ours", "panacea", "app.example.com")
+	old.ResourceVersion = "1"
+
+	status := old.DeepCopy()
+	status.ResourceVersion = "2"
+	status.Status.LoadBalancer.Ingress = []networkingv1.IngressLoadBalancerIngress{{IP: "203.0.113.10"}}
+	if !statusUpdated(old, status) {
+		t.Errorf("Expected a status update")
+	}
+
+	spec := status.DeepCopy()
+	spec.Generation++
+	if statusUpdated(old, spec) {
+		t.Errorf("Expected a spec update not to be a status update")
+	}
+
+	annotated := status.DeepCopy()
+	annotated.Annotations = map[string]string{"panacea.io/rewrite-target": "/"}
+	if statusUpdated(old, annotated) {
+		t.Errorf("Expected an annotation update not to be a status update")
+	}
+
+	if statusUpdated(old, old) {
+		t.Errorf("Expected a resync not to be a status update")
+	}
+}
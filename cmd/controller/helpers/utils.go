@@ -1,19 +1,17 @@
 package helpers
 
 import (
-	"context"
 	"time"
 
 	"github.com/danCrespo/panacea-ingress-controller/config"
 	"github.com/danCrespo/panacea-ingress-controller/kubeutils"
 	"github.com/danCrespo/panacea-ingress-controller/logger"
+	"github.com/danCrespo/panacea-ingress-controller/metrics"
 	"github.com/danCrespo/panacea-ingress-controller/routing"
 	"github.com/go-logr/logr"
-	networkingv1 "k8s.io/api/networking/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/informers"
-	"k8s.io/client-go/kubernetes"
+	networkinglisters "k8s.io/client-go/listers/networking/v1"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
@@ -80,27 +78,23 @@ func (s *sync) CacheSync(factory informers.SharedInformerFactory, stop <-chan st
 	return true
 }
 
-func (s *sync) SyncIngresses(clientSet *kubernetes.Clientset, router routing.RoutingTable, ingressClass string) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
+// SyncIngresses rebuilds the whole routing table from the Ingresses in the
+// informer cache.
+func (s *sync) SyncIngresses(lister networkinglisters.IngressLister, router routing.RoutingTable, classes routing.IngressClassMatcher) {
 	l.Info("Syncing ingresses")
-	lists, err := clientSet.NetworkingV1().Ingresses("").List(ctx, metav1.ListOptions{
-		LabelSelector: labels.Everything().String(),
-	})
+	ings, err := lister.List(labels.Everything())
 	if err != nil {
 		l.Error(err, "error listing ingresses")
 		return
 	}
 
-	ings := make([]*networkingv1.Ingress, 0, len(lists.Items))
-	for i := range lists.Items {
-		ing := &lists.Items[i]
+	for _, ing := range ings {
 		l.Info("Found ingress", "name", ing.Name, "namespace", ing.Namespace)
-		ings = append(ings, ing)
 	}
 
-	router.UpdateFromIngresses(ings, ingressClass)
+	start := time.Now()
+	router.UpdateFromIngresses(ings, classes)
+	metrics.ObserveSync(true, time.Since(start))
 	l.Info("Ingresses synced", "total", len(ings))
 }
 
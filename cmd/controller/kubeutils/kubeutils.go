@@ -31,6 +31,7 @@ type kubeutils struct {
 	config     config.Config
 	clientSet  *kubernetes.Clientset
 	kubeconfig *rest.Config
+	err        error // Why there is no kubeconfig
 }
 
 var (
@@ -38,17 +39,20 @@ var (
 )
 
 func NewKubeutils(cfg config.Config) IKubeutils {
+	k := &kubeutils{config: cfg}
 
-	kc := getConfig(cfg.Kubeconfig)
-	clientSet, err := kubernetes.NewForConfig(kc)
+	kc, err := getConfig(cfg.Kubeconfig)
 	if err != nil {
-		panic(err.Error())
+		k.err = err
+		return k
 	}
-	k := &kubeutils{
-		config:     cfg,
-		clientSet:  clientSet,
-		kubeconfig: kc,
+	clientSet, err := kubernetes.NewForConfig(kc)
+	if err != nil {
+		k.err = fmt.Errorf("error creating clientset: %v", err)
+		return k
 	}
+	k.clientSet = clientSet
+	k.kubeconfig = kc
 
 	return k
 }
@@ -60,12 +64,20 @@ func (k *kubeutils) SetLogger(logger logr.Logger) {
 func (k *kubeutils) GetClusterConfig() (*rest.Config, error) {
 	var err error
 	if k.kubeconfig == nil {
-		err = fmt.Errorf("no kubeconfig available")
+		err = fmt.Errorf("no kubeconfig available: %v", k.err)
 	}
 
 	return k.kubeconfig, err
 }
 
+// client returns the clientset, or why there is none.
+func (k *kubeutils) client() (*kubernetes.Clientset, error) {
+	if k.clientSet == nil {
+		return nil, fmt.Errorf("no kubernetes client available: %v", k.err)
+	}
+	return k.clientSet, nil
+}
+
 func (k *kubeutils) GetClusterName() (string, error) {
 	cfg, err := k.GetClusterConfig()
 	if err != nil {
@@ -78,7 +90,12 @@ func (k *kubeutils) GetClusterName() (string, error) {
 func (k *kubeutils) GetClusterDomain() (string, error) {
 	ctx := context.Background()
 
-	cmi := k.clientSet.CoreV1().ConfigMaps("kube-system")
+	clientSet, err := k.client()
+	if err != nil {
+		return "", err
+	}
+
+	cmi := clientSet.CoreV1().ConfigMaps("kube-system")
 	if cmi == nil {
 		return "", fmt.Errorf("error getting cluster-info configmap: %v", "kube-system")
 
@@ -133,7 +150,12 @@ func (k *kubeutils) GetNamespace() (string, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	pods, err := k.clientSet.CoreV1().Pods("").List(ctx, metav1.ListOptions{
+	clientSet, err := k.client()
+	if err != nil {
+		return "", err
+	}
+
+	pods, err := clientSet.CoreV1().Pods("").List(ctx, metav1.ListOptions{
 		LabelSelector: labels.Everything().String(),
 	})
 	if err != nil {
@@ -147,73 +169,79 @@ func (k *kubeutils) GetNamespace() (string, error) {
 }
 
 func (k *kubeutils) GetResource(namespace, name, kind string) (any, error) {
-	ctx := context.Background()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
 	l.Info("Getting resource", "kind", kind, "namespace", namespace, "name", name)
 
+	clientSet, err := k.client()
+	if err != nil {
+		return nil, err
+	}
+
 	switch strings.ToLower(kind) {
 	case "pod", "pods":
-		pod, err := k.clientSet.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		pod, err := clientSet.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
 		if err != nil {
 			return nil, fmt.Errorf("error getting pod %s/%s: %v", namespace, name, err)
 		}
 		return pod, nil
 	case "service", "services":
-		svc, err := k.clientSet.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+		svc, err := clientSet.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
 		if err != nil {
 			return nil, fmt.Errorf("error getting service %s/%s: %v", namespace, name, err)
 		}
 		return svc, nil
 	case "deployment", "deployments":
-		deploy, err := k.clientSet.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		deploy, err := clientSet.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
 		if err != nil {
 			return nil, fmt.Errorf("error getting deployment %s/%s: %v", namespace, name, err)
 		}
 		return deploy, nil
 	case "ingress", "ingresses":
-		ingress, err := k.clientSet.NetworkingV1().Ingresses(namespace).Get(ctx, name, metav1.GetOptions{})
+		ingress, err := clientSet.NetworkingV1().Ingresses(namespace).Get(ctx, name, metav1.GetOptions{})
 		if err != nil {
 			return nil, fmt.Errorf("error getting ingress %s/%s: %v", namespace, name, err)
 		}
 		return ingress, nil
 
 	case "configmap", "configmaps":
-		cm, err := k.clientSet.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
+		cm, err := clientSet.CoreV1().ConfigMaps(namespace).Get(ctx, name, metav1.GetOptions{})
 		if err != nil {
 			return nil, fmt.Errorf("error getting configmap %s/%s: %v", namespace, name, err)
 		}
 		return cm, nil
 
 	case "secret", "secrets":
-		secret, err := k.clientSet.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+		secret, err := clientSet.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
 		if err != nil {
 			return nil, fmt.Errorf("error getting secret %s/%s: %v", namespace, name, err)
 		}
 		return secret, nil
 
 	case "statefulset", "statefulsets":
-		ss, err := k.clientSet.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		ss, err := clientSet.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
 		if err != nil {
 			return nil, fmt.Errorf("error getting statefulset %s/%s: %v", namespace, name, err)
 		}
 		return ss, nil
 
 	case "daemonset", "daemonsets":
-		ds, err := k.clientSet.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		ds, err := clientSet.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
 		if err != nil {
 			return nil, fmt.Errorf("error getting daemonset %s/%s: %v", namespace, name, err)
 		}
 		return ds, nil
 
 	case "job", "jobs":
-		job, err := k.clientSet.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+		job, err := clientSet.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
 		if err != nil {
 			return nil, fmt.Errorf("error getting job %s/%s: %v", namespace, name, err)
 		}
 		return job, nil
 
 	case "cronjob", "cronjobs":
-		cronjob, err := k.clientSet.BatchV1().CronJobs(namespace).Get(ctx, name, metav1.GetOptions{})
+		cronjob, err := clientSet.BatchV1().CronJobs(namespace).Get(ctx, name, metav1.GetOptions{})
 		if err != nil {
 			return nil, fmt.Errorf("error getting cronjob %s/%s: %v", namespace, name, err)
 		}
@@ -226,7 +254,12 @@ func (k *kubeutils) GetResource(namespace, name, kind string) (any, error) {
 func (k *kubeutils) GetServicePortByName(namespace string, name string, portName string) (int32, error) {
 	ctx := context.Background()
 
-	svc, err := k.clientSet.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
+	clientSet, err := k.client()
+	if err != nil {
+		return 0, err
+	}
+
+	svc, err := clientSet.CoreV1().Services(namespace).Get(ctx, name, metav1.GetOptions{})
 	if err != nil {
 		return 0, fmt.Errorf("error getting service %s/%s: %v", namespace, name, err)
 	}
@@ -240,25 +273,25 @@ func (k *kubeutils) GetServicePortByName(namespace string, name string, portName
 	return 0, fmt.Errorf("port name %s not found in service %s/%s", portName, namespace, name)
 }
 
-func getConfig(kc string) *rest.Config {
+func getConfig(kc string) (*rest.Config, error) {
 	cfg, err := rest.InClusterConfig()
 	if err != nil {
 		if kc != "" {
 			cfg, err = clientcmd.BuildConfigFromFlags("", kc)
 			if err != nil {
-				panic(err.Error())
+				return nil, fmt.Errorf("error loading kubeconfig %s: %v", kc, err)
 			}
-			return cfg
+			return cfg, nil
 		}
 		if home, err := os.UserHomeDir(); err == nil {
 			kubeconfig := home + "/.kube/config"
 			cfg, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
 			if err != nil {
-				panic(err.Error())
+				return nil, fmt.Errorf("error loading kubeconfig %s: %v", kubeconfig, err)
 			}
-			return cfg
+			return cfg, nil
 		}
-		panic("no kubeconfig available")
+		return nil, fmt.Errorf("error getting in-cluster config: %v", err)
 	}
-	return cfg
+	return cfg, nil
 }
@@ -1,6 +1,9 @@
 package kubeutils
 
-import "testing"
+import (
+	"errors"
+	"testing"
+)
 
 func TestKubernetesUtilityFunction(t *testing.T) {
     t.Run("hello world test", func(t *testing.T) {
@@ -8,4 +11,20 @@ func TestKubernetesUtilityFunction(t *testing.T) {
             t.Errorf("Expected 1 + 1 to equal 2")
         }
     })
-}
\ No newline at end of file
+}
+func TestKubeutilsWithoutClient(t *testing.T) {
+	k := &kubeutils{err: errors.New("error loading kubeconfig")}
+
+	if _, err := k.GetClusterDomain(); err == nil {
+		t.Errorf("Expected GetClusterDomain to fail without a client")
+	}
+	if _, err := k.GetNamespace(); err == nil {
+		t.Errorf("Expected GetNamespace to fail without a client")
+	}
+	if _, err := k.GetResource("default", "app-tls", "secret"); err == nil {
+		t.Errorf("Expected GetResource to fail without a client")
+	}
+	if _, err := k.GetServicePortByName("default", "app", "http"); err == nil {
+		t.Errorf("Expected GetServicePortByName to fail without a client")
+	}
+}
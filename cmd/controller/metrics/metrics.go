@@ -0,0 +1,180 @@
+// Package metrics holds the Prometheus metrics of the proxied traffic and of
+// the controller itself.
+//
+// The labels of the traffic metrics come from the route a request matched,
+// never from the request itself: the host and path labels are those of the
+// Ingress rule, so that arbitrary Host headers and paths cannot create new
+// series. Requests no route matched have empty route labels.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "panacea"
+
+// Registry holds the metrics of the controller, apart from the default
+// Prometheus registry other libraries register to.
+var Registry = prometheus.NewRegistry()
+
+// routeLabels identify the route a request matched.
+var routeLabels = []string{"namespace", "ingress", "host", "path"}
+
+var (
+	requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "requests_total",
+		Help:      "Requests served, by route and status class.",
+	}, append(routeLabels, "status"))
+
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "request_duration_seconds",
+		Help:      "Time to serve a request, by route and status class.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, append(routeLabels, "status"))
+
+	requestSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "request_size_bytes",
+		Help:      "Size of the request bodies, by route.",
+		Buckets:   prometheus.ExponentialBuckets(64, 4, 10),
+	}, routeLabels)
+
+	responseSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "response_size_bytes",
+		Help:      "Size of the response bodies, by route.",
+		Buckets:   prometheus.ExponentialBuckets(64, 4, 10),
+	}, routeLabels)
+
+	upstreamErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_errors_total",
+		Help:      "Attempts to reach an upstream that failed without a response, by route and reason.",
+	}, append(routeLabels, "reason"))
+
+	syncDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "sync_duration_seconds",
+		Help:      "Time to build the routes of every Ingress (full) or of a single one (ingress).",
+		Buckets:   prometheus.ExponentialBuckets(.001, 4, 8),
+	}, []string{"scope"})
+
+	routes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "routes",
+		Help:      "Routes in the routing table.",
+	})
+
+	reconcileErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reconcile_errors_total",
+		Help:      "Ingress reconciliations that failed and were retried.",
+	})
+
+	informerEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "informer_events_total",
+		Help:      "Events received from the informers, by resource and event.",
+	}, []string{"resource", "event"})
+
+	lastReload = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "config_last_reload_timestamp_seconds",
+		Help:      "Time the routing table last changed, in seconds since the epoch.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		requests,
+		requestDuration,
+		requestSize,
+		responseSize,
+		upstreamErrors,
+		syncDuration,
+		routes,
+		reconcileErrors,
+		informerEvents,
+		lastReload,
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// Route identifies the route a request matched. The zero value stands for
+// requests no route matched.
+type Route struct {
+	Namespace string
+	Ingress   string
+	Host      string
+	Path      string
+}
+
+func (r Route) labels(extra ...string) []string {
+	return append([]string{r.Namespace, r.Ingress, r.Host, r.Path}, extra...)
+}
+
+// StatusClass returns the class of an HTTP status code, such as "2xx".
+func StatusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// ObserveRequest records a request served by route. Negative sizes are
+// unknown and not recorded.
+func ObserveRequest(route Route, status int, requestBytes, responseBytes int64, duration time.Duration) {
+	class := StatusClass(status)
+	requests.WithLabelValues(route.labels(class)...).Inc()
+	requestDuration.WithLabelValues(route.labels(class)...).Observe(duration.Seconds())
+	if requestBytes >= 0 {
+		requestSize.WithLabelValues(route.labels()...).Observe(float64(requestBytes))
+	}
+	if responseBytes >= 0 {
+		responseSize.WithLabelValues(route.labels()...).Observe(float64(responseBytes))
+	}
+}
+
+// UpstreamError records an attempt of route that failed for reason.
+func UpstreamError(route Route, reason string) {
+	upstreamErrors.WithLabelValues(route.labels(reason)...).Inc()
+}
+
+// ObserveSync records the time to build routes, of every Ingress when full.
+func ObserveSync(full bool, duration time.Duration) {
+	scope := "ingress"
+	if full {
+		scope = "full"
+	}
+	syncDuration.WithLabelValues(scope).Observe(duration.Seconds())
+}
+
+// RoutingTableChanged records the number of routes of a new routing table.
+func RoutingTableChanged(count int) {
+	routes.Set(float64(count))
+	lastReload.SetToCurrentTime()
+}
+
+// ReconcileError records a failed reconciliation.
+func ReconcileError() {
+	reconcileErrors.Inc()
+}
+
+// InformerEvent records an event of the informer of resource.
+func InformerEvent(resource, event string) {
+	informerEvents.WithLabelValues(resource, event).Inc()
+}
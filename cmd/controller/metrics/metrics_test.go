@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusClass(t *testing.T) {
+	tests := map[int]string{
+		101: "1xx",
+		200: "2xx",
+		204: "2xx",
+		301: "3xx",
+		404: "4xx",
+		503: "5xx",
+		0:   "unknown",
+		999: "unknown",
+	}
+	for status, expected := range tests {
+		if got := StatusClass(status); got != expected {
+			t.Errorf("Expected the class of %d to be %s, got %s", status, expected, got)
+		}
+	}
+}
+
+func scrape(t *testing.T) string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return string(body)
+}
+
+func TestHandler(t *testing.T) {
+	route := Route{Namespace: "default", Ingress: "app", Host: "app.example.com", Path: "/api"}
+	ObserveRequest(route, 502, 10, -1, 20*time.Millisecond)
+	ObserveRequest(Route{}, 404, 0, 35, time.Millisecond)
+	UpstreamError(route, "timeout")
+	ObserveSync(true, time.Second)
+	RoutingTableChanged(3)
+	ReconcileError()
+	InformerEvent("ingress", "add")
+
+	body := scrape(t)
+	for _, expected := range []string{
+		`panacea_requests_total{host="app.example.com",ingress="app",namespace="default",path="/api",status="5xx"} 1`,
+		`panacea_requests_total{host="",ingress="",namespace="",path="",status="4xx"} 1`,
+		`panacea_request_size_bytes_count{host="app.example.com",ingress="app",namespace="default",path="/api"} 1`,
+		`panacea_response_size_bytes_count{host="",ingress="",namespace="",path=""} 1`,
+		`panacea_upstream_errors_total{host="app.example.com",ingress="app",namespace="default",path="/api",reason="timeout"} 1`,
+		`panacea_sync_duration_seconds_count{scope="full"} 1`,
+		`panacea_routes 3`,
+		`panacea_reconcile_errors_total 1`,
+		`panacea_informer_events_total{event="add",resource="ingress"} 1`,
+		`panacea_config_last_reload_timestamp_seconds `,
+		`go_goroutines `,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected the metrics to contain %q", expected)
+		}
+	}
+
+	// The size of the response of the failed request was unknown.
+	if strings.Contains(body, `panacea_response_size_bytes_count{host="app.example.com"`) {
+		t.Errorf("Expected no response size for unknown sizes")
+	}
+}
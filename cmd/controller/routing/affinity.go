@@ -0,0 +1,94 @@
+package routing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+const (
+	// AffinityCookie is the only affinity mode supported by panacea.io/affinity.
+	AffinityCookie = "cookie"
+
+	defaultSessionCookieName = "panacea-affinity"
+	defaultSessionCookiePath = "/"
+)
+
+// cookieAffinity pins clients to an endpoint with a signed cookie. The cookie
+// names the endpoint by an opaque ID, and is ignored once that endpoint is no
+// longer part of the upstream.
+type cookieAffinity struct {
+	name     string
+	path     string
+	maxAge   int
+	sameSite http.SameSite
+	key      []byte
+}
+
+// endpointID returns the opaque ID of ep used in affinity cookies.
+func endpointID(ep *Endpoint) string {
+	sum := sha256.Sum256([]byte(ep.Host()))
+	return hex.EncodeToString(sum[:8])
+}
+
+func (a *cookieAffinity) sign(upstreamKey, id string) string {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(a.name))
+	mac.Write([]byte{0})
+	mac.Write([]byte(upstreamKey))
+	mac.Write([]byte{0})
+	mac.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// endpoint returns the endpoint named by a valid affinity cookie on req, or
+// nil when there is none or it no longer exists.
+func (a *cookieAffinity) endpoint(req *http.Request, upstreamKey string, endpoints []*Endpoint) *Endpoint {
+	cookie, err := req.Cookie(a.name)
+	if err != nil {
+		return nil
+	}
+
+	id, signature, ok := strings.Cut(cookie.Value, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(a.sign(upstreamKey, id))) {
+		return nil
+	}
+
+	for _, ep := range endpoints {
+		if endpointID(ep) == id {
+			return ep
+		}
+	}
+	return nil
+}
+
+// cookie returns the affinity cookie pinning the client to ep.
+func (a *cookieAffinity) cookie(upstreamKey string, ep *Endpoint, secure bool) *http.Cookie {
+	id := endpointID(ep)
+	return &http.Cookie{
+		Name:     a.name,
+		Value:    id + "." + a.sign(upstreamKey, id),
+		Path:     a.path,
+		MaxAge:   a.maxAge,
+		HttpOnly: true,
+		Secure:   secure || a.sameSite == http.SameSiteNoneMode,
+		SameSite: a.sameSite,
+	}
+}
+
+func parseSameSite(value string) (http.SameSite, bool) {
+	switch strings.ToLower(value) {
+	case "":
+		return http.SameSiteDefaultMode, true
+	case "lax":
+		return http.SameSiteLaxMode, true
+	case "strict":
+		return http.SameSiteStrictMode, true
+	case "none":
+		return http.SameSiteNoneMode, true
+	}
+	return http.SameSiteDefaultMode, false
+}
@@ -0,0 +1,97 @@
+package routing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+func newTestAffinity() *cookieAffinity {
+	return &cookieAffinity{
+		name:     defaultSessionCookieName,
+		path:     defaultSessionCookiePath,
+		maxAge:   3600,
+		sameSite: http.SameSiteLaxMode,
+		key:      []byte("test-key"),
+	}
+}
+
+func TestCookieAffinityEndpoint(t *testing.T) {
+	affinity := newTestAffinity()
+	endpoints := testEndpoints(3)
+	const upstreamKey = "default/web:80"
+
+	cookie := affinity.cookie(upstreamKey, endpoints[1], false)
+	if cookie.MaxAge != 3600 || cookie.SameSite != http.SameSiteLaxMode || !cookie.HttpOnly {
+		t.Errorf("unexpected cookie attributes: %s", cookie)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+
+	if ep := affinity.endpoint(req, upstreamKey, endpoints); ep != endpoints[1] {
+		t.Errorf("expected cookie to pin %s, got %v", endpoints[1], ep)
+	}
+	if ep := affinity.endpoint(req, "default/other:80", endpoints); ep != nil {
+		t.Errorf("expected cookie of another upstream to be ignored, got %s", ep)
+	}
+	if ep := affinity.endpoint(req, upstreamKey, []*Endpoint{endpoints[0], endpoints[2]}); ep != nil {
+		t.Errorf("expected cookie of a removed endpoint to be ignored, got %s", ep)
+	}
+
+	forged := httptest.NewRequest(http.MethodGet, "/", nil)
+	forged.AddCookie(&http.Cookie{Name: cookie.Name, Value: endpointID(endpoints[2]) + ".forged"})
+	if ep := affinity.endpoint(forged, upstreamKey, endpoints); ep != nil {
+		t.Errorf("expected forged cookie to be ignored, got %s", ep)
+	}
+}
+
+func TestRouteTransportAffinity(t *testing.T) {
+	hits := make(map[string]int)
+	newServer := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits[name]++
+		}))
+	}
+
+	a := newServer("a")
+	defer a.Close()
+	b := newServer("b")
+	defer b.Close()
+
+	upstream := newUpstream("default", "web", networkingv1.ServiceBackendPort{Number: 80}, false)
+	upstream.SetEndpoints([]*Endpoint{testEndpoint(t, a.URL), testEndpoint(t, b.URL)})
+	transport := &routeTransport{upstream: upstream, balancer: &roundRobin{}, affinity: newTestAffinity()}
+
+	req := httptest.NewRequest(http.MethodGet, "http://web.default.svc.cluster.local/", nil)
+	req.RequestURI = ""
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip() returned an error: %v", err)
+	}
+	resp.Body.Close()
+
+	cookies := resp.Cookies()
+	if len(cookies) != 1 || cookies[0].Name != defaultSessionCookieName {
+		t.Fatalf("expected an affinity cookie, got %v", cookies)
+	}
+
+	req.AddCookie(cookies[0])
+	for range 4 {
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip() returned an error: %v", err)
+		}
+		resp.Body.Close()
+		if len(resp.Cookies()) != 0 {
+			t.Errorf("expected no new cookie for a pinned request")
+		}
+	}
+
+	if hits["a"] != 5 && hits["b"] != 5 {
+		t.Errorf("expected all requests on one endpoint, got %v", hits)
+	}
+}
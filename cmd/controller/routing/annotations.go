@@ -0,0 +1,177 @@
+package routing
+
+import (
+	"strconv"
+	"time"
+
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+const annotationPrefix = "panacea.io/"
+
+const (
+	// AnnotationServiceUpstream makes the Ingress proxy to the Service DNS name
+	// instead of the pod endpoints behind it.
+	AnnotationServiceUpstream = annotationPrefix + "service-upstream"
+
+	// AnnotationLoadBalance selects the load-balancing algorithm of the
+	// Ingress: round-robin, weighted-round-robin, least-conn, ewma or
+	// consistent-hash.
+	AnnotationLoadBalance = annotationPrefix + "load-balance"
+	// AnnotationUpstreamHashBy is the consistent-hash key: ip,
+	// header:<name> or cookie:<name>.
+	AnnotationUpstreamHashBy = annotationPrefix + "upstream-hash-by"
+	// AnnotationUpstreamWeights lists weighted-round-robin weights as
+	// comma-separated <pod name|address|zone>=<weight> pairs.
+	AnnotationUpstreamWeights = annotationPrefix + "upstream-weights"
+
+	// AnnotationAffinity enables session affinity. Only "cookie" is supported.
+	AnnotationAffinity = annotationPrefix + "affinity"
+	// AnnotationSessionCookieName is the name of the affinity cookie.
+	AnnotationSessionCookieName = annotationPrefix + "session-cookie-name"
+	// AnnotationSessionCookiePath is the path of the affinity cookie.
+	AnnotationSessionCookiePath = annotationPrefix + "session-cookie-path"
+	// AnnotationSessionCookieMaxAge is the lifetime of the affinity cookie in
+	// seconds. The cookie lasts for the browser session when unset.
+	AnnotationSessionCookieMaxAge = annotationPrefix + "session-cookie-max-age"
+	// AnnotationSessionCookieSameSite is the SameSite attribute of the
+	// affinity cookie: Lax, Strict or None.
+	AnnotationSessionCookieSameSite = annotationPrefix + "session-cookie-samesite"
+
+	// AnnotationHealthCheckPath enables active health checking of the
+	// endpoints on the given path.
+	AnnotationHealthCheckPath = annotationPrefix + "health-check-path"
+	// AnnotationHealthCheckInterval is the time between two probes.
+	AnnotationHealthCheckInterval = annotationPrefix + "health-check-interval"
+	// AnnotationHealthCheckTimeout is the timeout of a single probe.
+	AnnotationHealthCheckTimeout = annotationPrefix + "health-check-timeout"
+	// AnnotationHealthCheckHealthyThreshold is the number of consecutive
+	// successful probes that bring an endpoint back.
+	AnnotationHealthCheckHealthyThreshold = annotationPrefix + "health-check-healthy-threshold"
+	// AnnotationHealthCheckUnhealthyThreshold is the number of consecutive
+	// failed probes that eject an endpoint.
+	AnnotationHealthCheckUnhealthyThreshold = annotationPrefix + "health-check-unhealthy-threshold"
+
+	// AnnotationOutlierConsecutiveErrors is the number of consecutive 5xx
+	// responses or connection errors that eject an endpoint. 0 disables
+	// outlier detection.
+	AnnotationOutlierConsecutiveErrors = annotationPrefix + "outlier-consecutive-errors"
+	// AnnotationOutlierBaseEjectionTime is the length of the first ejection
+	// of an endpoint. It doubles on every new ejection.
+	AnnotationOutlierBaseEjectionTime = annotationPrefix + "outlier-base-ejection-time"
+	// AnnotationOutlierMaxEjectionTime caps the ejection time.
+	AnnotationOutlierMaxEjectionTime = annotationPrefix + "outlier-max-ejection-time"
+	// AnnotationOutlierMaxEjectionPercent is the maximum percentage of the
+	// endpoints ejected at once.
+	AnnotationOutlierMaxEjectionPercent = annotationPrefix + "outlier-max-ejection-percent"
+
+	// AnnotationMaxConcurrentRequests limits the requests in flight to the
+	// backend. 0 means unlimited.
+	AnnotationMaxConcurrentRequests = annotationPrefix + "max-concurrent-requests"
+	// AnnotationMaxPendingRequests is the number of requests allowed to wait
+	// when the backend is at its concurrency limit. Others fail with 503.
+	AnnotationMaxPendingRequests = annotationPrefix + "max-pending-requests"
+
+	// AnnotationRetryAttempts is the maximum number of attempts of a request,
+	// the first one included. 1 disables retries.
+	AnnotationRetryAttempts = annotationPrefix + "retry-attempts"
+	// AnnotationRetryOn lists the conditions a request is retried on:
+	// connect-failure, reset, 502, 503 and 504.
+	AnnotationRetryOn = annotationPrefix + "retry-on"
+	// AnnotationRetryPerTryTimeout is the time an attempt may wait for
+	// response headers before it is retried.
+	AnnotationRetryPerTryTimeout = annotationPrefix + "retry-per-try-timeout"
+	// AnnotationRetryNonIdempotent allows retrying POST and PATCH requests.
+	AnnotationRetryNonIdempotent = annotationPrefix + "retry-non-idempotent"
+
+	// AnnotationConnectTimeout is the time allowed to connect to an endpoint.
+	AnnotationConnectTimeout = annotationPrefix + "connect-timeout"
+	// AnnotationResponseHeaderTimeout is the time an endpoint has to send
+	// response headers.
+	AnnotationResponseHeaderTimeout = annotationPrefix + "response-header-timeout"
+	// AnnotationRequestTimeout is the time allowed for the whole request,
+	// retries and response body included.
+	AnnotationRequestTimeout = annotationPrefix + "request-timeout"
+
+	// AnnotationBackendProtocol is the protocol spoken to the backend: HTTP,
+	// HTTPS, GRPC, GRPCS or H2C.
+	AnnotationBackendProtocol = annotationPrefix + "backend-protocol"
+	// AnnotationBackendTLSSecret names the Secret, in the namespace of the
+	// Ingress, holding the ca.crt HTTPS and GRPCS backends are verified
+	// against and, for mTLS, the tls.crt and tls.key presented to them.
+	AnnotationBackendTLSSecret = annotationPrefix + "backend-tls-secret"
+	// AnnotationBackendTLSServerName is the SNI server name sent to the
+	// backend and verified against its certificate. Defaults to the Service
+	// DNS name <service>.<namespace>.svc.
+	AnnotationBackendTLSServerName = annotationPrefix + "backend-tls-server-name"
+
+	// AnnotationUseRegex makes the ImplementationSpecific paths of the
+	// Ingress RE2 regular expressions matching the whole path. Prefixes
+	// end with .*, such as /api/.*.
+	AnnotationUseRegex = annotationPrefix + "use-regex"
+	// AnnotationRewriteTarget replaces the request path sent to the backend.
+	// With regular expression paths it may refer to capture groups as $1;
+	// otherwise it replaces the matched part of the path.
+	AnnotationRewriteTarget = annotationPrefix + "rewrite-target"
+)
+
+// annotationInt returns the integer value of the annotation name on ingress,
+// or def when it is missing or invalid.
+func annotationInt(ingress *networkingv1.Ingress, name string, def int) int {
+	value, ok := ingress.Annotations[name]
+	if !ok {
+		return def
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		l.Info("Ignoring invalid annotation", "annotation", name, "value", value, "ingress", ingress.Name, "namespace", ingress.Namespace)
+		return def
+	}
+	return i
+}
+
+// annotationDuration returns the duration value of the annotation name on
+// ingress, or def when it is missing or invalid. Plain numbers are seconds.
+func annotationDuration(ingress *networkingv1.Ingress, name string, def time.Duration) time.Duration {
+	value, ok := ingress.Annotations[name]
+	if !ok {
+		return def
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		l.Info("Ignoring invalid annotation", "annotation", name, "value", value, "ingress", ingress.Name, "namespace", ingress.Namespace)
+		return def
+	}
+	return d
+}
+
+// annotationString returns the annotation name on ingress, or def when it is
+// missing or empty.
+func annotationString(ingress *networkingv1.Ingress, name, def string) string {
+	if value := ingress.Annotations[name]; value != "" {
+		return value
+	}
+	return def
+}
+
+// annotationBool returns the boolean value of the annotation name on ingress,
+// or def when it is missing or invalid.
+func annotationBool(ingress *networkingv1.Ingress, name string, def bool) bool {
+	value, ok := ingress.Annotations[name]
+	if !ok {
+		return def
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		l.Info("Ignoring invalid annotation", "annotation", name, "value", value, "ingress", ingress.Name, "namespace", ingress.Namespace)
+		return def
+	}
+	return b
+}
@@ -0,0 +1,161 @@
+package routing
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Backend protocols accepted by the panacea.io/backend-protocol annotation.
+const (
+	ProtocolHTTP  = "HTTP"
+	ProtocolHTTPS = "HTTPS"
+	ProtocolGRPC  = "GRPC"
+	ProtocolGRPCS = "GRPCS"
+	ProtocolH2C   = "H2C"
+)
+
+func parseProtocol(value string) (string, error) {
+	switch protocol := strings.ToUpper(value); protocol {
+	case "":
+		return ProtocolHTTP, nil
+	case ProtocolHTTP, ProtocolHTTPS, ProtocolGRPC, ProtocolGRPCS, ProtocolH2C:
+		return protocol, nil
+	}
+	return "", fmt.Errorf("unknown backend protocol %q, expected HTTP, HTTPS, GRPC, GRPCS or H2C", value)
+}
+
+// Backend describes how the endpoints of an upstream are spoken to.
+type Backend struct {
+	Protocol string
+	// Secret is the namespace/name of the Secret holding the ca.crt endpoint
+	// certificates are verified against and, for mTLS, the tls.crt and
+	// tls.key presented to them. Without ca.crt the system roots are used.
+	Secret string
+	// ServerName is sent as SNI and verified against endpoint certificates.
+	// The endpoint host is used when it is empty.
+	ServerName string
+}
+
+// TLS reports whether the endpoints are reached over TLS.
+func (b Backend) TLS() bool {
+	return b.Protocol == ProtocolHTTPS || b.Protocol == ProtocolGRPCS
+}
+
+// GRPC reports whether the endpoints speak gRPC.
+func (b Backend) GRPC() bool {
+	return b.Protocol == ProtocolGRPC || b.Protocol == ProtocolGRPCS
+}
+
+func (b Backend) scheme() string {
+	if b.TLS() {
+		return "https"
+	}
+	return "http"
+}
+
+// transport returns a transport speaking the backend protocol, with the CA
+// and client certificate of the backend Secret taken from certs.
+func (b Backend) transport(certs *CertificateStore) *http.Transport {
+	protos := &http.Protocols{}
+	switch b.Protocol {
+	case ProtocolHTTPS:
+		protos.SetHTTP1(true)
+		protos.SetHTTP2(true)
+	case ProtocolGRPCS:
+		protos.SetHTTP2(true)
+	case ProtocolGRPC, ProtocolH2C:
+		protos.SetUnencryptedHTTP2(true)
+	default:
+		protos.SetHTTP1(true)
+	}
+
+	transport := &http.Transport{
+		DialContext:           dialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		Protocols:             protos,
+		MaxConnsPerHost:       100,
+	}
+	if b.TLS() {
+		transport.TLSClientConfig = b.tlsConfig(certs)
+	}
+	return transport
+}
+
+func (b Backend) tlsConfig(certs *CertificateStore) *tls.Config {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: b.ServerName,
+	}
+	if b.Secret == "" {
+		return config
+	}
+
+	var (
+		ca   *x509.CertPool
+		cert *tls.Certificate
+	)
+	if certs != nil {
+		ca = certs.CA(b.Secret)
+		cert = certs.Get(b.Secret)
+	}
+
+	switch {
+	case ca != nil:
+		config.RootCAs = ca
+	case cert == nil:
+		// Fail closed until the Secret is loaded rather than trusting the
+		// system roots the Secret was meant to replace.
+		l.Info("Backend TLS secret not loaded yet, connections will fail until it is", "secret", b.Secret)
+		config.RootCAs = x509.NewCertPool()
+	}
+	if cert != nil {
+		config.Certificates = []tls.Certificate{*cert}
+	}
+	return config
+}
+
+// Backend returns how the endpoints of the upstream are spoken to.
+func (u *Upstream) Backend() Backend {
+	return *u.backend.Load()
+}
+
+// SetBackend changes how the endpoints of the upstream are spoken to. The
+// connections of the previous backend are closed once idle.
+func (u *Upstream) SetBackend(backend Backend, certs *CertificateStore) {
+	u.backendMu.Lock()
+	defer u.backendMu.Unlock()
+
+	if backend == u.Backend() && certs == u.certs {
+		return
+	}
+	u.backend.Store(&backend)
+	u.certs = certs
+	u.setTransport(backend.transport(certs))
+}
+
+// reloadBackendSecret rebuilds the transport of the upstream when it uses
+// the Secret key, so rotated CAs and client certificates are picked up.
+func (u *Upstream) reloadBackendSecret(key string) {
+	u.backendMu.Lock()
+	defer u.backendMu.Unlock()
+
+	backend := u.Backend()
+	if backend.Secret != key || !backend.TLS() {
+		return
+	}
+	l.Info("Reloading backend TLS", "upstream", u.Key(), "secret", key)
+	u.setTransport(backend.transport(u.certs))
+}
+
+func (u *Upstream) setTransport(transport *http.Transport) {
+	if old := u.transport.Swap(transport); old != nil {
+		old.CloseIdleConnections()
+	}
+}
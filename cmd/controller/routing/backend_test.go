@@ -0,0 +1,198 @@
+package routing
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestCASecret(namespace, name string, certs ...*x509.Certificate) *corev1.Secret {
+	var bundle []byte
+	for _, cert := range certs {
+		bundle = append(bundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Type:       corev1.SecretTypeOpaque,
+		Data:       map[string][]byte{caKey: bundle},
+	}
+}
+
+func TestParseProtocol(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+		valid    bool
+	}{
+		{"", ProtocolHTTP, true},
+		{"https", ProtocolHTTPS, true},
+		{"GRPCS", ProtocolGRPCS, true},
+		{"h2c", ProtocolH2C, true},
+		{"AJP", "", false},
+	}
+
+	for _, tt := range tests {
+		protocol, err := parseProtocol(tt.value)
+		if (err == nil) != tt.valid || protocol != tt.expected {
+			t.Errorf("parseProtocol(%q): expected %q valid=%v, got %q err=%v", tt.value, tt.expected, tt.valid, protocol, err)
+		}
+	}
+}
+
+func TestUpstreamHTTPSBackend(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	other, err := newSelfSignedCertificate("example.com")
+	if err != nil {
+		t.Fatalf("newSelfSignedCertificate() returned an error: %v", err)
+	}
+
+	store := NewCertificateStore(nil)
+	store.SetReferenced([]string{"default/backend-ca", "default/other-ca"})
+	store.OnAdd(newTestCASecret("default", "backend-ca", server.Certificate()), false)
+	store.OnAdd(newTestCASecret("default", "other-ca", other.Leaf), false)
+
+	tests := []struct {
+		name    string
+		backend Backend
+		ok      bool
+	}{
+		{"verified against the CA secret", Backend{Protocol: ProtocolHTTPS, Secret: "default/backend-ca", ServerName: "example.com"}, true},
+		{"wrong server name", Backend{Protocol: ProtocolHTTPS, Secret: "default/backend-ca", ServerName: "web.default.svc"}, false},
+		{"wrong CA", Backend{Protocol: ProtocolHTTPS, Secret: "default/other-ca", ServerName: "example.com"}, false},
+		{"secret not loaded", Backend{Protocol: ProtocolHTTPS, Secret: "default/missing", ServerName: "example.com"}, false},
+		{"system roots", Backend{Protocol: ProtocolHTTPS, ServerName: "example.com"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := newUpstream("default", "web", networkingv1.ServiceBackendPort{Number: 443}, false)
+			upstream.SetEndpoints([]*Endpoint{testEndpoint(t, server.URL)})
+			upstream.SetBackend(tt.backend, store)
+			transport := &routeTransport{upstream: upstream, balancer: &roundRobin{}}
+
+			req := httptest.NewRequest(http.MethodGet, "http://web.default.svc.cluster.local/", nil)
+			req.RequestURI = ""
+			resp, err := transport.RoundTrip(req)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err == nil) != tt.ok {
+				t.Errorf("expected ok=%v, got error %v", tt.ok, err)
+			}
+		})
+	}
+}
+
+func TestUpstreamMutualTLSBackend(t *testing.T) {
+	client := newTestTLSSecret(t, "default", "backend-tls", "panacea")
+	clientCert, err := parseTLSSecret(client)
+	if err != nil {
+		t.Fatalf("parseTLSSecret() returned an error: %v", err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !r.TLS.PeerCertificates[0].Equal(clientCert.Leaf) {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+
+	client.Data[caKey] = newTestCASecret("default", "backend-tls", server.Certificate()).Data[caKey]
+
+	store := NewCertificateStore(nil)
+	store.SetReferenced([]string{"default/backend-tls"})
+	store.OnAdd(client, false)
+
+	upstream := newUpstream("default", "web", networkingv1.ServiceBackendPort{Number: 443}, false)
+	upstream.SetEndpoints([]*Endpoint{testEndpoint(t, server.URL)})
+	upstream.SetBackend(Backend{Protocol: ProtocolHTTPS, Secret: "default/backend-tls", ServerName: "example.com"}, store)
+	transport := &routeTransport{upstream: upstream, balancer: &roundRobin{}}
+
+	req := httptest.NewRequest(http.MethodGet, "http://web.default.svc.cluster.local/", nil)
+	req.RequestURI = ""
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip() returned an error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the client certificate to be presented, got %d", resp.StatusCode)
+	}
+}
+
+func TestUpstreamReloadBackendSecret(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	other, err := newSelfSignedCertificate("example.com")
+	if err != nil {
+		t.Fatalf("newSelfSignedCertificate() returned an error: %v", err)
+	}
+
+	upstream := newUpstream("default", "web", networkingv1.ServiceBackendPort{Number: 443}, false)
+	upstream.SetEndpoints([]*Endpoint{testEndpoint(t, server.URL)})
+
+	store := NewCertificateStore(nil)
+	store.onChange = upstream.reloadBackendSecret
+	store.SetReferenced([]string{"default/backend-ca"})
+	store.OnAdd(newTestCASecret("default", "backend-ca", other.Leaf), false)
+	upstream.SetBackend(Backend{Protocol: ProtocolHTTPS, Secret: "default/backend-ca", ServerName: "example.com"}, store)
+
+	transport := &routeTransport{upstream: upstream, balancer: &roundRobin{}}
+	send := func() error {
+		req := httptest.NewRequest(http.MethodGet, "http://web.default.svc.cluster.local/", nil)
+		req.RequestURI = ""
+		resp, err := transport.RoundTrip(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	if err := send(); err == nil {
+		t.Fatalf("expected verification to fail with the wrong CA")
+	}
+
+	store.OnUpdate(nil, newTestCASecret("default", "backend-ca", server.Certificate()))
+	if err := send(); err != nil {
+		t.Errorf("expected the rotated CA to be used, got %v", err)
+	}
+}
+
+func TestUpstreamH2CBackend(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			w.WriteHeader(http.StatusHTTPVersionNotSupported)
+		}
+	}))
+	server.Config.Protocols = &http.Protocols{}
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	defer server.Close()
+
+	upstream := newUpstream("default", "web", networkingv1.ServiceBackendPort{Number: 80}, false)
+	upstream.SetEndpoints([]*Endpoint{testEndpoint(t, server.URL)})
+	upstream.SetBackend(Backend{Protocol: ProtocolH2C}, nil)
+	transport := &routeTransport{upstream: upstream, balancer: &roundRobin{}}
+
+	req := httptest.NewRequest(http.MethodGet, "http://web.default.svc.cluster.local/", nil)
+	req.RequestURI = ""
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip() returned an error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected an HTTP/2 request, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,355 @@
+package routing
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Load-balancing algorithms accepted by --load-balance and the
+// panacea.io/load-balance annotation.
+const (
+	BalanceRoundRobin         = "round-robin"
+	BalanceWeightedRoundRobin = "weighted-round-robin"
+	BalanceLeastConn          = "least-conn"
+	BalanceEWMA               = "ewma"
+	BalanceConsistentHash     = "consistent-hash"
+)
+
+// Balancer picks the endpoint a request is sent to.
+type Balancer interface {
+	// Pick returns one of endpoints for req, or nil when endpoints is empty.
+	Pick(req *http.Request, endpoints []*Endpoint) *Endpoint
+	Name() string
+}
+
+// balancerConfig describes the balancer of a route.
+type balancerConfig struct {
+	algorithm string
+	// hashBy is "ip", "header:<name>" or "cookie:<name>" for consistent-hash.
+	hashBy string
+	// weights are keyed by pod name, address or zone for weighted-round-robin.
+	weights map[string]int
+}
+
+func newBalancer(cfg balancerConfig) (Balancer, error) {
+	switch cfg.algorithm {
+	case "", BalanceRoundRobin:
+		return &roundRobin{}, nil
+	case BalanceWeightedRoundRobin:
+		return &weightedRoundRobin{weights: cfg.weights, current: make(map[*Endpoint]int)}, nil
+	case BalanceLeastConn:
+		return &leastConn{}, nil
+	case BalanceEWMA:
+		return &peakEWMA{}, nil
+	case BalanceConsistentHash:
+		key, err := parseHashBy(cfg.hashBy)
+		if err != nil {
+			return nil, err
+		}
+		return &consistentHash{key: key, fallback: &roundRobin{}}, nil
+	default:
+		return nil, fmt.Errorf("unknown load-balancing algorithm %q", cfg.algorithm)
+	}
+}
+
+// parseWeights parses "key=weight,key=weight" pairs.
+func parseWeights(value string) (map[string]int, error) {
+	weights := make(map[string]int)
+	for pair := range strings.SplitSeq(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, raw, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid weight %q, expected key=weight", pair)
+		}
+		weight, err := strconv.Atoi(strings.TrimSpace(raw))
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("invalid weight %q", pair)
+		}
+		weights[strings.TrimSpace(key)] = weight
+	}
+	return weights, nil
+}
+
+type roundRobin struct {
+	next atomic.Uint64
+}
+
+func (b *roundRobin) Name() string { return BalanceRoundRobin }
+
+func (b *roundRobin) Pick(_ *http.Request, endpoints []*Endpoint) *Endpoint {
+	if len(endpoints) == 0 {
+		return nil
+	}
+	return endpoints[(b.next.Add(1)-1)%uint64(len(endpoints))]
+}
+
+// weightedRoundRobin is the smooth weighted round-robin used by NGINX: it
+// interleaves endpoints instead of sending bursts to the heaviest one.
+type weightedRoundRobin struct {
+	mu      sync.Mutex
+	weights map[string]int
+	current map[*Endpoint]int
+}
+
+func (b *weightedRoundRobin) Name() string { return BalanceWeightedRoundRobin }
+
+func (b *weightedRoundRobin) weight(ep *Endpoint) int {
+	for _, key := range []string{ep.PodName, ep.Address, ep.Zone} {
+		if w, ok := b.weights[key]; ok && key != "" {
+			return w
+		}
+	}
+	return 1
+}
+
+func (b *weightedRoundRobin) Pick(_ *http.Request, endpoints []*Endpoint) *Endpoint {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var (
+		best  *Endpoint
+		total int
+	)
+	for _, ep := range endpoints {
+		w := b.weight(ep)
+		if w == 0 {
+			continue
+		}
+		b.current[ep] += w
+		total += w
+		if best == nil || b.current[ep] > b.current[best] {
+			best = ep
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	b.current[best] -= total
+
+	// Forget endpoints that are gone.
+	if len(b.current) > len(endpoints) {
+		for ep := range b.current {
+			if !slices.Contains(endpoints, ep) {
+				delete(b.current, ep)
+			}
+		}
+	}
+	return best
+}
+
+type leastConn struct{}
+
+func (b *leastConn) Name() string { return BalanceLeastConn }
+
+func (b *leastConn) Pick(_ *http.Request, endpoints []*Endpoint) *Endpoint {
+	if len(endpoints) == 0 {
+		return nil
+	}
+
+	// Start at a random offset so ties are spread out.
+	start := rand.IntN(len(endpoints))
+	best := endpoints[start]
+	for i := 1; i < len(endpoints); i++ {
+		ep := endpoints[(start+i)%len(endpoints)]
+		if ep.Active() < best.Active() {
+			best = ep
+		}
+	}
+	return best
+}
+
+// peakEWMA picks the better of two random endpoints, scoring each by its
+// latency moving average weighted by the requests it is already serving.
+type peakEWMA struct{}
+
+func (b *peakEWMA) Name() string { return BalanceEWMA }
+
+func (b *peakEWMA) Pick(_ *http.Request, endpoints []*Endpoint) *Endpoint {
+	switch len(endpoints) {
+	case 0:
+		return nil
+	case 1:
+		return endpoints[0]
+	}
+
+	i := rand.IntN(len(endpoints))
+	j := rand.IntN(len(endpoints) - 1)
+	if j >= i {
+		j++
+	}
+
+	a, c := endpoints[i], endpoints[j]
+	if score(c) < score(a) {
+		return c
+	}
+	return a
+}
+
+func score(ep *Endpoint) float64 {
+	return ep.Latency() * float64(ep.Active()+1)
+}
+
+// hashKey extracts the value a request is hashed on.
+type hashKey func(req *http.Request) (string, bool)
+
+func parseHashBy(hashBy string) (hashKey, error) {
+	source, name, _ := strings.Cut(hashBy, ":")
+	switch strings.ToLower(source) {
+	case "", "ip":
+		return func(req *http.Request) (string, bool) {
+			host, _, err := net.SplitHostPort(req.RemoteAddr)
+			if err != nil {
+				host = req.RemoteAddr
+			}
+			return host, host != ""
+		}, nil
+	case "header":
+		if name == "" {
+			return nil, fmt.Errorf("hash-by %q is missing the header name", hashBy)
+		}
+		return func(req *http.Request) (string, bool) {
+			value := req.Header.Get(name)
+			return value, value != ""
+		}, nil
+	case "cookie":
+		if name == "" {
+			return nil, fmt.Errorf("hash-by %q is missing the cookie name", hashBy)
+		}
+		return func(req *http.Request) (string, bool) {
+			cookie, err := req.Cookie(name)
+			if err != nil || cookie.Value == "" {
+				return "", false
+			}
+			return cookie.Value, true
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid hash-by %q, expected ip, header:<name> or cookie:<name>", hashBy)
+	}
+}
+
+const hashRingReplicas = 100
+
+// consistentHash maps requests onto a hash ring so the same key keeps going
+// to the same endpoint, and only the keys of a removed endpoint move.
+type consistentHash struct {
+	key      hashKey
+	fallback Balancer
+
+	mu        sync.Mutex
+	endpoints []*Endpoint
+	members   map[*Endpoint]struct{}
+	ring      []ringEntry
+}
+
+type ringEntry struct {
+	hash     uint64
+	endpoint *Endpoint
+}
+
+func (b *consistentHash) Name() string { return BalanceConsistentHash }
+
+func hash64(s string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(s))
+	return h.Sum64()
+}
+
+// ringFor returns a ring holding every endpoint of endpoints, and whether it
+// holds others too. Upstreams replace their endpoint slice on every change.
+// The ring of the endpoints is kept for subsets of them, such as the
+// endpoints a retry has not tried yet, which are picked by skipping the
+// others.
+func (b *consistentHash) ringFor(endpoints []*Endpoint) ([]ringEntry, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(endpoints) == len(b.endpoints) && &endpoints[0] == &b.endpoints[0] {
+		return b.ring, false
+	}
+	if b.covers(endpoints) {
+		if len(endpoints) == len(b.endpoints) {
+			b.endpoints = endpoints
+			return b.ring, false
+		}
+		return b.ring, true
+	}
+
+	members := make(map[*Endpoint]struct{}, len(endpoints))
+	ring := make([]ringEntry, 0, len(endpoints)*hashRingReplicas)
+	for _, ep := range endpoints {
+		members[ep] = struct{}{}
+		for i := range hashRingReplicas {
+			ring = append(ring, ringEntry{hash: hash64(ep.Host() + "#" + strconv.Itoa(i)), endpoint: ep})
+		}
+	}
+	slices.SortFunc(ring, func(a, b ringEntry) int {
+		switch {
+		case a.hash < b.hash:
+			return -1
+		case a.hash > b.hash:
+			return 1
+		}
+		return 0
+	})
+
+	b.endpoints = endpoints
+	b.members = members
+	b.ring = ring
+	return ring, false
+}
+
+// covers reports whether the ring holds every endpoint of endpoints.
+func (b *consistentHash) covers(endpoints []*Endpoint) bool {
+	if len(endpoints) > len(b.members) {
+		return false
+	}
+	for _, ep := range endpoints {
+		if _, ok := b.members[ep]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *consistentHash) Pick(req *http.Request, endpoints []*Endpoint) *Endpoint {
+	if len(endpoints) == 0 {
+		return nil
+	}
+
+	key, ok := b.key(req)
+	if !ok {
+		return b.fallback.Pick(req, endpoints)
+	}
+
+	ring, subset := b.ringFor(endpoints)
+	h := hash64(key)
+	i, _ := slices.BinarySearchFunc(ring, h, func(e ringEntry, h uint64) int {
+		switch {
+		case e.hash < h:
+			return -1
+		case e.hash > h:
+			return 1
+		}
+		return 0
+	})
+	// The next endpoint of the subset on the ring is the one its own ring
+	// would map the key to.
+	for n := range len(ring) {
+		entry := ring[(i+n)%len(ring)]
+		if !subset || slices.Contains(endpoints, entry.endpoint) {
+			return entry.endpoint
+		}
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package routing
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testEndpoints(n int) []*Endpoint {
+	endpoints := make([]*Endpoint, 0, n)
+	for i := range n {
+		endpoints = append(endpoints, &Endpoint{
+			Address: fmt.Sprintf("10.0.0.%d", i+1),
+			Port:    8080,
+			PodName: fmt.Sprintf("web-%d", i),
+		})
+	}
+	return endpoints
+}
+
+func pickCounts(b Balancer, req *http.Request, endpoints []*Endpoint, n int) map[*Endpoint]int {
+	counts := make(map[*Endpoint]int)
+	for range n {
+		counts[b.Pick(req, endpoints)]++
+	}
+	return counts
+}
+
+func TestNewBalancer(t *testing.T) {
+	for _, algorithm := range []string{"", BalanceRoundRobin, BalanceWeightedRoundRobin, BalanceLeastConn, BalanceEWMA, BalanceConsistentHash} {
+		if _, err := newBalancer(balancerConfig{algorithm: algorithm}); err != nil {
+			t.Errorf("newBalancer(%q) returned an error: %v", algorithm, err)
+		}
+	}
+
+	if _, err := newBalancer(balancerConfig{algorithm: "random-ish"}); err == nil {
+		t.Errorf("expected an error for an unknown algorithm")
+	}
+	if _, err := newBalancer(balancerConfig{algorithm: BalanceConsistentHash, hashBy: "header"}); err == nil {
+		t.Errorf("expected an error for a header hash without a name")
+	}
+}
+
+func TestBalancersWithoutEndpoints(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, algorithm := range []string{BalanceRoundRobin, BalanceWeightedRoundRobin, BalanceLeastConn, BalanceEWMA, BalanceConsistentHash} {
+		b, _ := newBalancer(balancerConfig{algorithm: algorithm})
+		if ep := b.Pick(req, nil); ep != nil {
+			t.Errorf("%s: expected no endpoint, got %s", algorithm, ep)
+		}
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	endpoints := testEndpoints(3)
+	counts := pickCounts(&roundRobin{}, httptest.NewRequest(http.MethodGet, "/", nil), endpoints, 9)
+	for _, ep := range endpoints {
+		if counts[ep] != 3 {
+			t.Errorf("expected 3 picks for %s, got %d", ep, counts[ep])
+		}
+	}
+}
+
+func TestWeightedRoundRobin(t *testing.T) {
+	endpoints := testEndpoints(3)
+	weights, err := parseWeights("web-0=3, 10.0.0.2=1, web-2=0")
+	if err != nil {
+		t.Fatalf("parseWeights() returned an error: %v", err)
+	}
+
+	b, _ := newBalancer(balancerConfig{algorithm: BalanceWeightedRoundRobin, weights: weights})
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	// Smooth weighted round-robin never sends more than weight picks in a row.
+	var sequence []*Endpoint
+	for range 8 {
+		sequence = append(sequence, b.Pick(req, endpoints))
+	}
+
+	counts := make(map[*Endpoint]int)
+	for _, ep := range sequence {
+		counts[ep]++
+	}
+	if counts[endpoints[0]] != 6 || counts[endpoints[1]] != 2 || counts[endpoints[2]] != 0 {
+		t.Errorf("expected a 6/2/0 split, got %d/%d/%d", counts[endpoints[0]], counts[endpoints[1]], counts[endpoints[2]])
+	}
+	if sequence[0] != endpoints[0] || sequence[1] != endpoints[0] || sequence[2] != endpoints[1] {
+		t.Errorf("expected picks to be interleaved, got %v", sequence)
+	}
+
+	if _, err := parseWeights("web-0"); err == nil {
+		t.Errorf("expected an error for a weight without a value")
+	}
+}
+
+func TestLeastConn(t *testing.T) {
+	endpoints := testEndpoints(3)
+	endpoints[0].active.Store(5)
+	endpoints[1].active.Store(1)
+	endpoints[2].active.Store(3)
+
+	for range 10 {
+		if ep := (&leastConn{}).Pick(nil, endpoints); ep != endpoints[1] {
+			t.Fatalf("expected the least loaded endpoint, got %s", ep)
+		}
+	}
+}
+
+func TestPeakEWMA(t *testing.T) {
+	endpoints := testEndpoints(2)
+	endpoints[0].observeLatency(500 * time.Millisecond)
+	endpoints[1].observeLatency(10 * time.Millisecond)
+
+	for range 10 {
+		if ep := (&peakEWMA{}).Pick(nil, endpoints); ep != endpoints[1] {
+			t.Fatalf("expected the fastest endpoint, got %s", ep)
+		}
+	}
+
+	endpoints[1].active.Store(100)
+	if ep := (&peakEWMA{}).Pick(nil, endpoints); ep != endpoints[0] {
+		t.Errorf("expected the busy endpoint to be avoided, got %s", ep)
+	}
+}
+
+func TestConsistentHash(t *testing.T) {
+	b, err := newBalancer(balancerConfig{algorithm: BalanceConsistentHash, hashBy: "header:X-User"})
+	if err != nil {
+		t.Fatalf("newBalancer() returned an error: %v", err)
+	}
+
+	endpoints := testEndpoints(5)
+	requests := make([]*http.Request, 0, 200)
+	assigned := make([]*Endpoint, 0, 200)
+	for i := range 200 {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-User", fmt.Sprintf("user-%d", i))
+		requests = append(requests, req)
+		assigned = append(assigned, b.Pick(req, endpoints))
+	}
+
+	for i, req := range requests {
+		if ep := b.Pick(req, endpoints); ep != assigned[i] {
+			t.Fatalf("expected %s to stick to %s, got %s", req.Header.Get("X-User"), assigned[i], ep)
+		}
+	}
+
+	// Removing an endpoint only moves the keys it owned.
+	removed := endpoints[2]
+	remaining := append(append([]*Endpoint{}, endpoints[:2]...), endpoints[3:]...)
+	for i, req := range requests {
+		ep := b.Pick(req, remaining)
+		if assigned[i] != removed && ep != assigned[i] {
+			t.Errorf("expected %s to stay on %s, moved to %s", req.Header.Get("X-User"), assigned[i], ep)
+		}
+	}
+
+	t.Run("subsets keep the ring", func(t *testing.T) {
+		ch := b.(*consistentHash)
+		ring := ch.ring
+		fresh, _ := newBalancer(balancerConfig{algorithm: BalanceConsistentHash, hashBy: "header:X-User"})
+		for _, req := range requests {
+			if ep, expected := b.Pick(req, remaining), fresh.Pick(req, remaining); ep != expected {
+				t.Fatalf("expected %s to go to %s as with a ring of the subset, got %s", req.Header.Get("X-User"), expected, ep)
+			}
+		}
+		if &ch.ring[0] != &ring[0] {
+			t.Errorf("expected the ring of all the endpoints to be kept")
+		}
+	})
+}
+
+func TestParseHashBy(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.0.2.10:51234"
+	req.Header.Set("X-User", "alice")
+	req.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+
+	tests := []struct {
+		hashBy   string
+		expected string
+	}{
+		{"ip", "192.0.2.10"},
+		{"header:X-User", "alice"},
+		{"cookie:session", "abc"},
+	}
+
+	for _, test := range tests {
+		key, err := parseHashBy(test.hashBy)
+		if err != nil {
+			t.Fatalf("parseHashBy(%q) returned an error: %v", test.hashBy, err)
+		}
+		if value, ok := key(req); !ok || value != test.expected {
+			t.Errorf("parseHashBy(%q) extracted %q, expected %q", test.hashBy, value, test.expected)
+		}
+	}
+
+	if _, err := parseHashBy("query:id"); err == nil {
+		t.Errorf("expected an error for an unknown hash source")
+	}
+}
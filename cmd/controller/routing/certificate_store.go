@@ -0,0 +1,218 @@
+package routing
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// CertificateStore caches the certificates and CA bundles of the Secrets
+// referenced by the Ingresses of our class. It is kept up to date by a Secret
+// informer and read on every TLS handshake, so rotated certificates are
+// served to new connections without touching the established ones.
+type CertificateStore struct {
+	mu         sync.RWMutex
+	certs      map[string]*tls.Certificate // Keyed by namespace/name of the Secret
+	cas        map[string]*x509.CertPool   // Keyed by namespace/name of the Secret
+	referenced map[string]struct{}
+	getSecret  func(namespace, name string) (*corev1.Secret, error)
+	// onChange is called with the key of a Secret whose content changed.
+	onChange func(key string)
+}
+
+var _ cache.ResourceEventHandler = (*CertificateStore)(nil)
+
+// NewCertificateStore returns an empty store. getSecret is used to load
+// Secrets that become referenced after the informer has already seen them.
+func NewCertificateStore(getSecret func(namespace, name string) (*corev1.Secret, error)) *CertificateStore {
+	return &CertificateStore{
+		certs:      make(map[string]*tls.Certificate),
+		cas:        make(map[string]*x509.CertPool),
+		referenced: make(map[string]struct{}),
+		getSecret:  getSecret,
+	}
+}
+
+func secretKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// Get returns the certificate cached for the Secret key, or nil.
+func (cs *CertificateStore) Get(key string) *tls.Certificate {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.certs[key]
+}
+
+// CA returns the CA bundle cached for the Secret key, or nil.
+func (cs *CertificateStore) CA(key string) *x509.CertPool {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.cas[key]
+}
+
+// IsReferenced reports whether the Secret key is used by any Ingress.
+func (cs *CertificateStore) IsReferenced(key string) bool {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	_, ok := cs.referenced[key]
+	return ok
+}
+
+// Len returns the number of cached certificates.
+func (cs *CertificateStore) Len() int {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return len(cs.certs)
+}
+
+// SetReferenced replaces the set of referenced Secrets. Certificates that are
+// no longer referenced are dropped and newly referenced ones are loaded.
+func (cs *CertificateStore) SetReferenced(keys []string) {
+	referenced := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		referenced[key] = struct{}{}
+	}
+
+	cs.mu.Lock()
+	cs.referenced = referenced
+	var missing []string
+	for key := range cs.certs {
+		if _, ok := referenced[key]; !ok {
+			delete(cs.certs, key)
+		}
+	}
+	for key := range cs.cas {
+		if _, ok := referenced[key]; !ok {
+			delete(cs.cas, key)
+		}
+	}
+	for key := range referenced {
+		_, hasCert := cs.certs[key]
+		_, hasCA := cs.cas[key]
+		if !hasCert && !hasCA {
+			missing = append(missing, key)
+		}
+	}
+	cs.mu.Unlock()
+
+	if cs.getSecret == nil {
+		return
+	}
+
+	for _, key := range missing {
+		namespace, name, _ := strings.Cut(key, "/")
+		secret, err := cs.getSecret(namespace, name)
+		if err != nil {
+			l.Info("Error loading TLS secret", "secret", key, "error", err)
+			continue
+		}
+		cs.update(secret)
+	}
+}
+
+// update parses secret and caches its certificate and CA bundle if the
+// Secret is referenced. A Secret that fails to parse keeps its last good
+// certificate and CA bundle.
+func (cs *CertificateStore) update(secret *corev1.Secret) {
+	key := secretKey(secret.Namespace, secret.Name)
+	if !cs.IsReferenced(key) {
+		return
+	}
+
+	cert, certErr := parseTLSSecret(secret)
+	ca, caErr := parseCASecret(secret)
+	if caErr != nil {
+		l.Info("Keeping previous CA bundle, secret is invalid", "secret", key, "error", caErr)
+	}
+	if cert == nil && ca == nil {
+		if caErr == nil {
+			l.Info("Keeping previous certificate, secret is invalid", "secret", key, "error", certErr)
+		}
+		return
+	}
+
+	cs.mu.Lock()
+	if _, ok := cs.referenced[key]; !ok {
+		cs.mu.Unlock()
+		return
+	}
+	if cert != nil {
+		cs.certs[key] = cert
+		l.Info("Loaded TLS certificate", "secret", key, "notAfter", cert.Leaf.NotAfter)
+	}
+	if ca != nil {
+		cs.cas[key] = ca
+		l.Info("Loaded CA bundle", "secret", key)
+	}
+	cs.mu.Unlock()
+
+	if cs.onChange != nil {
+		cs.onChange(key)
+	}
+}
+
+// Transform drops the payload of Secrets that are not referenced so the
+// informer cache only holds metadata for them.
+func (cs *CertificateStore) Transform(obj any) (any, error) {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		return obj, nil
+	}
+
+	secret.ManagedFields = nil
+	if !cs.IsReferenced(secretKey(secret.Namespace, secret.Name)) {
+		secret.Data = nil
+		secret.StringData = nil
+	}
+	return secret, nil
+}
+
+// OnAdd implements cache.ResourceEventHandler.
+func (cs *CertificateStore) OnAdd(obj any, _ bool) {
+	if secret, ok := obj.(*corev1.Secret); ok {
+		cs.update(secret)
+	}
+}
+
+// OnUpdate implements cache.ResourceEventHandler.
+func (cs *CertificateStore) OnUpdate(oldObj, newObj any) {
+	if resynced(oldObj, newObj) {
+		return
+	}
+	if secret, ok := newObj.(*corev1.Secret); ok {
+		cs.update(secret)
+	}
+}
+
+// OnDelete implements cache.ResourceEventHandler.
+func (cs *CertificateStore) OnDelete(obj any) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		return
+	}
+
+	key := secretKey(secret.Namespace, secret.Name)
+	cs.mu.Lock()
+	_, hasCert := cs.certs[key]
+	_, hasCA := cs.cas[key]
+	delete(cs.certs, key)
+	delete(cs.cas, key)
+	cs.mu.Unlock()
+
+	if !hasCert && !hasCA {
+		return
+	}
+	l.Info("Removed TLS certificate", "secret", key)
+	if cs.onChange != nil {
+		cs.onChange(key)
+	}
+}
@@ -0,0 +1,129 @@
+package routing
+
+import (
+	"crypto/tls"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/danCrespo/panacea-ingress-controller/config"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+func TestCertificateStoreOnlyCachesReferencedSecrets(t *testing.T) {
+	store := NewCertificateStore(nil)
+	store.SetReferenced([]string{"default/app-tls"})
+
+	store.OnAdd(newTestTLSSecret(t, "default", "app-tls", "app.example.com"), true)
+	store.OnAdd(newTestTLSSecret(t, "default", "other-tls", "other.example.com"), true)
+
+	if store.Get("default/app-tls") == nil {
+		t.Errorf("expected referenced secret to be cached")
+	}
+	if store.Get("default/other-tls") != nil {
+		t.Errorf("expected unreferenced secret not to be cached")
+	}
+
+	store.SetReferenced(nil)
+	if store.Len() != 0 {
+		t.Errorf("expected store to be empty once nothing is referenced, got %d", store.Len())
+	}
+}
+
+func TestCertificateStoreRotation(t *testing.T) {
+	store := NewCertificateStore(nil)
+	store.SetReferenced([]string{"default/app-tls"})
+
+	original := newTestTLSSecret(t, "default", "app-tls", "app.example.com")
+	store.OnAdd(original, true)
+	before := store.Get("default/app-tls")
+
+	rotated := newTestTLSSecret(t, "default", "app-tls", "app.example.com")
+	store.OnUpdate(original, rotated)
+	after := store.Get("default/app-tls")
+
+	if after == nil || after == before {
+		t.Fatalf("expected rotated certificate to replace the previous one")
+	}
+
+	broken := rotated.DeepCopy()
+	delete(broken.Data, corev1.TLSCertKey)
+	store.OnUpdate(rotated, broken)
+	if store.Get("default/app-tls") != after {
+		t.Errorf("expected invalid secret to keep the last good certificate")
+	}
+
+	store.OnDelete(broken)
+	if store.Get("default/app-tls") != nil {
+		t.Errorf("expected deleted secret to be removed")
+	}
+}
+
+func TestCertificateStoreLoadsNewlyReferencedSecrets(t *testing.T) {
+	secret := newTestTLSSecret(t, "default", "app-tls", "app.example.com")
+	store := NewCertificateStore(func(namespace, name string) (*corev1.Secret, error) {
+		return secret, nil
+	})
+
+	store.SetReferenced([]string{"default/app-tls"})
+	if store.Get("default/app-tls") == nil {
+		t.Errorf("expected newly referenced secret to be loaded")
+	}
+}
+
+func TestCertificateStoreTransform(t *testing.T) {
+	store := NewCertificateStore(nil)
+	store.SetReferenced([]string{"default/app-tls"})
+
+	kept, _ := store.Transform(newTestTLSSecret(t, "default", "app-tls", "app.example.com"))
+	if len(kept.(*corev1.Secret).Data) == 0 {
+		t.Errorf("expected referenced secret to keep its data")
+	}
+
+	stripped, _ := store.Transform(newTestTLSSecret(t, "default", "other-tls", "other.example.com"))
+	if stripped.(*corev1.Secret).Data != nil {
+		t.Errorf("expected unreferenced secret data to be dropped")
+	}
+}
+
+// secretKubeutils serves secret from the cluster stand-in.
+type secretKubeutils struct {
+	fakeKubeutils
+	secret *corev1.Secret
+}
+
+func (k secretKubeutils) GetResource(namespace, name, _ string) (any, error) {
+	if namespace != k.secret.Namespace || name != k.secret.Name {
+		return nil, fmt.Errorf("secret %s/%s not found", namespace, name)
+	}
+	return k.secret, nil
+}
+
+func TestUpdateFromIngressesLoadsUncachedSecrets(t *testing.T) {
+	secret := newTestTLSSecret(t, "default", "app-tls", "app.example.com")
+	rt := newRoutingTableWith(config.Config{IngressClass: "panacea"}, secretKubeutils{secret: secret})
+	t.Cleanup(rt.Clear)
+
+	ingress := newTestIngress("default", "app", time.Now(), "app.example.com",
+		testPath{"/", networkingv1.PathTypePrefix, "app"})
+	ingress.Spec.TLS = []networkingv1.IngressTLS{{Hosts: []string{"app.example.com"}, SecretName: "app-tls"}}
+
+	// Loading the Secret reloads the upstreams using it, which must not wait
+	// for the update that referenced it.
+	done := make(chan struct{})
+	go func() {
+		rt.UpdateFromIngresses([]*networkingv1.Ingress{ingress}, testClasses(t))
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("UpdateFromIngresses() did not return")
+	}
+
+	cert, err := rt.GetCertificate(&tls.ClientHelloInfo{ServerName: "app.example.com"})
+	if err != nil || cert != rt.certStore.Get("default/app-tls") || cert == nil {
+		t.Errorf("expected the certificate of the Secret to be served, got %v (%v)", cert, err)
+	}
+}
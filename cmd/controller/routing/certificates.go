@@ -0,0 +1,165 @@
+package routing
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// certificateTable maps SNI server names to the namespace/name key of the
+// Secret holding their certificate. Certificates themselves live in the
+// CertificateStore so that Secret rotations do not require a routing rebuild.
+// A table is never modified once it has been published by UpdateFromIngresses.
+type certificateTable struct {
+	exact    map[string]string
+	wildcard map[string]string // Keyed by the parent domain of "*.<domain>"
+	fallback string
+}
+
+func newCertificateTable(fallback string) *certificateTable {
+	return &certificateTable{
+		exact:    make(map[string]string),
+		wildcard: make(map[string]string),
+		fallback: fallback,
+	}
+}
+
+// add registers secretKey for host. The first Secret registered for a host wins.
+func (ct *certificateTable) add(host, secretKey string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" {
+		return false
+	}
+
+	target := ct.exact
+	if parent, ok := strings.CutPrefix(host, "*."); ok {
+		target = ct.wildcard
+		host = parent
+	}
+
+	if _, exists := target[host]; exists {
+		return false
+	}
+	target[host] = secretKey
+	return true
+}
+
+// lookup returns the Secret key for serverName, preferring an exact host
+// match over a wildcard one, and the fallback Secret otherwise.
+func (ct *certificateTable) lookup(serverName string) string {
+	name := strings.ToLower(strings.TrimSuffix(serverName, "."))
+
+	if key, ok := ct.exact[name]; ok {
+		return key
+	}
+
+	// A wildcard only covers a single leftmost label.
+	if _, parent, ok := strings.Cut(name, "."); ok {
+		if key, ok := ct.wildcard[parent]; ok {
+			return key
+		}
+	}
+
+	return ct.fallback
+}
+
+func (ct *certificateTable) len() int {
+	return len(ct.exact) + len(ct.wildcard)
+}
+
+// parseTLSSecret builds a certificate from a kubernetes.io/tls Secret.
+func parseTLSSecret(secret *corev1.Secret) (*tls.Certificate, error) {
+	if secret.Type != corev1.SecretTypeTLS {
+		return nil, fmt.Errorf("secret %s/%s has type %q, expected %q", secret.Namespace, secret.Name, secret.Type, corev1.SecretTypeTLS)
+	}
+
+	certPEM, ok := secret.Data[corev1.TLSCertKey]
+	if !ok || len(certPEM) == 0 {
+		return nil, fmt.Errorf("secret %s/%s has no %s", secret.Namespace, secret.Name, corev1.TLSCertKey)
+	}
+
+	keyPEM, ok := secret.Data[corev1.TLSPrivateKeyKey]
+	if !ok || len(keyPEM) == 0 {
+		return nil, fmt.Errorf("secret %s/%s has no %s", secret.Namespace, secret.Name, corev1.TLSPrivateKeyKey)
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing certificate from secret %s/%s: %v", secret.Namespace, secret.Name, err)
+	}
+
+	return &cert, nil
+}
+
+// caKey is the Secret key holding the CA bundle backends are verified
+// against, as written by cert-manager.
+const caKey = "ca.crt"
+
+// parseCASecret returns the CA bundle in the ca.crt key of secret, or nil
+// when there is none.
+func parseCASecret(secret *corev1.Secret) (*x509.CertPool, error) {
+	caPEM, ok := secret.Data[caKey]
+	if !ok || len(caPEM) == 0 {
+		return nil, nil
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("secret %s/%s has no valid certificate in %s", secret.Namespace, secret.Name, caKey)
+	}
+	return pool, nil
+}
+
+// newSelfSignedCertificate generates the certificate served when no Ingress
+// certificate matches and no default certificate Secret is configured.
+func newSelfSignedCertificate(hosts ...string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("error generating private key: %v", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("error generating serial number: %v", err)
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"Panacea Ingress Controller"},
+			CommonName:   "Panacea Ingress Controller Fake Certificate",
+		},
+		DNSNames:              hosts,
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating certificate: %v", err)
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing certificate: %v", err)
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
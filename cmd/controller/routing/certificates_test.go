@@ -0,0 +1,99 @@
+package routing
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newTestTLSSecret(t *testing.T, namespace, name string, hosts ...string) *corev1.Secret {
+	t.Helper()
+
+	cert, err := newSelfSignedCertificate(hosts...)
+	if err != nil {
+		t.Fatalf("newSelfSignedCertificate() returned an error: %v", err)
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey() returned an error: %v", err)
+	}
+
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Type:       corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}),
+			corev1.TLSPrivateKeyKey: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}),
+		},
+	}
+}
+
+func TestCertificateTableLookup(t *testing.T) {
+	table := newCertificateTable("default/fallback")
+	table.add("app.example.com", "default/app")
+	table.add("*.example.com", "default/wildcard")
+
+	tests := []struct {
+		serverName string
+		expected   string
+	}{
+		{"app.example.com", "default/app"},
+		{"APP.example.com.", "default/app"},
+		{"api.example.com", "default/wildcard"},
+		{"example.com", "default/fallback"},
+		{"a.b.example.com", "default/fallback"},
+		{"", "default/fallback"},
+	}
+
+	for _, test := range tests {
+		if got := table.lookup(test.serverName); got != test.expected {
+			t.Errorf("lookup(%q) = %q, expected %q", test.serverName, got, test.expected)
+		}
+	}
+}
+
+func TestCertificateTableFirstWins(t *testing.T) {
+	table := newCertificateTable("")
+	if !table.add("app.example.com", "default/first") {
+		t.Fatalf("expected first secret to be added")
+	}
+	if table.add("app.example.com", "default/second") {
+		t.Errorf("expected duplicate host to be rejected")
+	}
+	if got := table.lookup("app.example.com"); got != "default/first" {
+		t.Errorf("expected first secret to be served, got %q", got)
+	}
+}
+
+func TestParseTLSSecret(t *testing.T) {
+	t.Run("valid secret", func(t *testing.T) {
+		secret := newTestTLSSecret(t, "default", "app-tls", "app.example.com")
+		cert, err := parseTLSSecret(secret)
+		if err != nil {
+			t.Fatalf("parseTLSSecret() returned an error: %v", err)
+		}
+		if cert.Leaf == nil || cert.Leaf.VerifyHostname("app.example.com") != nil {
+			t.Errorf("expected certificate leaf for app.example.com")
+		}
+	})
+
+	t.Run("wrong type", func(t *testing.T) {
+		secret := newTestTLSSecret(t, "default", "app-tls", "app.example.com")
+		secret.Type = corev1.SecretTypeOpaque
+		if _, err := parseTLSSecret(secret); err == nil {
+			t.Errorf("expected an error for an Opaque secret")
+		}
+	})
+
+	t.Run("missing key", func(t *testing.T) {
+		secret := newTestTLSSecret(t, "default", "app-tls", "app.example.com")
+		delete(secret.Data, corev1.TLSPrivateKeyKey)
+		if _, err := parseTLSSecret(secret); err == nil {
+			t.Errorf("expected an error for a secret without a private key")
+		}
+	})
+}
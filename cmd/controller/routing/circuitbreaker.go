@@ -0,0 +1,91 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// errCircuitOpen is returned when an upstream is at its request limits.
+var errCircuitOpen = errors.New("circuit breaker open")
+
+// CircuitBreaker limits the requests sent to an upstream.
+type CircuitBreaker struct {
+	// MaxRequests is the number of requests in flight to the upstream.
+	MaxRequests int
+	// MaxPendingRequests is the number of requests allowed to wait for one of
+	// the MaxRequests slots. Requests over both limits fail straight away.
+	MaxPendingRequests int
+}
+
+type circuitBreaker struct {
+	config  CircuitBreaker
+	slots   chan struct{}
+	pending atomic.Int64
+}
+
+func newCircuitBreaker(config CircuitBreaker) *circuitBreaker {
+	return &circuitBreaker{
+		config: config,
+		slots:  make(chan struct{}, config.MaxRequests),
+	}
+}
+
+// acquire takes a request slot, waiting for one while there is room in the
+// pending queue. The returned function releases the slot.
+func (b *circuitBreaker) acquire(ctx context.Context) (func(), error) {
+	select {
+	case b.slots <- struct{}{}:
+		return b.release, nil
+	default:
+	}
+
+	if b.pending.Add(1) > int64(b.config.MaxPendingRequests) {
+		b.pending.Add(-1)
+		return nil, errCircuitOpen
+	}
+	defer b.pending.Add(-1)
+
+	select {
+	case b.slots <- struct{}{}:
+		return b.release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (b *circuitBreaker) release() {
+	<-b.slots
+}
+
+// acquire takes a request slot from the circuit breaker of the upstream.
+func (u *Upstream) acquire(ctx context.Context) (func(), error) {
+	breaker := u.breaker.Load()
+	if breaker == nil {
+		return func() {}, nil
+	}
+	return breaker.acquire(ctx)
+}
+
+// CircuitBreaker returns the request limits of the upstream, or nil.
+func (u *Upstream) CircuitBreaker() *CircuitBreaker {
+	breaker := u.breaker.Load()
+	if breaker == nil {
+		return nil
+	}
+	config := breaker.config
+	return &config
+}
+
+// SetCircuitBreaker sets the request limits of the upstream. Limits are off
+// when config is nil or MaxRequests is not positive.
+func (u *Upstream) SetCircuitBreaker(config *CircuitBreaker) {
+	if config == nil || config.MaxRequests <= 0 {
+		u.breaker.Store(nil)
+		return
+	}
+	if current := u.breaker.Load(); current != nil && current.config == *config {
+		return
+	}
+	u.breaker.Store(newCircuitBreaker(*config))
+}
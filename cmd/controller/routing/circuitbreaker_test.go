@@ -0,0 +1,107 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+func TestCircuitBreakerAcquire(t *testing.T) {
+	breaker := newCircuitBreaker(CircuitBreaker{MaxRequests: 1, MaxPendingRequests: 1})
+
+	release, err := breaker.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire() returned an error: %v", err)
+	}
+
+	acquired := make(chan error)
+	go func() {
+		release, err := breaker.acquire(context.Background())
+		if err == nil {
+			release()
+		}
+		acquired <- err
+	}()
+
+	waitFor(t, func() bool { return breaker.pending.Load() == 1 })
+
+	if _, err := breaker.acquire(context.Background()); !errors.Is(err, errCircuitOpen) {
+		t.Errorf("expected the circuit to be open with a full pending queue, got %v", err)
+	}
+
+	release()
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Errorf("expected the pending request to get the slot, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for the pending request")
+	}
+
+	t.Run("pending request gives up with its context", func(t *testing.T) {
+		release, err := breaker.acquire(context.Background())
+		if err != nil {
+			t.Fatalf("acquire() returned an error: %v", err)
+		}
+		defer release()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if _, err := breaker.acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+		}
+		if breaker.pending.Load() != 0 {
+			t.Errorf("expected an empty pending queue, got %d", breaker.pending.Load())
+		}
+	})
+}
+
+func TestRouteTransportCircuitBreaker(t *testing.T) {
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}))
+	defer server.Close()
+
+	upstream := newUpstream("default", "web", networkingv1.ServiceBackendPort{Number: 80}, false)
+	upstream.SetEndpoints([]*Endpoint{testEndpoint(t, server.URL)})
+	upstream.SetCircuitBreaker(&CircuitBreaker{MaxRequests: 1})
+	transport := &routeTransport{upstream: upstream, balancer: &roundRobin{}}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		req := httptest.NewRequest(http.MethodGet, "http://web.default.svc.cluster.local/", nil)
+		req.RequestURI = ""
+		if resp, err := transport.RoundTrip(req); err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	breaker := upstream.breaker.Load()
+	waitFor(t, func() bool { return len(breaker.slots) == 1 })
+
+	req := httptest.NewRequest(http.MethodGet, "http://web.default.svc.cluster.local/", nil)
+	req.RequestURI = ""
+	if _, err := transport.RoundTrip(req); !errors.Is(err, errCircuitOpen) {
+		t.Errorf("expected the second request to fail fast, got %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	proxyErrorHandler(rec, req, errCircuitOpen)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+
+	close(unblock)
+	<-done
+	if len(breaker.slots) != 0 {
+		t.Errorf("expected the slot to be released once the response is closed")
+	}
+}
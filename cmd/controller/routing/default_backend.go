@@ -0,0 +1,80 @@
+package routing
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ParseServiceBackend parses a Service reference of the form
+// namespace/name:port, where port is a port number or name.
+func ParseServiceBackend(value string) (string, *networkingv1.IngressServiceBackend, error) {
+	namespace, rest, ok := strings.Cut(value, "/")
+	if !ok || namespace == "" {
+		return "", nil, fmt.Errorf("error parsing service %q: expected namespace/name:port", value)
+	}
+	name, port, ok := strings.Cut(rest, ":")
+	if !ok || name == "" || port == "" {
+		return "", nil, fmt.Errorf("error parsing service %q: expected namespace/name:port", value)
+	}
+
+	backend := &networkingv1.IngressServiceBackend{Name: name}
+	if number, err := strconv.ParseInt(port, 10, 32); err == nil {
+		if number <= 0 || number > 65535 {
+			return "", nil, fmt.Errorf("error parsing service %q: invalid port %d", value, number)
+		}
+		backend.Port.Number = int32(number)
+	} else {
+		backend.Port.Name = port
+	}
+	return namespace, backend, nil
+}
+
+// ingressHosts returns the hosts of the rules of ingress the default backend
+// of the Ingress serves. An Ingress without rules serves every host that no
+// rule claims.
+func ingressHosts(ingress *networkingv1.Ingress) []string {
+	if len(ingress.Spec.Rules) == 0 {
+		return []string{""}
+	}
+
+	var hosts []string
+	for _, rule := range ingress.Spec.Rules {
+		if !slices.Contains(hosts, rule.Host) {
+			hosts = append(hosts, rule.Host)
+		}
+	}
+	return hosts
+}
+
+// fallbackRoute returns the route of the --default-backend-service, which
+// serves the requests no Ingress matches. Its upstream takes the
+// controller-wide settings.
+func (rt *routingTable) fallbackRoute(upstreams map[string]*Upstream, domain string) *Route {
+	if rt.config.DefaultBackendService == "" {
+		return nil
+	}
+
+	namespace, svc, err := ParseServiceBackend(rt.config.DefaultBackendService)
+	if err != nil {
+		l.Info("Ignoring invalid default backend service", "error", err)
+		return nil
+	}
+
+	route := &Route{
+		Path:      "/",
+		PathType:  string(networkingv1.PathTypePrefix),
+		Default:   true,
+		Namespace: namespace,
+	}
+	ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: namespace}}
+	if !rt.proxyRoute(route, upstreams, ingress, networkingv1.IngressBackend{Service: svc}, domain) {
+		l.Info("Skipping default backend service", "service", rt.config.DefaultBackendService)
+		return nil
+	}
+	return route
+}
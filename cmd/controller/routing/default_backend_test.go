@@ -0,0 +1,134 @@
+package routing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/danCrespo/panacea-ingress-controller/config"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+func TestParseServiceBackend(t *testing.T) {
+	tests := []struct {
+		value     string
+		namespace string
+		name      string
+		number    int32
+		portName  string
+		wantErr   bool
+	}{
+		{value: "default/fallback:80", namespace: "default", name: "fallback", number: 80},
+		{value: "errors/pages:http", namespace: "errors", name: "pages", portName: "http"},
+		{value: "fallback:80", wantErr: true},
+		{value: "default/fallback", wantErr: true},
+		{value: "/fallback:80", wantErr: true},
+		{value: "default/:80", wantErr: true},
+		{value: "default/fallback:", wantErr: true},
+		{value: "default/fallback:0", wantErr: true},
+		{value: "default/fallback:70000", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			namespace, backend, err := ParseServiceBackend(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got %s/%+v", namespace, backend)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if namespace != tt.namespace || backend.Name != tt.name || backend.Port.Number != tt.number || backend.Port.Name != tt.portName {
+				t.Errorf("Expected %s/%s:%d%s, got %s/%s:%d%s", tt.namespace, tt.name, tt.number, tt.portName, namespace, backend.Name, backend.Port.Number, backend.Port.Name)
+			}
+		})
+	}
+}
+
+func withDefaultBackend(ingress *networkingv1.Ingress, service string) *networkingv1.Ingress {
+	ingress.Spec.DefaultBackend = &networkingv1.IngressBackend{
+		Service: &networkingv1.IngressServiceBackend{
+			Name: service,
+			Port: networkingv1.ServiceBackendPort{Number: 80},
+		},
+	}
+	return ingress
+}
+
+func TestRoutingTableDefaultBackends(t *testing.T) {
+	now := time.Now()
+	ingresses := []*networkingv1.Ingress{
+		withDefaultBackend(newTestIngress("default", "app", now, "app.example.com",
+			testPath{"/api", networkingv1.PathTypePrefix, "api"}), "app-default"),
+		// A newer Ingress of the same host does not take over its default backend.
+		withDefaultBackend(newTestIngress("default", "newer", now.Add(time.Minute), "app.example.com",
+			testPath{"/", networkingv1.PathTypeExact, "home"}), "newer-default"),
+		newTestIngress("default", "other", now, "other.example.com",
+			testPath{"/api", networkingv1.PathTypePrefix, "other"}),
+	}
+	rulesOnly := withDefaultBackend(newTestIngress("default", "rules-only", now, ""), "catch-all")
+	rulesOnly.Spec.Rules = nil
+
+	tests := []struct {
+		name     string
+		fallback string
+		extra    []*networkingv1.Ingress
+		host     string
+		path     string
+		expected string
+	}{
+		{name: "path wins", host: "app.example.com", path: "/api/users", expected: "api"},
+		{name: "exact path wins", host: "app.example.com", path: "/", expected: "home"},
+		{name: "ingress default", host: "app.example.com", path: "/static", expected: "app-default"},
+		{name: "other host", host: "other.example.com", path: "/static", expected: ""},
+		{name: "unknown host", host: "unknown.example.com", path: "/", expected: ""},
+		{name: "global default", fallback: "errors/pages:80", host: "other.example.com", path: "/static", expected: "pages"},
+		{name: "global default for unknown host", fallback: "errors/pages:80", host: "unknown.example.com", path: "/", expected: "pages"},
+		{name: "ingress default before global", fallback: "errors/pages:80", host: "app.example.com", path: "/static", expected: "app-default"},
+		{name: "invalid global default", fallback: "pages", host: "unknown.example.com", path: "/", expected: ""},
+		{name: "ingress without rules", extra: []*networkingv1.Ingress{rulesOnly}, host: "unknown.example.com", path: "/", expected: "catch-all"},
+		{name: "ingress without rules before global", fallback: "errors/pages:80", extra: []*networkingv1.Ingress{rulesOnly}, host: "unknown.example.com", path: "/", expected: "catch-all"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := newRoutingTableWith(config.Config{IngressClass: "panacea", DefaultBackendService: tt.fallback}, fakeKubeutils{})
+			t.Cleanup(rt.Clear)
+			rt.UpdateFromIngresses(append(append([]*networkingv1.Ingress{}, ingresses...), tt.extra...), testClasses(t))
+
+			route := rt.Match(tt.host, tt.path)
+			got := ""
+			if route != nil {
+				got = route.Upstream.Service
+			}
+			if got != tt.expected {
+				t.Errorf("Match(%q, %q): expected service %q, got %q", tt.host, tt.path, tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDefaultBackendRoutesPerHost(t *testing.T) {
+	rt := newRoutingTableWith(config.Config{IngressClass: "panacea"}, fakeKubeutils{})
+	t.Cleanup(rt.Clear)
+
+	ingress := withDefaultBackend(newTestIngress("default", "app", time.Now(), "app.example.com"), "app-default")
+	ingress.Spec.Rules = append(ingress.Spec.Rules, networkingv1.IngressRule{Host: "www.example.com"})
+
+	hosts := 0
+	for _, route := range rt.RoutesFor(ingress) {
+		if !route.Default {
+			continue
+		}
+		hosts++
+		// The metrics and the access log take the host of the transport.
+		if transport := route.Proxy.Transport.(*routeTransport); transport.route != route {
+			t.Errorf("Expected the proxy of host %q to carry its route, got host %q", route.Host, transport.route.Host)
+		}
+	}
+	if hosts != 2 {
+		t.Errorf("Expected a default backend route per host, got %d", hosts)
+	}
+}
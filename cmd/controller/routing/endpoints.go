@@ -0,0 +1,290 @@
+package routing
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Endpoint is a single address serving a Service port. Endpoint values are
+// reused across EndpointSlice updates for as long as the address stays ready,
+// so per-endpoint state survives pods coming and going around it.
+type Endpoint struct {
+	Address  string
+	Port     int32
+	NodeName string
+	Zone     string
+	PodName  string
+
+	active    atomic.Int64
+	latency   atomic.Uint64 // float64 bits of the latency moving average in seconds
+	unhealthy atomic.Bool
+	successes atomic.Int32 // Consecutive successful probes
+	failures  atomic.Int32 // Consecutive failed probes
+
+	consecutiveErrors atomic.Int32
+	ejectedUntil      atomic.Int64 // Unix nanoseconds
+	ejections         int          // Guarded by the outlierMu of the upstream
+}
+
+// ewmaDecay is the weight of the previous average in the latency EWMA.
+const ewmaDecay = 0.7
+
+// Host returns the host:port the endpoint is dialed on.
+func (e *Endpoint) Host() string {
+	return net.JoinHostPort(e.Address, strconv.Itoa(int(e.Port)))
+}
+
+func (e *Endpoint) String() string {
+	return e.Host()
+}
+
+// Active returns the number of requests in flight to the endpoint.
+func (e *Endpoint) Active() int64 {
+	return e.active.Load()
+}
+
+// Healthy reports whether the endpoint passes its health checks. Endpoints
+// are healthy until probes say otherwise.
+func (e *Endpoint) Healthy() bool {
+	return !e.unhealthy.Load()
+}
+
+// recordProbe records the result of a health check probe and reports whether
+// the endpoint changed between healthy and unhealthy.
+func (e *Endpoint) recordProbe(ok bool, config HealthCheck) bool {
+	if ok {
+		e.failures.Store(0)
+		if e.successes.Add(1) >= int32(config.HealthyThreshold) {
+			return e.unhealthy.CompareAndSwap(true, false)
+		}
+		return false
+	}
+
+	e.successes.Store(0)
+	if e.failures.Add(1) >= int32(config.UnhealthyThreshold) {
+		return e.unhealthy.CompareAndSwap(false, true)
+	}
+	return false
+}
+
+// resetHealth marks the endpoint healthy and forgets past probes.
+func (e *Endpoint) resetHealth() {
+	e.unhealthy.Store(false)
+	e.successes.Store(0)
+	e.failures.Store(0)
+}
+
+// Latency returns the moving average of the time to response headers, in
+// seconds. It is zero until the first response.
+func (e *Endpoint) Latency() float64 {
+	return math.Float64frombits(e.latency.Load())
+}
+
+func (e *Endpoint) observeLatency(d time.Duration) {
+	sample := d.Seconds()
+	for {
+		old := e.latency.Load()
+		avg := math.Float64frombits(old)
+		if avg == 0 {
+			avg = sample
+		} else {
+			avg = avg*ewmaDecay + sample*(1-ewmaDecay)
+		}
+		if e.latency.CompareAndSwap(old, math.Float64bits(avg)) {
+			return
+		}
+	}
+}
+
+// EndpointResolver resolves Service backends to the ready addresses listed in
+// their EndpointSlices.
+type EndpointResolver struct {
+	services corelisters.ServiceLister
+	slices   discoverylisters.EndpointSliceLister
+}
+
+func NewEndpointResolver(services corelisters.ServiceLister, slices discoverylisters.EndpointSliceLister) *EndpointResolver {
+	return &EndpointResolver{
+		services: services,
+		slices:   slices,
+	}
+}
+
+// ServicePort returns the port of Service namespace/name that port refers to,
+// either by number or by name.
+func (r *EndpointResolver) ServicePort(namespace, name string, port networkingv1.ServiceBackendPort) (*corev1.Service, *corev1.ServicePort, error) {
+	svc, err := r.services.Services(namespace).Get(name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error getting service %s/%s: %v", namespace, name, err)
+	}
+
+	for i := range svc.Spec.Ports {
+		sp := &svc.Spec.Ports[i]
+		if (port.Number != 0 && sp.Port == port.Number) || (port.Name != "" && sp.Name == port.Name) {
+			return svc, sp, nil
+		}
+	}
+
+	return svc, nil, fmt.Errorf("port %s not found in service %s/%s", backendPortString(port), namespace, name)
+}
+
+// Resolve returns the ready endpoints serving port of Service namespace/name.
+// The port number of each endpoint comes from the EndpointSlice, so numeric
+// and named targetPorts are both honoured.
+func (r *EndpointResolver) Resolve(namespace, name string, port networkingv1.ServiceBackendPort) ([]*Endpoint, error) {
+	_, sp, err := r.ServicePort(namespace, name, port)
+	if err != nil {
+		return nil, err
+	}
+
+	slices, err := r.slices.EndpointSlices(namespace).List(labels.SelectorFromSet(labels.Set{
+		discoveryv1.LabelServiceName: name,
+	}))
+	if err != nil {
+		return nil, fmt.Errorf("error listing endpointslices for service %s/%s: %v", namespace, name, err)
+	}
+
+	seen := make(map[string]struct{})
+	endpoints := make([]*Endpoint, 0)
+
+	for _, slice := range slices {
+		if slice.AddressType != discoveryv1.AddressTypeIPv4 && slice.AddressType != discoveryv1.AddressTypeIPv6 {
+			continue
+		}
+
+		portNumber, ok := slicePort(slice, sp)
+		if !ok {
+			continue
+		}
+
+		for _, ep := range slice.Endpoints {
+			if ep.Conditions.Ready != nil && !*ep.Conditions.Ready {
+				continue
+			}
+
+			for _, address := range ep.Addresses {
+				endpoint := &Endpoint{
+					Address: address,
+					Port:    portNumber,
+				}
+				if ep.NodeName != nil {
+					endpoint.NodeName = *ep.NodeName
+				}
+				if ep.Zone != nil {
+					endpoint.Zone = *ep.Zone
+				}
+				if ep.TargetRef != nil && ep.TargetRef.Kind == "Pod" {
+					endpoint.PodName = ep.TargetRef.Name
+				}
+
+				if _, dup := seen[endpoint.Host()]; dup {
+					continue
+				}
+				seen[endpoint.Host()] = struct{}{}
+				endpoints = append(endpoints, endpoint)
+			}
+		}
+	}
+
+	return endpoints, nil
+}
+
+// slicePort returns the port number the slice lists for the Service port sp.
+// EndpointSlice ports carry the name of the Service port they implement.
+func slicePort(slice *discoveryv1.EndpointSlice, sp *corev1.ServicePort) (int32, bool) {
+	spProtocol := sp.Protocol
+	if spProtocol == "" {
+		spProtocol = corev1.ProtocolTCP
+	}
+
+	for _, p := range slice.Ports {
+		name := ""
+		if p.Name != nil {
+			name = *p.Name
+		}
+		protocol := corev1.ProtocolTCP
+		if p.Protocol != nil {
+			protocol = *p.Protocol
+		}
+
+		if name == sp.Name && protocol == spProtocol && p.Port != nil {
+			return *p.Port, true
+		}
+	}
+	return 0, false
+}
+
+func backendPortString(port networkingv1.ServiceBackendPort) string {
+	if port.Name != "" {
+		return port.Name
+	}
+	return strconv.Itoa(int(port.Number))
+}
+
+// endpointsHandler refreshes the upstreams of a Service whenever the Service
+// or one of its EndpointSlices changes.
+type endpointsHandler struct {
+	refresh func(namespace, service string)
+}
+
+var _ cache.ResourceEventHandler = (*endpointsHandler)(nil)
+
+func (h *endpointsHandler) handle(obj any) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	switch o := obj.(type) {
+	case *discoveryv1.EndpointSlice:
+		if name := o.Labels[discoveryv1.LabelServiceName]; name != "" {
+			h.refresh(o.Namespace, name)
+		}
+	case *corev1.Service:
+		h.refresh(o.Namespace, o.Name)
+	}
+}
+
+// OnAdd implements cache.ResourceEventHandler.
+func (h *endpointsHandler) OnAdd(obj any, _ bool) {
+	h.handle(obj)
+}
+
+// OnUpdate implements cache.ResourceEventHandler.
+func (h *endpointsHandler) OnUpdate(oldObj, newObj any) {
+	if resynced(oldObj, newObj) {
+		return
+	}
+	h.handle(newObj)
+}
+
+// resynced reports whether an update is the periodic replay of an unchanged
+// object by its informer.
+func resynced(oldObj, newObj any) bool {
+	oldMeta, err := meta.Accessor(oldObj)
+	if err != nil {
+		return false
+	}
+	newMeta, err := meta.Accessor(newObj)
+	if err != nil {
+		return false
+	}
+	return oldMeta.GetResourceVersion() != "" && oldMeta.GetResourceVersion() == newMeta.GetResourceVersion()
+}
+
+// OnDelete implements cache.ResourceEventHandler.
+func (h *endpointsHandler) OnDelete(obj any) {
+	h.handle(obj)
+}
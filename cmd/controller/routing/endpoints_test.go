@@ -0,0 +1,132 @@
+package routing
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func newTestResolver(t *testing.T, objects ...any) *EndpointResolver {
+	t.Helper()
+
+	services := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	slices := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+
+	for _, obj := range objects {
+		var err error
+		switch obj.(type) {
+		case *corev1.Service:
+			err = services.Add(obj)
+		case *discoveryv1.EndpointSlice:
+			err = slices.Add(obj)
+		}
+		if err != nil {
+			t.Fatalf("error adding object to indexer: %v", err)
+		}
+	}
+
+	return NewEndpointResolver(corelisters.NewServiceLister(services), discoverylisters.NewEndpointSliceLister(slices))
+}
+
+func newTestService(namespace, name string, ports ...corev1.ServicePort) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec:       corev1.ServiceSpec{Ports: ports},
+	}
+}
+
+func newTestEndpointSlice(namespace, service, portName string, port int32, ready map[string]bool) *discoveryv1.EndpointSlice {
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      service + "-" + portName,
+			Labels:    map[string]string{discoveryv1.LabelServiceName: service},
+		},
+		AddressType: discoveryv1.AddressTypeIPv4,
+		Ports: []discoveryv1.EndpointPort{{
+			Name: &portName,
+			Port: &port,
+		}},
+	}
+
+	for address, isReady := range ready {
+		slice.Endpoints = append(slice.Endpoints, discoveryv1.Endpoint{
+			Addresses:  []string{address},
+			Conditions: discoveryv1.EndpointConditions{Ready: &isReady},
+		})
+	}
+	return slice
+}
+
+func TestEndpointResolverResolve(t *testing.T) {
+	resolver := newTestResolver(t,
+		newTestService("default", "web",
+			corev1.ServicePort{Name: "http", Port: 80, TargetPort: intstr.FromString("web"), Protocol: corev1.ProtocolTCP},
+			corev1.ServicePort{Name: "admin", Port: 9000, TargetPort: intstr.FromInt32(9090), Protocol: corev1.ProtocolTCP},
+		),
+		newTestEndpointSlice("default", "web", "http", 8080, map[string]bool{"10.0.0.1": true, "10.0.0.2": false}),
+		newTestEndpointSlice("default", "web", "admin", 9090, map[string]bool{"10.0.0.1": true}),
+	)
+
+	tests := []struct {
+		name     string
+		port     networkingv1.ServiceBackendPort
+		expected []string
+	}{
+		{"by number with named targetPort", networkingv1.ServiceBackendPort{Number: 80}, []string{"10.0.0.1:8080"}},
+		{"by name", networkingv1.ServiceBackendPort{Name: "admin"}, []string{"10.0.0.1:9090"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			endpoints, err := resolver.Resolve("default", "web", test.port)
+			if err != nil {
+				t.Fatalf("Resolve() returned an error: %v", err)
+			}
+
+			if len(endpoints) != len(test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, endpoints)
+			}
+			for i, ep := range endpoints {
+				if ep.Host() != test.expected[i] {
+					t.Errorf("expected %s, got %s", test.expected[i], ep.Host())
+				}
+			}
+		})
+	}
+
+	if _, err := resolver.Resolve("default", "web", networkingv1.ServiceBackendPort{Number: 443}); err == nil {
+		t.Errorf("expected an error for an unknown service port")
+	}
+	if _, err := resolver.Resolve("default", "missing", networkingv1.ServiceBackendPort{Number: 80}); err == nil {
+		t.Errorf("expected an error for an unknown service")
+	}
+}
+
+func TestEndpointsHandlerSkipsResyncs(t *testing.T) {
+	var refreshed []string
+	handler := &endpointsHandler{refresh: func(namespace, service string) {
+		refreshed = append(refreshed, namespace+"/"+service)
+	}}
+
+	service := func(resourceVersion string) *corev1.Service {
+		return &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app", ResourceVersion: resourceVersion}}
+	}
+
+	handler.OnUpdate(service("1"), service("1"))
+	if len(refreshed) != 0 {
+		t.Errorf("Expected a resync not to refresh endpoints, got %v", refreshed)
+	}
+
+	handler.OnUpdate(service("1"), service("2"))
+	if len(refreshed) != 1 || refreshed[0] != "default/app" {
+		t.Errorf("Expected an update to refresh default/app, got %v", refreshed)
+	}
+}
@@ -0,0 +1,95 @@
+package routing
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// HealthCheck configures the active probing of the endpoints of an upstream.
+type HealthCheck struct {
+	// Path is requested on every endpoint. Probing is off when it is empty.
+	Path     string
+	Interval time.Duration
+	Timeout  time.Duration
+	// HealthyThreshold is the number of consecutive successful probes that
+	// bring an ejected endpoint back.
+	HealthyThreshold int
+	// UnhealthyThreshold is the number of consecutive failed probes that
+	// eject an endpoint.
+	UnhealthyThreshold int
+}
+
+// healthChecker probes the endpoints of an upstream until stopped.
+type healthChecker struct {
+	upstream *Upstream
+	config   HealthCheck
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func newHealthChecker(upstream *Upstream, config HealthCheck) *healthChecker {
+	return &healthChecker{
+		upstream: upstream,
+		config:   config,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+func (hc *healthChecker) run() {
+	defer close(hc.done)
+
+	ticker := time.NewTicker(hc.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		hc.probeAll()
+
+		select {
+		case <-hc.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// close stops the checker and waits for the probes in progress.
+func (hc *healthChecker) close() {
+	close(hc.stop)
+	<-hc.done
+}
+
+func (hc *healthChecker) probeAll() {
+	var wg sync.WaitGroup
+	for _, ep := range hc.upstream.Endpoints() {
+		wg.Go(func() {
+			if ep.recordProbe(hc.probe(ep), hc.config) {
+				l.Info("Endpoint health changed", "upstream", hc.upstream.Key(), "endpoint", ep.Host(), "healthy", ep.Healthy())
+				hc.upstream.refreshAvailable()
+			}
+		})
+	}
+	wg.Wait()
+}
+
+// probe reports whether ep answered the health check path with a 2xx or 3xx.
+func (hc *healthChecker) probe(ep *Endpoint) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), hc.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, hc.upstream.scheme()+"://"+ep.Host()+hc.config.Path, nil)
+	if err != nil {
+		return false
+	}
+	req.Header.Set("User-Agent", "panacea-controller/health-check")
+
+	resp, err := hc.upstream.transport.Load().RoundTrip(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode >= 200 && resp.StatusCode < 400
+}
@@ -0,0 +1,106 @@
+package routing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+func TestEndpointRecordProbe(t *testing.T) {
+	config := HealthCheck{HealthyThreshold: 2, UnhealthyThreshold: 3}
+	ep := &Endpoint{Address: "10.0.0.1", Port: 8080}
+
+	results := []struct {
+		ok      bool
+		healthy bool
+		changed bool
+	}{
+		{false, true, false},
+		{false, true, false},
+		{true, true, false}, // A success resets the failure count
+		{false, true, false},
+		{false, true, false},
+		{false, false, true},
+		{true, false, false},
+		{true, true, true},
+	}
+
+	for i, r := range results {
+		changed := ep.recordProbe(r.ok, config)
+		if changed != r.changed || ep.Healthy() != r.healthy {
+			t.Errorf("probe %d: expected healthy=%v changed=%v, got healthy=%v changed=%v", i, r.healthy, r.changed, ep.Healthy(), changed)
+		}
+	}
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition not met before deadline")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestUpstreamHealthCheck(t *testing.T) {
+	var failing atomic.Bool
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			t.Errorf("unexpected probe path %s", r.URL.Path)
+		}
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer bad.Close()
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer good.Close()
+
+	upstream := newUpstream("default", "web", networkingv1.ServiceBackendPort{Number: 80}, false)
+	upstream.SetEndpoints([]*Endpoint{testEndpoint(t, bad.URL), testEndpoint(t, good.URL)})
+	defer upstream.Close()
+
+	failing.Store(true)
+	upstream.SetHealthCheck(&HealthCheck{
+		Path:               "/healthz",
+		Interval:           10 * time.Millisecond,
+		Timeout:            time.Second,
+		HealthyThreshold:   1,
+		UnhealthyThreshold: 2,
+	})
+
+	waitFor(t, func() bool { return len(upstream.Available()) == 1 })
+	if upstream.Available()[0].Host() != testEndpoint(t, good.URL).Host() {
+		t.Errorf("expected only the good endpoint to be available, got %v", upstream.Available())
+	}
+
+	failing.Store(false)
+	waitFor(t, func() bool { return len(upstream.Available()) == 2 })
+
+	failing.Store(true)
+	waitFor(t, func() bool { return len(upstream.Available()) == 1 })
+	upstream.SetHealthCheck(nil)
+	if len(upstream.Available()) != 2 {
+		t.Errorf("expected every endpoint to be available once health checks are off")
+	}
+}
+
+func TestUpstreamAvailableFailsOpen(t *testing.T) {
+	upstream := newUpstream("default", "web", networkingv1.ServiceBackendPort{Number: 80}, false)
+	endpoints := testEndpoints(2)
+	for _, ep := range endpoints {
+		ep.unhealthy.Store(true)
+	}
+
+	upstream.SetEndpoints(endpoints)
+	if len(upstream.Available()) != 2 {
+		t.Errorf("expected all endpoints to be used when none is healthy, got %v", upstream.Available())
+	}
+}
@@ -0,0 +1,71 @@
+package routing
+
+import (
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	networkinglisters "k8s.io/client-go/listers/networking/v1"
+)
+
+const (
+	// AnnotationIngressClass is the legacy annotation naming the class of an
+	// Ingress, predating spec.ingressClassName.
+	AnnotationIngressClass = "kubernetes.io/ingress.class"
+	// AnnotationDefaultIngressClass marks the IngressClass of the Ingresses
+	// that name no class.
+	AnnotationDefaultIngressClass = "ingressclass.kubernetes.io/is-default-class"
+)
+
+// IngressClassMatcher decides which Ingresses belong to the controller.
+type IngressClassMatcher interface {
+	Matches(ingress *networkingv1.Ingress) bool
+}
+
+// IngressClasses matches the Ingresses of the IngressClasses whose
+// spec.controller is the controller name. Ingresses without a class belong
+// to the IngressClass marked as default, if it is ours. The legacy
+// kubernetes.io/ingress.class annotation may name one of our IngressClasses
+// or the legacy class name.
+type IngressClasses struct {
+	lister     networkinglisters.IngressClassLister
+	controller string
+	legacy     string
+}
+
+func NewIngressClasses(lister networkinglisters.IngressClassLister, controller, legacyClass string) *IngressClasses {
+	return &IngressClasses{
+		lister:     lister,
+		controller: controller,
+		legacy:     legacyClass,
+	}
+}
+
+func (c *IngressClasses) Matches(ingress *networkingv1.Ingress) bool {
+	if name := ingress.Spec.IngressClassName; name != nil {
+		return c.owns(*name)
+	}
+	if name, ok := ingress.Annotations[AnnotationIngressClass]; ok {
+		return (c.legacy != "" && name == c.legacy) || c.owns(name)
+	}
+	return c.ownsDefault()
+}
+
+// owns reports whether the IngressClass name is ours.
+func (c *IngressClasses) owns(name string) bool {
+	class, err := c.lister.Get(name)
+	return err == nil && class.Spec.Controller == c.controller
+}
+
+// ownsDefault reports whether the default IngressClass is ours.
+func (c *IngressClasses) ownsDefault() bool {
+	classes, err := c.lister.List(labels.Everything())
+	if err != nil {
+		l.Info("Error listing ingress classes", "error", err)
+		return false
+	}
+	for _, class := range classes {
+		if class.Spec.Controller == c.controller && class.Annotations[AnnotationDefaultIngressClass] == "true" {
+			return true
+		}
+	}
+	return false
+}
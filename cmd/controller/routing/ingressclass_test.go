@@ -0,0 +1,82 @@
+package routing
+
+import (
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	networkinglisters "k8s.io/client-go/listers/networking/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const testController = "panacea.io/ingress-controller"
+
+func newTestIngressClass(name, controller string, isDefault bool) *networkingv1.IngressClass {
+	class := &networkingv1.IngressClass{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       networkingv1.IngressClassSpec{Controller: controller},
+	}
+	if isDefault {
+		class.Annotations = map[string]string{AnnotationDefaultIngressClass: "true"}
+	}
+	return class
+}
+
+func newTestIngressClasses(tb testing.TB, classes ...*networkingv1.IngressClass) *IngressClasses {
+	tb.Helper()
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, class := range classes {
+		if err := indexer.Add(class); err != nil {
+			tb.Fatalf("Error adding ingress class: %v", err)
+		}
+	}
+	return NewIngressClasses(networkinglisters.NewIngressClassLister(indexer), testController, "legacy")
+}
+
+// testClasses matches the Ingresses of the panacea IngressClass.
+func testClasses(tb testing.TB) *IngressClasses {
+	return newTestIngressClasses(tb, newTestIngressClass("panacea", testController, false))
+}
+
+func TestIngressClassesMatches(t *testing.T) {
+	ours := newTestIngressClass("panacea", testController, false)
+	theirs := newTestIngressClass("nginx", "k8s.io/ingress-nginx", false)
+	oursDefault := newTestIngressClass("panacea-default", testController, true)
+	theirsDefault := newTestIngressClass("nginx-default", "k8s.io/ingress-nginx", true)
+
+	tests := []struct {
+		name       string
+		classes    []*networkingv1.IngressClass
+		className  string
+		annotation string
+		expected   bool
+	}{
+		{name: "our class", classes: []*networkingv1.IngressClass{ours, theirs}, className: "panacea", expected: true},
+		{name: "another controller's class", classes: []*networkingv1.IngressClass{ours, theirs}, className: "nginx", expected: false},
+		{name: "unknown class", classes: []*networkingv1.IngressClass{ours}, className: "missing", expected: false},
+		{name: "legacy class name", classes: []*networkingv1.IngressClass{theirs}, annotation: "legacy", expected: true},
+		{name: "legacy annotation naming our class", classes: []*networkingv1.IngressClass{ours}, annotation: "panacea", expected: true},
+		{name: "legacy annotation naming another class", classes: []*networkingv1.IngressClass{ours, theirs}, annotation: "nginx", expected: false},
+		{name: "spec class over annotation", classes: []*networkingv1.IngressClass{ours, theirs}, className: "nginx", annotation: "legacy", expected: false},
+		{name: "our default class", classes: []*networkingv1.IngressClass{oursDefault, theirs}, expected: true},
+		{name: "another controller's default class", classes: []*networkingv1.IngressClass{ours, theirsDefault}, expected: false},
+		{name: "no default class", classes: []*networkingv1.IngressClass{ours, theirs}, expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ingress := &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"}}
+			if tt.className != "" {
+				ingress.Spec.IngressClassName = &tt.className
+			}
+			if tt.annotation != "" {
+				ingress.Annotations = map[string]string{AnnotationIngressClass: tt.annotation}
+			}
+
+			if got := newTestIngressClasses(t, tt.classes...).Matches(ingress); got != tt.expected {
+				t.Errorf("Expected Matches to be %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package routing
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+// lookupHost returns the routes of the rules for host: those of the exact
+// host, else those of the wildcard host covering its leftmost label, else the
+// catch-all rules without a host. Paths are not looked up in less specific
+// rules once a host has rules, as with virtual hosts.
+func lookupHost[T any](data map[string]T, host string) T {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	if routes, ok := data[host]; ok {
+		return routes
+	}
+	if _, parent, ok := strings.Cut(host, "."); ok && parent != "" {
+		if routes, ok := data["*."+parent]; ok {
+			return routes
+		}
+	}
+	return data[""]
+}
+
+// matchPath reports whether reqPath matches the path of a route as defined by
+// the Ingress spec. Exact paths match case-sensitively and in full. Prefix
+// paths match element by element on "/"-separated segments, ignoring a
+// trailing slash, so "/foo" matches "/foo" and "/foo/bar" but not "/foobar".
+// ImplementationSpecific paths are matched as prefixes unless they are
+// regular expressions, which are matched by matchRoutes.
+func matchPath(pathType, routePath, reqPath string) bool {
+	if pathType == string(networkingv1.PathTypeExact) {
+		return reqPath == routePath
+	}
+
+	prefix := strings.TrimRight(routePath, "/")
+	if prefix == "" {
+		return true
+	}
+	return reqPath == prefix || strings.HasPrefix(reqPath, prefix+"/")
+}
+
+// matchLength is the length a route competes with for the longest match.
+func matchLength(route *Route) int {
+	if route.Regex != nil || route.PathType == string(networkingv1.PathTypeExact) {
+		return len(route.Path)
+	}
+	return len(strings.TrimRight(route.Path, "/"))
+}
+
+// compareRoutes orders the routes of a host by precedence: the longest path
+// first, Exact before Prefix at equal length, then the oldest Ingress, and
+// finally the Ingress namespace and name so the order is deterministic.
+// Default backends come after every path.
+func compareRoutes(a, b *Route) int {
+	if a.Default != b.Default {
+		if b.Default {
+			return -1
+		}
+		return 1
+	}
+
+	if c := cmp.Compare(matchLength(b), matchLength(a)); c != 0 {
+		return c
+	}
+
+	aExact := a.PathType == string(networkingv1.PathTypeExact)
+	bExact := b.PathType == string(networkingv1.PathTypeExact)
+	if aExact != bExact {
+		if aExact {
+			return -1
+		}
+		return 1
+	}
+
+	return compareSources(a, b)
+}
+
+// compareSources orders routes by their Ingress, the oldest first, then by
+// namespace and name.
+func compareSources(a, b *Route) int {
+	if c := a.CreationTimestamp.Compare(b.CreationTimestamp); c != 0 {
+		return c
+	}
+	if c := cmp.Compare(a.Namespace, b.Namespace); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.Ingress, b.Ingress)
+}
+
+// sortRoutes sorts routes by precedence. Routes of the same Ingress that
+// compare equal keep their order in the Ingress.
+func sortRoutes(routes []*Route) {
+	slices.SortStableFunc(routes, compareRoutes)
+}
+
+// matchRoutes returns the first of routes, sorted by precedence, that
+// matches reqPath. Requests are matched by the equivalent routeTree; this is
+// the definition it is tested against.
+func matchRoutes(routes []*Route, reqPath string) *Route {
+	for _, route := range routes {
+		if route.Regex != nil {
+			if route.Regex.MatchString(reqPath) {
+				return route
+			}
+			continue
+		}
+		if matchPath(route.PathType, route.Path, reqPath) {
+			return route
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package routing
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+// TestMatchConformance follows the path matching examples of the Ingress
+// documentation.
+func TestMatchConformance(t *testing.T) {
+	const (
+		exact  = networkingv1.PathTypeExact
+		prefix = networkingv1.PathTypePrefix
+	)
+
+	type path struct {
+		path     string
+		pathType networkingv1.PathType
+	}
+
+	tests := []struct {
+		paths    []path
+		requests []string
+		// expected is the matched path and type, or nil when nothing matches.
+		expected *path
+	}{
+		{[]path{{"/", prefix}}, []string{"/", "/foo", "/foo/bar/"}, &path{"/", prefix}},
+		{[]path{{"/foo", exact}}, []string{"/foo"}, &path{"/foo", exact}},
+		{[]path{{"/foo", exact}}, []string{"/bar", "/foo/", "/FOO"}, nil},
+		{[]path{{"/foo/", exact}}, []string{"/foo"}, nil},
+		{[]path{{"/foo", prefix}}, []string{"/foo", "/foo/"}, &path{"/foo", prefix}},
+		{[]path{{"/foo/", prefix}}, []string{"/foo", "/foo/"}, &path{"/foo/", prefix}},
+		{[]path{{"/aaa/bb", prefix}}, []string{"/aaa/bbb"}, nil},
+		{[]path{{"/aaa/bbb", prefix}}, []string{"/aaa/bbb", "/aaa/bbb/", "/aaa/bbb/ccc"}, &path{"/aaa/bbb", prefix}},
+		{[]path{{"/aaa/bbb/", prefix}}, []string{"/aaa/bbb"}, &path{"/aaa/bbb/", prefix}},
+		{[]path{{"/aaa/bbb", prefix}}, []string{"/aaa/bbbxyz"}, nil},
+		{[]path{{"/", prefix}, {"/aaa", prefix}}, []string{"/aaa/ccc"}, &path{"/aaa", prefix}},
+		{[]path{{"/", prefix}, {"/aaa", prefix}, {"/aaa/bbb", prefix}}, []string{"/aaa/bbb"}, &path{"/aaa/bbb", prefix}},
+		{[]path{{"/", prefix}, {"/aaa", prefix}, {"/aaa/bbb", prefix}}, []string{"/ccc"}, &path{"/", prefix}},
+		{[]path{{"/aaa", prefix}}, []string{"/ccc"}, nil},
+		{[]path{{"/foo", prefix}, {"/foo", exact}}, []string{"/foo"}, &path{"/foo", exact}},
+		{[]path{{"/foo/", prefix}, {"/foo", exact}}, []string{"/foo"}, &path{"/foo", exact}},
+		{[]path{{"/foo", exact}, {"/foo", prefix}}, []string{"/foo/bar"}, &path{"/foo", prefix}},
+	}
+
+	for _, tt := range tests {
+		routes := make([]*Route, 0, len(tt.paths))
+		var names []string
+		for _, p := range tt.paths {
+			routes = append(routes, &Route{Path: p.path, PathType: string(p.pathType)})
+			names = append(names, string(p.pathType)+" "+p.path)
+		}
+		sortRoutes(routes)
+
+		for _, req := range tt.requests {
+			t.Run(strings.Join(names, ",")+" "+req, func(t *testing.T) {
+				route := matchRoutes(routes, req)
+				switch {
+				case tt.expected == nil && route != nil:
+					t.Errorf("expected no match, got %s %s", route.PathType, route.Path)
+				case tt.expected != nil && route == nil:
+					t.Errorf("expected %s %s, got no match", tt.expected.pathType, tt.expected.path)
+				case tt.expected != nil && (route.Path != tt.expected.path || route.PathType != string(tt.expected.pathType)):
+					t.Errorf("expected %s %s, got %s %s", tt.expected.pathType, tt.expected.path, route.PathType, route.Path)
+				}
+				if indexed := newRouteTree(routes).match(req); indexed != route {
+					t.Errorf("route tree matched %v, expected the same route as the sorted routes", indexed)
+				}
+			})
+		}
+	}
+}
+
+func TestCompareRoutes(t *testing.T) {
+	now := time.Now()
+	routes := []*Route{
+		{Path: "/a", PathType: "Prefix", Namespace: "b", Ingress: "x", CreationTimestamp: now},
+		{Path: "/a", PathType: "Prefix", Namespace: "a", Ingress: "y", CreationTimestamp: now},
+		{Path: "/a", PathType: "Prefix", Namespace: "a", Ingress: "x", CreationTimestamp: now},
+		{Path: "/a", PathType: "Prefix", Namespace: "z", Ingress: "z", CreationTimestamp: now.Add(-time.Minute)},
+		{Path: "/a", PathType: "Exact", Namespace: "z", Ingress: "z", CreationTimestamp: now},
+		{Path: "/a/b", PathType: "Prefix", Namespace: "z", Ingress: "z", CreationTimestamp: now},
+	}
+	sortRoutes(routes)
+
+	expected := []string{"Prefix /a/b z/z", "Exact /a z/z", "Prefix /a z/z", "Prefix /a a/x", "Prefix /a a/y", "Prefix /a b/x"}
+	for i, route := range routes {
+		if got := route.PathType + " " + route.Path + " " + route.Namespace + "/" + route.Ingress; got != expected[i] {
+			t.Errorf("route %d: expected %s, got %s", i, expected[i], got)
+		}
+	}
+}
+
+func TestLookupHost(t *testing.T) {
+	route := func(name string) []*Route {
+		return []*Route{{Path: "/", PathType: "Prefix", Ingress: name}}
+	}
+	data := map[string][]*Route{
+		"app.example.com": route("exact"),
+		"*.example.com":   route("wildcard"),
+		"":                route("catch-all"),
+	}
+
+	tests := []struct {
+		host     string
+		expected string
+	}{
+		{"app.example.com", "exact"},
+		{"APP.example.com.", "exact"},
+		{"api.example.com", "wildcard"},
+		{"a.api.example.com", "catch-all"},
+		{"example.com", "catch-all"},
+		{"other.org", "catch-all"},
+		{"", "catch-all"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			routes := lookupHost(data, tt.host)
+			if len(routes) == 0 || routes[0].Ingress != tt.expected {
+				t.Errorf("expected the %s rules, got %v", tt.expected, routes)
+			}
+		})
+	}
+
+	t.Run("no catch-all", func(t *testing.T) {
+		delete(data, "")
+		if routes := lookupHost(data, "other.org"); routes != nil {
+			t.Errorf("expected no rules, got %v", routes)
+		}
+	})
+}
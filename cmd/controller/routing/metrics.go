@@ -0,0 +1,40 @@
+package routing
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/danCrespo/panacea-ingress-controller/metrics"
+)
+
+// Labels returns the metric labels of the route, those of the Ingress rule
+// it was built from.
+func (r *Route) Labels() metrics.Route {
+	if r == nil {
+		return metrics.Route{}
+	}
+	return metrics.Route{Namespace: r.Namespace, Ingress: r.Ingress, Host: r.Host, Path: r.Path}
+}
+
+// upstreamErrorReason returns the reason label of an upstream error.
+func upstreamErrorReason(err error) string {
+	switch {
+	case errors.Is(err, errNoEndpoints):
+		return "no_endpoints"
+	case errors.Is(err, errCircuitOpen):
+		return "circuit_open"
+	case isTimeout(err):
+		return "timeout"
+	default:
+		return "connection"
+	}
+}
+
+// recordError counts the failed attempt of req, unless the client gave up on
+// the request.
+func (t *routeTransport) recordError(req *http.Request, err error) {
+	if req.Context().Err() != nil && !isTimeout(err) {
+		return
+	}
+	metrics.UpstreamError(t.route.Labels(), upstreamErrorReason(err))
+}
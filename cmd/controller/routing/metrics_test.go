@@ -0,0 +1,42 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestUpstreamErrorReason(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{err: fmt.Errorf("default/app:80: %w", errNoEndpoints), expected: "no_endpoints"},
+		{err: fmt.Errorf("default/app:80: %w", errCircuitOpen), expected: "circuit_open"},
+		{err: fmt.Errorf("10.0.0.1:8080: %w", errUpstreamTimeout), expected: "timeout"},
+		{err: context.DeadlineExceeded, expected: "timeout"},
+		{err: errors.New("connection refused"), expected: "connection"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			if got := upstreamErrorReason(tt.err); got != tt.expected {
+				t.Errorf("Expected reason %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRouteLabels(t *testing.T) {
+	route := &Route{Host: "*.example.com", Path: "/api", Namespace: "default", Ingress: "app"}
+	labels := route.Labels()
+	if labels.Host != "*.example.com" || labels.Path != "/api" || labels.Namespace != "default" || labels.Ingress != "app" {
+		t.Errorf("Expected the labels of the Ingress rule, got %+v", labels)
+	}
+
+	var none *Route
+	if labels := none.Labels(); labels.Host != "" || labels.Ingress != "" {
+		t.Errorf("Expected empty labels without a route, got %+v", labels)
+	}
+}
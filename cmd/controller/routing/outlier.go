@@ -0,0 +1,118 @@
+package routing
+
+import (
+	"time"
+)
+
+// OutlierDetection configures the passive ejection of endpoints that keep
+// failing real requests.
+type OutlierDetection struct {
+	// ConsecutiveErrors is the number of consecutive 5xx responses or
+	// connection errors that eject an endpoint.
+	ConsecutiveErrors int
+	// BaseEjectionTime is the length of the first ejection. It doubles on
+	// every ejection up to MaxEjectionTime.
+	BaseEjectionTime time.Duration
+	MaxEjectionTime  time.Duration
+	// MaxEjectionPercent caps the share of the endpoints ejected at once.
+	// One endpoint can always be ejected.
+	MaxEjectionPercent int
+}
+
+// ejected reports whether the endpoint is ejected at now.
+func (e *Endpoint) ejected(now time.Time) bool {
+	return now.UnixNano() < e.ejectedUntil.Load()
+}
+
+// Ejected reports whether outlier detection took the endpoint out of rotation.
+func (e *Endpoint) Ejected() bool {
+	return e.ejected(time.Now())
+}
+
+// ejectionTime returns how long the next ejection of the endpoint lasts. The
+// back-off is reset once the endpoint has been back for MaxEjectionTime.
+func (e *Endpoint) ejectionTime(now time.Time, config OutlierDetection) time.Duration {
+	if e.ejections > 0 && now.Sub(time.Unix(0, e.ejectedUntil.Load())) > config.MaxEjectionTime {
+		e.ejections = 0
+	}
+
+	d := config.BaseEjectionTime
+	for i := 0; i < e.ejections && d < config.MaxEjectionTime; i++ {
+		d *= 2
+	}
+	return min(d, config.MaxEjectionTime)
+}
+
+// observe records the outcome of a request to ep and ejects ep once it
+// failed too many times in a row.
+func (u *Upstream) observe(ep *Endpoint, failed bool) {
+	config := u.outlierDetection.Load()
+	if config == nil {
+		return
+	}
+
+	if !failed {
+		ep.consecutiveErrors.Store(0)
+		return
+	}
+	if ep.consecutiveErrors.Add(1) < int32(config.ConsecutiveErrors) {
+		return
+	}
+	u.eject(ep, *config)
+}
+
+func (u *Upstream) eject(ep *Endpoint, config OutlierDetection) {
+	u.outlierMu.Lock()
+	defer u.outlierMu.Unlock()
+
+	now := time.Now()
+	if ep.ejected(now) {
+		return
+	}
+
+	endpoints := u.Endpoints()
+	ejected := 0
+	for _, e := range endpoints {
+		if e.ejected(now) {
+			ejected++
+		}
+	}
+	if ejected > 0 && (ejected+1)*100 > config.MaxEjectionPercent*len(endpoints) {
+		l.Info("Not ejecting outlier endpoint, too many endpoints ejected", "upstream", u.Key(), "endpoint", ep.Host(), "ejected", ejected)
+		return
+	}
+
+	d := ep.ejectionTime(now, config)
+	ep.ejections++
+	ep.ejectedUntil.Store(now.Add(d).UnixNano())
+	ep.consecutiveErrors.Store(0)
+
+	l.Info("Ejecting outlier endpoint", "upstream", u.Key(), "endpoint", ep.Host(), "duration", d)
+	u.refreshAvailable()
+
+	time.AfterFunc(d, func() {
+		l.Info("Ejected endpoint back in rotation", "upstream", u.Key(), "endpoint", ep.Host())
+		u.refreshAvailable()
+	})
+}
+
+// OutlierDetection returns the outlier detection of the upstream, or nil.
+func (u *Upstream) OutlierDetection() *OutlierDetection {
+	config := u.outlierDetection.Load()
+	if config == nil {
+		return nil
+	}
+	c := *config
+	return &c
+}
+
+// SetOutlierDetection enables, changes or, when config is nil, disables the
+// outlier detection of the upstream. Ejections in progress run their course.
+func (u *Upstream) SetOutlierDetection(config *OutlierDetection) {
+	if config == nil {
+		u.outlierDetection.Store(nil)
+		return
+	}
+	c := *config
+	u.outlierDetection.Store(&c)
+}
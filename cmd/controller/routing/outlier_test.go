@@ -0,0 +1,186 @@
+package routing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+func TestEndpointEjectionTime(t *testing.T) {
+	config := OutlierDetection{BaseEjectionTime: time.Second, MaxEjectionTime: 5 * time.Second}
+	ep := &Endpoint{Address: "10.0.0.1", Port: 8080}
+	now := time.Now()
+	ep.ejectedUntil.Store(now.UnixNano())
+
+	for i, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if d := ep.ejectionTime(now, config); d != expected {
+			t.Errorf("ejection %d: expected %v, got %v", i, expected, d)
+		}
+		ep.ejections++
+	}
+
+	t.Run("back-off is reset after a quiet period", func(t *testing.T) {
+		if d := ep.ejectionTime(now.Add(10*time.Second), config); d != time.Second {
+			t.Errorf("expected %v, got %v", time.Second, d)
+		}
+	})
+}
+
+func TestUpstreamObserveEjects(t *testing.T) {
+	upstream := newUpstream("default", "web", networkingv1.ServiceBackendPort{Number: 80}, false)
+	upstream.SetOutlierDetection(&OutlierDetection{
+		ConsecutiveErrors:  3,
+		BaseEjectionTime:   time.Minute,
+		MaxEjectionTime:    time.Hour,
+		MaxEjectionPercent: 50,
+	})
+
+	endpoints := []*Endpoint{
+		{Address: "10.0.0.1", Port: 8080},
+		{Address: "10.0.0.2", Port: 8080},
+		{Address: "10.0.0.3", Port: 8080},
+		{Address: "10.0.0.4", Port: 8080},
+	}
+	upstream.SetEndpoints(endpoints)
+
+	upstream.observe(endpoints[0], true)
+	upstream.observe(endpoints[0], true)
+	upstream.observe(endpoints[0], false) // A success resets the error count
+	upstream.observe(endpoints[0], true)
+	upstream.observe(endpoints[0], true)
+	if endpoints[0].Ejected() {
+		t.Fatalf("expected endpoint not to be ejected before 3 consecutive errors")
+	}
+
+	upstream.observe(endpoints[0], true)
+	if !endpoints[0].Ejected() {
+		t.Fatalf("expected endpoint to be ejected after 3 consecutive errors")
+	}
+	if len(upstream.Available()) != 3 {
+		t.Errorf("expected 3 available endpoints, got %d", len(upstream.Available()))
+	}
+
+	for _, ep := range endpoints[1:] {
+		for range 3 {
+			upstream.observe(ep, true)
+		}
+	}
+	ejected := 0
+	for _, ep := range endpoints {
+		if ep.Ejected() {
+			ejected++
+		}
+	}
+	if ejected != 2 {
+		t.Errorf("expected max ejection percent to cap ejections at 2, got %d", ejected)
+	}
+}
+
+func TestUpstreamObserveEjectsOneEndpoint(t *testing.T) {
+	upstream := newUpstream("default", "web", networkingv1.ServiceBackendPort{Number: 80}, false)
+	upstream.SetOutlierDetection(&OutlierDetection{ConsecutiveErrors: 1, BaseEjectionTime: time.Minute, MaxEjectionTime: time.Minute})
+
+	ep := &Endpoint{Address: "10.0.0.1", Port: 8080}
+	upstream.SetEndpoints([]*Endpoint{ep})
+
+	upstream.observe(ep, true)
+	if !ep.Ejected() {
+		t.Errorf("expected one endpoint to be ejected regardless of max ejection percent")
+	}
+	if len(upstream.Available()) != 1 {
+		t.Errorf("expected the ejected endpoint to stay available when it is the only one")
+	}
+}
+
+func TestRouteTransportEjectsFailingEndpoint(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer working.Close()
+
+	upstream := newUpstream("default", "web", networkingv1.ServiceBackendPort{Number: 80}, false)
+	upstream.SetOutlierDetection(&OutlierDetection{
+		ConsecutiveErrors:  2,
+		BaseEjectionTime:   50 * time.Millisecond,
+		MaxEjectionTime:    time.Second,
+		MaxEjectionPercent: 50,
+	})
+	bad, good := testEndpoint(t, failing.URL), testEndpoint(t, working.URL)
+	upstream.SetEndpoints([]*Endpoint{bad, good})
+	transport := &routeTransport{upstream: upstream, balancer: &roundRobin{}}
+
+	req := httptest.NewRequest(http.MethodGet, "http://web.default.svc.cluster.local/", nil)
+	req.RequestURI = ""
+	for range 4 {
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip() returned an error: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	if !bad.Ejected() {
+		t.Fatalf("expected the failing endpoint to be ejected")
+	}
+	for range 4 {
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip() returned an error: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("expected requests to avoid the ejected endpoint, got %d", resp.StatusCode)
+		}
+	}
+
+	waitFor(t, func() bool { return len(upstream.Available()) == 2 })
+}
+
+func TestRouteTransportEjectsHangingEndpoint(t *testing.T) {
+	unblock := make(chan struct{})
+	defer close(unblock)
+
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-unblock:
+		case <-r.Context().Done():
+		}
+	}))
+	defer hanging.Close()
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer working.Close()
+
+	upstream := newUpstream("default", "web", networkingv1.ServiceBackendPort{Number: 80}, false)
+	upstream.SetOutlierDetection(&OutlierDetection{
+		ConsecutiveErrors:  1,
+		BaseEjectionTime:   time.Minute,
+		MaxEjectionTime:    time.Minute,
+		MaxEjectionPercent: 50,
+	})
+	slow := testEndpoint(t, hanging.URL)
+	upstream.SetEndpoints([]*Endpoint{slow, testEndpoint(t, working.URL)})
+	transport := &routeTransport{
+		upstream: upstream,
+		balancer: &roundRobin{},
+		retry:    &RetryPolicy{Attempts: 1, PerTryTimeout: 20 * time.Millisecond},
+	}
+
+	// The attempts sent to the hanging endpoint time out.
+	for range 2 {
+		req := httptest.NewRequest(http.MethodGet, "http://web.default.svc.cluster.local/", nil)
+		req.RequestURI = ""
+		req.Body = nil
+		if resp, err := transport.RoundTrip(req); err == nil {
+			resp.Body.Close()
+		}
+	}
+
+	if !slow.Ejected() {
+		t.Errorf("expected the endpoint timing out to be ejected")
+	}
+}
@@ -0,0 +1,173 @@
+package routing
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Conditions accepted by --retry-on and the panacea.io/retry-on annotation.
+const (
+	RetryOnConnectFailure = "connect-failure"
+	RetryOnReset          = "reset"
+	RetryOn502            = "502"
+	RetryOn503            = "503"
+	RetryOn504            = "504"
+)
+
+// retryOn is a set of retry conditions.
+type retryOn uint8
+
+const (
+	retryOnConnectFailure retryOn = 1 << iota
+	retryOnReset
+	retryOn502
+	retryOn503
+	retryOn504
+)
+
+func parseRetryOn(value string) (retryOn, error) {
+	var on retryOn
+	for condition := range strings.SplitSeq(value, ",") {
+		switch strings.TrimSpace(condition) {
+		case "":
+		case RetryOnConnectFailure:
+			on |= retryOnConnectFailure
+		case RetryOnReset:
+			on |= retryOnReset
+		case RetryOn502:
+			on |= retryOn502
+		case RetryOn503:
+			on |= retryOn503
+		case RetryOn504:
+			on |= retryOn504
+		default:
+			return 0, fmt.Errorf("unknown retry condition %q", condition)
+		}
+	}
+	return on, nil
+}
+
+// RetryPolicy configures the retries of the requests of a route.
+type RetryPolicy struct {
+	// Attempts is the maximum number of attempts, the first one included.
+	Attempts int
+	On       retryOn
+	// PerTryTimeout bounds the wait for response headers of each attempt.
+	// Attempts that time out are retried like a 504.
+	PerTryTimeout time.Duration
+	// NonIdempotent allows retrying requests with methods such as POST.
+	NonIdempotent bool
+}
+
+// attemptsFor returns the number of times req may be sent.
+func (p *RetryPolicy) attemptsFor(req *http.Request) int {
+	if p == nil || p.Attempts <= 1 {
+		return 1
+	}
+	if !p.NonIdempotent && !isIdempotent(req) {
+		return 1
+	}
+	// A body can only be sent again when it can be read again.
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return 1
+	}
+	return p.Attempts
+}
+
+// retryable reports whether the outcome of an attempt matches the policy.
+func (p *RetryPolicy) retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		var opErr *net.OpError
+		switch {
+		case errors.Is(err, errUpstreamTimeout):
+			return p.On&retryOn504 != 0
+		case errors.As(err, &opErr) && opErr.Op == "dial":
+			return p.On&retryOnConnectFailure != 0
+		case errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+			return p.On&retryOnReset != 0
+		}
+		return false
+	}
+
+	switch resp.StatusCode {
+	case http.StatusBadGateway:
+		return p.On&retryOn502 != 0
+	case http.StatusServiceUnavailable:
+		return p.On&retryOn503 != 0
+	case http.StatusGatewayTimeout:
+		return p.On&retryOn504 != 0
+	}
+	return false
+}
+
+// isIdempotent reports whether the method of req can be sent twice without
+// side effects.
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// retryBudget caps the retries in flight to a share of the requests in
+// flight, so that a failing backend does not get its load multiplied. One
+// budget is shared by every route.
+type retryBudget struct {
+	percent    int64
+	minRetries int64
+
+	requests atomic.Int64
+	retries  atomic.Int64
+}
+
+func newRetryBudget(percent, minRetries int) *retryBudget {
+	return &retryBudget{
+		percent:    int64(max(percent, 0)),
+		minRetries: int64(max(minRetries, 0)),
+	}
+}
+
+// begin and end track a request that may be retried.
+func (b *retryBudget) begin() {
+	if b != nil {
+		b.requests.Add(1)
+	}
+}
+
+func (b *retryBudget) end() {
+	if b != nil {
+		b.requests.Add(-1)
+	}
+}
+
+// allow takes a retry from the budget, reporting false when it is spent.
+// Retries are given back with done.
+func (b *retryBudget) allow() bool {
+	if b == nil {
+		return true
+	}
+
+	for {
+		retries := b.retries.Load()
+		if retries >= max(b.minRetries, b.requests.Load()*b.percent/100) {
+			return false
+		}
+		if b.retries.CompareAndSwap(retries, retries+1) {
+			return true
+		}
+	}
+}
+
+func (b *retryBudget) done() {
+	if b != nil {
+		b.retries.Add(-1)
+	}
+}
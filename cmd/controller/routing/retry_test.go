@@ -0,0 +1,207 @@
+package routing
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danCrespo/panacea-ingress-controller/accesslog"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+func TestParseRetryOn(t *testing.T) {
+	on, err := parseRetryOn("connect-failure, 503")
+	if err != nil {
+		t.Fatalf("parseRetryOn() returned an error: %v", err)
+	}
+	if on != retryOnConnectFailure|retryOn503 {
+		t.Errorf("unexpected conditions %b", on)
+	}
+
+	if _, err := parseRetryOn("5xx"); err == nil {
+		t.Errorf("expected an error for an unknown condition")
+	}
+}
+
+func TestRetryPolicyAttemptsFor(t *testing.T) {
+	policy := &RetryPolicy{Attempts: 3}
+
+	tests := []struct {
+		name     string
+		req      *http.Request
+		policy   *RetryPolicy
+		expected int
+	}{
+		{"GET", httptest.NewRequest(http.MethodGet, "/", nil), policy, 3},
+		{"POST", httptest.NewRequest(http.MethodPost, "/", nil), policy, 1},
+		{"POST with non-idempotent retries", httptest.NewRequest(http.MethodPost, "/", nil), &RetryPolicy{Attempts: 3, NonIdempotent: true}, 3},
+		{"PUT with unreplayable body", httptest.NewRequest(http.MethodPut, "/", strings.NewReader("body")), policy, 1},
+		{"no policy", httptest.NewRequest(http.MethodGet, "/", nil), nil, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.req.ContentLength == 0 {
+				tt.req.Body = nil
+			}
+			if got := tt.policy.attemptsFor(tt.req); got != tt.expected {
+				t.Errorf("expected %d attempts, got %d", tt.expected, got)
+			}
+		})
+	}
+
+	// Only the panacea.io/retry-non-idempotent annotation retries a POST,
+	// whatever headers the client sends.
+	t.Run("POST with idempotency key", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Body = nil
+		req.Header.Set("Idempotency-Key", "abc")
+		if got := policy.attemptsFor(req); got != 1 {
+			t.Errorf("expected 1 attempt, got %d", got)
+		}
+	})
+}
+
+func TestRetryBudget(t *testing.T) {
+	budget := newRetryBudget(20, 1)
+	for range 10 {
+		budget.begin()
+	}
+
+	if !budget.allow() || !budget.allow() {
+		t.Fatalf("expected 20%% of 10 requests to allow 2 retries")
+	}
+	if budget.allow() {
+		t.Errorf("expected the budget to be spent")
+	}
+
+	budget.done()
+	if !budget.allow() {
+		t.Errorf("expected a finished retry to be given back")
+	}
+}
+
+func TestRouteTransportRetries(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer working.Close()
+	closed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	closed.Close()
+
+	on, _ := parseRetryOn("connect-failure,reset,502,503,504")
+
+	newTransport := func(retry *RetryPolicy, urls ...string) *routeTransport {
+		upstream := newUpstream("default", "web", networkingv1.ServiceBackendPort{Number: 80}, false)
+		endpoints := make([]*Endpoint, 0, len(urls))
+		for _, u := range urls {
+			endpoints = append(endpoints, testEndpoint(t, u))
+		}
+		upstream.SetEndpoints(endpoints)
+		return &routeTransport{upstream: upstream, balancer: &roundRobin{}, retry: retry, budget: newRetryBudget(20, 3)}
+	}
+
+	newRequest := func(method string) *http.Request {
+		req := httptest.NewRequest(method, "http://web.default.svc.cluster.local/", nil)
+		req.RequestURI = ""
+		req.Body = nil
+		return req
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		retry    *RetryPolicy
+		urls     []string
+		expected int
+	}{
+		{"503 is retried on another endpoint", http.MethodGet, &RetryPolicy{Attempts: 2, On: on}, []string{failing.URL, working.URL}, http.StatusOK},
+		{"connect failure is retried on another endpoint", http.MethodGet, &RetryPolicy{Attempts: 2, On: on}, []string{closed.URL, working.URL}, http.StatusOK},
+		{"POST is not retried", http.MethodPost, &RetryPolicy{Attempts: 2, On: on}, []string{failing.URL, working.URL}, http.StatusServiceUnavailable},
+		{"last attempt response is returned", http.MethodGet, &RetryPolicy{Attempts: 3, On: on}, []string{failing.URL}, http.StatusServiceUnavailable},
+		{"no retries without a policy", http.MethodGet, nil, []string{failing.URL, working.URL}, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := newTransport(tt.retry, tt.urls...)
+			resp, err := transport.RoundTrip(newRequest(tt.method))
+			if err != nil {
+				t.Fatalf("RoundTrip() returned an error: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.expected {
+				t.Errorf("expected %d, got %d", tt.expected, resp.StatusCode)
+			}
+
+			for _, ep := range transport.upstream.Endpoints() {
+				if ep.Active() != 0 {
+					t.Errorf("expected no requests in flight to %s, got %d", ep, ep.Active())
+				}
+			}
+			if transport.budget.retries.Load() != 0 || transport.budget.requests.Load() != 0 {
+				t.Errorf("expected the retry budget to be released")
+			}
+		})
+	}
+	t.Run("attempts are recorded to the access log", func(t *testing.T) {
+		transport := newTransport(&RetryPolicy{Attempts: 2, On: on}, failing.URL, working.URL)
+		entry := &accesslog.Entry{}
+		req := newRequest(http.MethodGet)
+		resp, err := transport.RoundTrip(req.WithContext(accesslog.NewContext(req.Context(), entry)))
+		if err != nil {
+			t.Fatalf("RoundTrip() returned an error: %v", err)
+		}
+		resp.Body.Close()
+
+		if len(entry.Upstreams) != 2 {
+			t.Fatalf("expected 2 attempts, got %+v", entry.Upstreams)
+		}
+		if entry.Upstreams[0].Status != http.StatusServiceUnavailable || entry.Upstreams[1].Status != http.StatusOK {
+			t.Errorf("expected a 503 then a 200, got %+v", entry.Upstreams)
+		}
+		if entry.Upstreams[0].Addr == entry.Upstreams[1].Addr {
+			t.Errorf("expected the retry to go to another endpoint, got %+v", entry.Upstreams)
+		}
+	})
+}
+
+func TestRouteTransportPerTryTimeout(t *testing.T) {
+	unblock := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-unblock:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(unblock)
+
+	upstream := newUpstream("default", "web", networkingv1.ServiceBackendPort{Number: 80}, false)
+	upstream.SetEndpoints([]*Endpoint{testEndpoint(t, slow.URL)})
+	transport := &routeTransport{
+		upstream: upstream,
+		balancer: &roundRobin{},
+		retry:    &RetryPolicy{Attempts: 2, On: retryOn504, PerTryTimeout: 20 * time.Millisecond},
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "http://web.default.svc.cluster.local/", nil)
+	req.RequestURI = ""
+	req.Body = nil
+
+	_, err := transport.RoundTrip(req)
+	if !errors.Is(err, errUpstreamTimeout) {
+		t.Fatalf("expected %v, got %v", errUpstreamTimeout, err)
+	}
+
+	rec := httptest.NewRecorder()
+	proxyErrorHandler(rec, req, err)
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected %d, got %d", http.StatusGatewayTimeout, rec.Code)
+	}
+}
@@ -0,0 +1,47 @@
+package routing
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+// compilePathRegex compiles an ImplementationSpecific path into an RE2
+// expression anchored at both ends, which must match the whole request path.
+// Prefixes end with .* such as /api/.*.
+func compilePathRegex(path string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile("^(?:" + path + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid path regex %q: %v", path, err)
+	}
+	return re, nil
+}
+
+// rewritePath returns the path reqPath is forwarded with on route. Regex
+// routes replace the path with the target, expanding $1-style references to
+// the capture groups of the path. Other routes replace the matched part of
+// the path with the target.
+func rewritePath(route *Route, reqPath string) string {
+	target := route.RewriteTarget
+
+	if route.Regex != nil {
+		match := route.Regex.FindStringSubmatchIndex(reqPath)
+		if match == nil {
+			return reqPath
+		}
+		return string(route.Regex.ExpandString(nil, target, reqPath, match))
+	}
+
+	if route.PathType == string(networkingv1.PathTypeExact) {
+		return target
+	}
+
+	rest := strings.TrimPrefix(reqPath, strings.TrimRight(route.Path, "/"))
+	rewritten := strings.TrimRight(target, "/") + rest
+	if !strings.HasPrefix(rewritten, "/") {
+		rewritten = "/" + rewritten
+	}
+	return rewritten
+}
@@ -0,0 +1,121 @@
+package routing
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestCompilePathRegex(t *testing.T) {
+	re, err := compilePathRegex("/api/v[0-9]+")
+	if err != nil {
+		t.Fatalf("compilePathRegex() returned an error: %v", err)
+	}
+
+	for path, expected := range map[string]bool{
+		"/api/v1":              true,
+		"/api/v12":             true,
+		"/api/v12/user":        false,
+		"/api/v1beta/anything": false,
+		"/old/api/v1":          false,
+		"/api/vx":              false,
+	} {
+		if got := re.MatchString(path); got != expected {
+			t.Errorf("MatchString(%q): expected %v, got %v", path, expected, got)
+		}
+	}
+
+	t.Run("alternation stays anchored", func(t *testing.T) {
+		re, err := compilePathRegex("/a|/b")
+		if err != nil {
+			t.Fatalf("compilePathRegex() returned an error: %v", err)
+		}
+		if re.MatchString("/x/b") || re.MatchString("/a/x") {
+			t.Errorf("expected every alternative to be anchored")
+		}
+	})
+
+	t.Run("prefixes", func(t *testing.T) {
+		re, err := compilePathRegex("/api/.*")
+		if err != nil {
+			t.Fatalf("compilePathRegex() returned an error: %v", err)
+		}
+		if !re.MatchString("/api/v1/users") || re.MatchString("/apis") {
+			t.Errorf("expected .* to match the rest of the path")
+		}
+	})
+
+	if _, err := compilePathRegex("/api/(v1"); err == nil {
+		t.Errorf("expected an error for an invalid regex")
+	}
+}
+
+func TestRewritePath(t *testing.T) {
+	re, _ := compilePathRegex("/api(/|$)(.*)")
+
+	tests := []struct {
+		name     string
+		route    *Route
+		path     string
+		expected string
+	}{
+		{"regex capture group", &Route{Regex: re, RewriteTarget: "/$2"}, "/api/users/1", "/users/1"},
+		{"regex empty capture group", &Route{Regex: re, RewriteTarget: "/$2"}, "/api", "/"},
+		{"regex named target", &Route{Regex: re, RewriteTarget: "/v2/${2}"}, "/api/users", "/v2/users"},
+		{"prefix to root", &Route{Path: "/api", PathType: "Prefix", RewriteTarget: "/"}, "/api/users", "/users"},
+		{"prefix itself", &Route{Path: "/api/", PathType: "Prefix", RewriteTarget: "/"}, "/api", "/"},
+		{"prefix to prefix", &Route{Path: "/api", PathType: "Prefix", RewriteTarget: "/v2"}, "/api/users", "/v2/users"},
+		{"exact", &Route{Path: "/login", PathType: "Exact", RewriteTarget: "/auth/login"}, "/login", "/auth/login"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rewritePath(tt.route, tt.path); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRoutingTableRegexPaths(t *testing.T) {
+	rt := newTestRoutingTable(t)
+	recorder := record.NewFakeRecorder(10)
+	rt.SetEventRecorder(recorder)
+
+	regex := newTestIngress("default", "regex", time.Now(), "app.example.com",
+		testPath{"/users/[0-9]+", networkingv1.PathTypeImplementationSpecific, "users"},
+		testPath{"/(broken", networkingv1.PathTypeImplementationSpecific, "broken"})
+	regex.Annotations = map[string]string{AnnotationUseRegex: "true"}
+
+	plain := newTestIngress("default", "plain", time.Now(), "app.example.com",
+		testPath{"/", networkingv1.PathTypeImplementationSpecific, "root"})
+
+	rt.UpdateFromIngresses([]*networkingv1.Ingress{regex, plain}, testClasses(t))
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{"/users/42", "users"},
+		{"/users/me", "root"},
+		{"/(broken", "root"},
+	}
+	for _, tt := range tests {
+		route := rt.Match("app.example.com", tt.path)
+		if route == nil || route.Upstream.Service != tt.expected {
+			t.Errorf("Match(%q): expected service %q, got %+v", tt.path, tt.expected, route)
+		}
+	}
+
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, "Warning InvalidPath") {
+			t.Errorf("unexpected event %q", event)
+		}
+	default:
+		t.Errorf("expected the invalid regex to be reported on the ingress")
+	}
+}
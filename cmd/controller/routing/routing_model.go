@@ -1,6 +1,7 @@
 package routing
 
 import (
+	"crypto/rand"
 	"crypto/tls"
 	"fmt"
 	"log"
@@ -10,16 +11,20 @@ import (
 	"net/url"
 	"regexp"
 	"slices"
-	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/danCrespo/panacea-ingress-controller/config"
 	"github.com/danCrespo/panacea-ingress-controller/kubeutils"
 	"github.com/danCrespo/panacea-ingress-controller/logger"
+	"github.com/danCrespo/panacea-ingress-controller/metrics"
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 )
 
 var (
@@ -27,28 +32,84 @@ var (
 )
 
 type RoutingTable interface {
-	UpdateFromIngresses(ing []*networkingv1.Ingress, ingressClass string)
+	UpdateFromIngresses(ing []*networkingv1.Ingress, classes IngressClassMatcher)
+	RoutesFor(ingress *networkingv1.Ingress) []*Route
 	Match(host, reqPath string) *Route
 	GetRoutes(ingressKey string) []*Route
 	SetRoutes(ingressKey string, routes []*Route)
 	DeleteRoutes(ingressKey string)
 	ListAllRoutes() map[string][]*Route
+	GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error)
+	Certificates() *CertificateStore
+	SetEndpointResolver(resolver *EndpointResolver)
+	SetEventRecorder(recorder record.EventRecorder)
+	EndpointsHandler() cache.ResourceEventHandler
+	Upstreams() []*Upstream
 	Clear()
 	SetLogger(logger logr.Logger)
 }
 
 type Route struct {
+	Host     string
 	Path     string
 	PathType string
-	Backend  *url.URL
+	Upstream *Upstream
+	Balancer Balancer
 	Proxy    *httputil.ReverseProxy
+
+	// Regex is the compiled path of ImplementationSpecific paths of Ingresses
+	// that opted in to regular expressions.
+	Regex *regexp.Regexp
+	// RewriteTarget replaces the request path sent upstream when set.
+	RewriteTarget string
+
+	// Default marks the route of a default backend, which matches any path
+	// but only once no other route of the host does.
+	Default bool
+
+	// The Ingress the route comes from, used to break ties between Ingresses
+	// claiming the same host and path.
+	Namespace         string
+	Ingress           string
+	CreationTimestamp time.Time
+
+	// policy is the upstream configuration the Ingress asks for, applied
+	// when the Ingress is the oldest using the upstream.
+	policy upstreamPolicy
+	source *networkingv1.Ingress
+	// incomplete marks the routes of an Ingress some backend or TLS Secret of
+	// which could not be resolved when they were built.
+	incomplete bool
+}
+
+// UpToDate reports whether the route was built from this version of
+// ingress, with every backend and TLS Secret of it resolved. Routes built
+// before a Service or Secret they need appeared are never up to date, so
+// they are rebuilt on the next resync.
+func (r *Route) UpToDate(ingress *networkingv1.Ingress) bool {
+	return r.source != nil && !r.incomplete && r.source.UID == ingress.UID && r.source.ResourceVersion == ingress.ResourceVersion
 }
 
 type routingTable struct {
+	// updateMu serializes the writers of the table. They fetch the Secrets
+	// newly referenced before taking mu, so that TLS handshakes and Secret
+	// change callbacks are not blocked meanwhile.
+	updateMu  sync.Mutex
 	mu        sync.RWMutex
-	data      map[string][]*Route // Keyed by namespace/name of the IngressClass
+	snapshot  atomic.Pointer[routingSnapshot]
+	certs     *certificateTable
+	certStore *CertificateStore
+	fakeCert  *tls.Certificate
+	upstreams map[string]*Upstream // Keyed by namespace/service:port
+	resolver  *EndpointResolver
+	cookieKey []byte
+	budget    *retryBudget
+	recorder  record.EventRecorder
 	kubeutils kubeutils.IKubeutils
 	config    config.Config
+
+	domainOnce sync.Once
+	domain     string
 }
 
 func New(cfg config.Config) RoutingTable {
@@ -56,276 +117,955 @@ func New(cfg config.Config) RoutingTable {
 }
 
 func newRoutingTable(cfg config.Config) *routingTable {
-	return &routingTable{
-		data:      make(map[string][]*Route),
-		kubeutils: kubeutils.NewKubeutils(cfg),
+	return newRoutingTableWith(cfg, kubeutils.NewKubeutils(cfg))
+}
+
+func newRoutingTableWith(cfg config.Config, ku kubeutils.IKubeutils) *routingTable {
+	fakeCert, err := newSelfSignedCertificate()
+	if err != nil {
+		l.Error(err, "error generating fake certificate")
+	}
+
+	rt := &routingTable{
+		certs:     newCertificateTable(""),
+		fakeCert:  fakeCert,
+		upstreams: make(map[string]*Upstream),
+		budget:    newRetryBudget(cfg.RetryBudgetPercent, cfg.RetryBudgetMinRetries),
+		kubeutils: ku,
 		config:    cfg,
 	}
+	rt.snapshot.Store(newRoutingSnapshot(make(map[string][]*Route), nil))
+	rt.certStore = NewCertificateStore(rt.getSecret)
+	rt.certStore.onChange = rt.reloadBackendSecret
+
+	if cfg.SessionCookieKey != "" {
+		rt.cookieKey = []byte(cfg.SessionCookieKey)
+	} else {
+		rt.cookieKey = make([]byte, 32)
+		_, _ = rand.Read(rt.cookieKey)
+		l.Info("No session cookie key configured, affinity cookies will only be valid for this replica")
+	}
+	return rt
 }
 
 func (rt *routingTable) SetLogger(logger logr.Logger) {
 	l = logger
 }
 
-func (rt *routingTable) UpdateFromIngresses(_ingresses []*networkingv1.Ingress, ingressClass string) {
-	newData := make(map[string][]*Route)
+func (rt *routingTable) UpdateFromIngresses(_ingresses []*networkingv1.Ingress, classes IngressClassMatcher) {
 	var (
 		ingresses []networkingv1.Ingress
 	)
 
-	l.Info("Updating routing table from ingresses", _ingresses[len(_ingresses)-1])
-	domain, err := rt.kubeutils.GetClusterDomain()
+	l.Info("Updating routing table from ingresses", "total", len(_ingresses))
 
-	if err != nil {
-		l.Info("Error getting cluster domain, defaulting to cluster.local", "error", err)
-		domain = "cluster.local"
+	ingresses = func() []networkingv1.Ingress {
+		filtered := make([]networkingv1.Ingress, 0, len(_ingresses))
+		for _, ing := range _ingresses {
+			if IsIngressOwned(ing, classes) {
+				filtered = append(filtered, *ing)
+			}
+		}
+		return filtered
+	}()
+
+	// Upstreams are shared by the Ingresses of one update so that two
+	// Ingresses of the same Service end up with the same upstream.
+	newUpstreams := make(map[string]*Upstream)
+	newData := make(map[string][]*Route, len(ingresses))
+	for i := range ingresses {
+		if routes := rt.routesFor(&ingresses[i], newUpstreams); len(routes) > 0 {
+			newData[ingressKey(&ingresses[i])] = routes
+		}
 	}
+	fallback := rt.fallbackRoute(newUpstreams, rt.clusterDomain())
+
+	rt.updateMu.Lock()
+	rt.swap(newData, fallback)
+	rt.updateMu.Unlock()
+
+	rt.mu.RLock()
+	certificates := rt.certs.len()
+	rt.mu.RUnlock()
+
+	l.Info("Routing table updated", "certificates", certificates, "data", rt.String())
+}
 
-	if domain == "" {
-		domain = "cluster.local"
+// IsIngressOwned reports whether ingress belongs to one of classes and has
+// anything to route.
+func IsIngressOwned(ingress *networkingv1.Ingress, classes IngressClassMatcher) bool {
+	if !classes.Matches(ingress) {
+		return false
 	}
+	return len(ingress.Spec.Rules) > 0 || ingress.Spec.DefaultBackend != nil
+}
 
-	ingresses = func() []networkingv1.Ingress {
-		filtered := make([]networkingv1.Ingress, len(_ingresses))
-		if ingressClass != "" {
-			for _, ing := range _ingresses {
-				if ing.Spec.IngressClassName != nil && *ing.Spec.IngressClassName == ingressClass {
-					if len(ing.Spec.Rules) == 0 || ing.Spec.Rules == nil {
-						continue
-					}
-					filtered = append(filtered, *ing)
+// ingressKey returns the namespace/name key routes of ingress are stored
+// under.
+func ingressKey(ingress *networkingv1.Ingress) string {
+	return ingress.Namespace + "/" + ingress.Name
+}
+
+// clusterDomain returns the cluster domain Service names are resolved in,
+// looked up once.
+func (rt *routingTable) clusterDomain() string {
+	rt.domainOnce.Do(func() {
+		domain, err := rt.kubeutils.GetClusterDomain()
+
+		if err != nil {
+			l.Info("Error getting cluster domain, defaulting to cluster.local", "error", err)
+			domain = "cluster.local"
+		}
+
+		if domain == "" {
+			domain = "cluster.local"
+		}
+		rt.domain = domain
+	})
+	return rt.domain
+}
+
+// RoutesFor builds the routes of ingress, to be stored with SetRoutes. The
+// table is left unchanged.
+func (rt *routingTable) RoutesFor(ingress *networkingv1.Ingress) []*Route {
+	return rt.routesFor(ingress, make(map[string]*Upstream))
+}
+
+func (rt *routingTable) routesFor(ingress *networkingv1.Ingress, upstreams map[string]*Upstream) (routes []*Route) {
+	var err error
+	domain := rt.clusterDomain()
+
+	incomplete := !rt.secretsLoaded(ingress)
+	defer func() {
+		for _, route := range routes {
+			route.incomplete = incomplete
+		}
+	}()
+
+	l.Info("Processing ingress", "name", ingress.Name, "namespace", ingress.Namespace)
+
+	for _, rule := range ingress.Spec.Rules {
+
+		if rule.HTTP == nil {
+			continue
+		}
+
+		l.Info("Processing rule", "host", rule.Host, "ingress", ingress.Name, "namespace", ingress.Namespace)
+
+		for _, path := range rule.HTTP.Paths {
+
+			pathType := networkingv1.PathTypeImplementationSpecific
+			if path.PathType != nil {
+				pathType = *path.PathType
+			}
+
+			route := &Route{
+				Host:              rule.Host,
+				Path:              path.Path,
+				PathType:          string(pathType),
+				RewriteTarget:     annotationString(ingress, AnnotationRewriteTarget, ""),
+				Namespace:         ingress.Namespace,
+				Ingress:           ingress.Name,
+				CreationTimestamp: ingress.CreationTimestamp.Time,
+			}
+
+			if pathType == networkingv1.PathTypeImplementationSpecific && annotationBool(ingress, AnnotationUseRegex, false) {
+				route.Regex, err = compilePathRegex(path.Path)
+				if err != nil {
+					rt.warn(ingress, "InvalidPath", fmt.Sprintf("Skipping path of host %q: %v", rule.Host, err))
+					continue
 				}
 			}
+
+			if !rt.proxyRoute(route, upstreams, ingress, path.Backend, domain) {
+				incomplete = true
+				continue
+			}
+
+			l.Info("Adding route", "host", rule.Host, "path", path.Path, "upstream", route.Upstream.Key())
+			routes = append(routes, route)
 		}
-		return filtered
-	}()
+	}
+
+	if ingress.Spec.DefaultBackend == nil {
+		return routes
+	}
 
+	// Each host gets its own proxy, whose transport labels the metrics and
+	// the access log with the host.
+	for _, host := range ingressHosts(ingress) {
+		route := &Route{
+			Host:              host,
+			Path:              "/",
+			PathType:          string(networkingv1.PathTypePrefix),
+			Default:           true,
+			Namespace:         ingress.Namespace,
+			Ingress:           ingress.Name,
+			CreationTimestamp: ingress.CreationTimestamp.Time,
+		}
+		if !rt.proxyRoute(route, upstreams, ingress, *ingress.Spec.DefaultBackend, domain) {
+			incomplete = true
+			return routes
+		}
+
+		l.Info("Adding default backend", "host", host, "upstream", route.Upstream.Key(), "ingress", ingress.Name, "namespace", ingress.Namespace)
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+// swap makes data, the routes keyed by Ingress, and fallback the routes of
+// the table. Upstreams no route uses anymore are closed. The caller must hold
+// updateMu but not mu: the Secrets newly referenced are loaded first, and
+// loading them reloads the upstreams using them under mu.
+func (rt *routingTable) swap(data map[string][]*Route, fallback *Route) {
+	ingresses := routeSources(data)
+	defaultSecret := rt.defaultSecretKey()
+	rt.certStore.SetReferenced(referencedSecrets(ingresses, defaultSecret))
+
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	newCerts := newCertificateTable(defaultSecret)
 	for _, ingress := range ingresses {
+		rt.addIngressCertificates(newCerts, ingress)
+	}
 
-		l.Info("Processing ingress", "name", ingress.Name, "namespace", ingress.Namespace)
+	newUpstreams := rt.applyUpstreamPolicies(data, fallback)
 
-		for _, rule := range ingress.Spec.Rules {
+	stale := rt.upstreams
+	snapshot := newRoutingSnapshot(data, fallback)
+	rt.snapshot.Store(snapshot)
+	metrics.RoutingTableChanged(snapshot.len())
+	rt.certs = newCerts
+	rt.upstreams = newUpstreams
 
-			if rule.Host == "" || rule.HTTP == nil {
-				continue
+	for key, upstream := range stale {
+		if _, ok := newUpstreams[key]; !ok {
+			upstream.Close()
+		}
+	}
+}
+
+// routeSources returns the Ingresses routes were built from, oldest first.
+func routeSources(data map[string][]*Route) []*networkingv1.Ingress {
+	sources := make([]*Route, 0, len(data))
+	for _, routes := range data {
+		if len(routes) > 0 {
+			sources = append(sources, routes[0])
+		}
+	}
+	slices.SortFunc(sources, compareSources)
+
+	ingresses := make([]*networkingv1.Ingress, 0, len(sources))
+	for _, route := range sources {
+		ingresses = append(ingresses, route.source)
+	}
+	return ingresses
+}
+
+// applyUpstreamPolicies configures the upstreams of routes with the policy
+// of the oldest Ingress routing to them and returns them by key. The default
+// backend service only decides the policy of an upstream no Ingress uses.
+func (rt *routingTable) applyUpstreamPolicies(data map[string][]*Route, fallback *Route) map[string]*Upstream {
+	owners := make(map[string]*Route)
+	for _, routes := range data {
+		for _, route := range routes {
+			key := route.Upstream.Key()
+			if owner, ok := owners[key]; !ok || compareSources(route, owner) < 0 {
+				owners[key] = route
 			}
+		}
+	}
+	if fallback != nil {
+		if _, ok := owners[fallback.Upstream.Key()]; !ok {
+			owners[fallback.Upstream.Key()] = fallback
+		}
+	}
 
-			l.Info("Processing rule", "host", rule.Host, "ingress", ingress.Name, "namespace", ingress.Namespace)
+	upstreams := make(map[string]*Upstream, len(owners))
+	for key, route := range owners {
+		upstream := route.Upstream
+		upstream.SetBackend(route.policy.backend, rt.certStore)
+		upstream.SetHealthCheck(route.policy.healthCheck)
+		upstream.SetOutlierDetection(route.policy.outlierDetection)
+		upstream.SetCircuitBreaker(route.policy.circuitBreaker)
+		upstreams[key] = upstream
+	}
+	return upstreams
+}
 
-			for _, path := range rule.HTTP.Paths {
+// proxyRoute points route at the Service of backend, proxying through the
+// upstream for it in upstreams. It reports false when the backend cannot be
+// resolved.
+func (rt *routingTable) proxyRoute(route *Route, upstreams map[string]*Upstream, ingress *networkingv1.Ingress, backend networkingv1.IngressBackend, domain string) bool {
+	if backend.Service == nil && backend.Resource == nil {
+		return false
+	}
 
-				if path.Backend.Service == nil && path.Backend.Resource == nil {
-					continue
-				}
+	if backend.Resource != nil {
+		resource := backend.Resource
+		clusterResource, err := rt.kubeutils.GetResource(ingress.Namespace, resource.Kind, resource.Name)
+		if err != nil {
+			l.Info("Skipping resource backend due to error", "resource", backend.Resource.Name, "kind", backend.Resource.Kind, "error", err)
+			return false
+		}
 
-				if path.Backend.Resource != nil {
-					resource := path.Backend.Resource
-					clusterResource, err := rt.kubeutils.GetResource(ingress.Namespace, resource.Kind, resource.Name)
-					if err != nil {
-						l.Info("Skipping resource backend due to error", "resource", path.Backend.Resource.Name, "kind", path.Backend.Resource.Kind, "error", err)
-						continue
-					}
-
-					castResource, ok := clusterResource.(corev1.Service)
-					if !ok {
-						l.Info("Skipping resource backend due to invalid type", "resource", path.Backend.Resource.Name, "kind", path.Backend.Resource.Kind)
-						continue
-					}
-					l.Info("Resolved resource backend to service", "resource", path.Backend.Resource.Name, "kind", path.Backend.Resource.Kind, "service", castResource.Name, "port", castResource.Spec.Ports[0].Port)
-					path.Backend.Service = &networkingv1.IngressServiceBackend{
-						Name: castResource.Name,
-						Port: networkingv1.ServiceBackendPort{
-							Number: castResource.Spec.Ports[0].Port,
-						},
-					}
-					continue
-				}
+		castResource, ok := clusterResource.(corev1.Service)
+		if !ok {
+			l.Info("Skipping resource backend due to invalid type", "resource", backend.Resource.Name, "kind", backend.Resource.Kind)
+			return false
+		}
+		l.Info("Resolved resource backend to service", "resource", backend.Resource.Name, "kind", backend.Resource.Kind, "service", castResource.Name, "port", castResource.Spec.Ports[0].Port)
+		backend.Service = &networkingv1.IngressServiceBackend{
+			Name: castResource.Name,
+			Port: networkingv1.ServiceBackendPort{
+				Number: castResource.Spec.Ports[0].Port,
+			},
+		}
+		return false
+	}
 
-				if path.Backend.Service == nil {
-					continue
-				}
+	if backend.Service == nil {
+		return false
+	}
 
-				l.Info("Processing path", "path", path.Path, "service", path.Backend.Service.Name, "namespace", ingress.Namespace)
+	l.Info("Processing backend", "service", backend.Service.Name, "namespace", ingress.Namespace)
 
-				svc := path.Backend.Service
-				if svc.Name == "" {
-					continue
-				}
-				name := svc.Name
-				port := int32(0)
-
-				if path.Backend.Service.Port.Number != 0 {
-					port = path.Backend.Service.Port.Number
-				} else if path.Backend.Service.Port.Name != "" {
-					svcPort, err := rt.kubeutils.GetServicePortByName(ingress.Namespace, name, svc.Port.Name)
-					if err != nil {
-						l.Info("Skipping path due to error getting service port by name", "service", name, "portName", svc.Port.Name, "error", err)
-						continue
-					}
-					port = svcPort
-				}
+	svc := backend.Service
+	if svc.Name == "" {
+		return false
+	}
+	name := svc.Name
+	port := svc.Port.Number
+	serviceMode := rt.serviceUpstream(ingress)
+	address := fmt.Sprintf("%s.%s.svc.%s", name, ingress.Namespace, domain)
 
-				if port == 0 {
-					continue
+	if rt.resolver != nil {
+		service, servicePort, err := rt.resolver.ServicePort(ingress.Namespace, name, svc.Port)
+		if service != nil && service.Spec.Type == corev1.ServiceTypeExternalName {
+			serviceMode = true
+			address = service.Spec.ExternalName
+		}
+		if port == 0 && servicePort != nil {
+			port = servicePort.Port
+		} else if port == 0 {
+			l.Info("Skipping path due to error getting service port by name", "service", name, "portName", svc.Port.Name, "error", err)
+			return false
+		}
+	} else if port == 0 && svc.Port.Name != "" {
+		svcPort, err := rt.kubeutils.GetServicePortByName(ingress.Namespace, name, svc.Port.Name)
+		if err != nil {
+			l.Info("Skipping path due to error getting service port by name", "service", name, "portName", svc.Port.Name, "error", err)
+			return false
+		}
+		port = svcPort
+	}
+
+	if port == 0 {
+		return false
+	}
+
+	backendUrl := fmt.Sprintf("http://%s:%d", address, port)
+	u, err := url.Parse(backendUrl)
+	if err != nil {
+		return false
+	}
+
+	policy := rt.upstreamPolicyFor(ingress, svc.Name, serviceMode)
+	upstream := rt.upstreamFor(upstreams, ingress.Namespace, svc, serviceMode, &Endpoint{Address: address, Port: port})
+	balancer := rt.balancerFor(ingress)
+	affinity := rt.affinityFor(ingress)
+	retry := rt.retryPolicyFor(ingress)
+	timeouts := rt.timeoutsFor(ingress)
+
+	// proxy := httputil.NewSingleHostReverseProxy(u)
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(req *httputil.ProxyRequest) {
+			defer req.Out.Context()
+			headers := req.In.Header
+			mustSkip := false
+
+			for key, values := range headers {
+				if slices.ContainsFunc(values, regexp.MustCompile(`[%^\s<>\\\(\)\[\]]`).MatchString) {
+					mustSkip = true
 				}
 
-				l.Info("Adding route", "host", rule.Host, "path", path.Path, "service", name, "namespace", ingress.Namespace, "port", port)
-				backendUrl := fmt.Sprintf("http://%s.%s.svc.%s:%d", name, ingress.Namespace, domain, port)
-				u, err := url.Parse(backendUrl)
-				if err != nil {
+				if mustSkip {
+					mustSkip = false
 					continue
 				}
 
-				protos := &http.Protocols{}
-				protos.SetHTTP1(true)
-				protos.SetHTTP2(true)
-
-				// proxy := httputil.NewSingleHostReverseProxy(u)
-				proxy := &httputil.ReverseProxy{
-					Rewrite: func(req *httputil.ProxyRequest) {
-						defer req.Out.Context()
-						headers := req.In.Header
-						mustSkip := false
-
-						for key, values := range headers {
-							if slices.ContainsFunc(values, regexp.MustCompile(`[%^\s<>\\\(\)\[\]]`).MatchString) {
-								mustSkip = true
-							}
-
-							if mustSkip {
-								mustSkip = false
-								continue
-							}
-
-							for _, value := range values {
-								req.Out.Header.Add(key, value)
-							}
-						}
-						req.Out.URL.Scheme = u.Scheme
-						req.Out.URL.Host = u.Host
-						req.Out.AddCookie(&http.Cookie{
-							Name:  "panacea-auth",
-							Value: "true",
-						})
-						resp := &http.Response{
-							Status:        "200 OK",
-							StatusCode:    200,
-							Header:        req.Out.Header,
-							Body:          req.Out.Body,
-							ContentLength: req.Out.ContentLength,
-						}
-						req.Out.Response = resp
-
-						req.SetXForwarded()
-						req.SetURL(u)
-						req.Out.Host = req.In.Host
-					},
-
-					Transport: &http.Transport{
-						MaxIdleConns:          100,
-						IdleConnTimeout:       90,
-						TLSHandshakeTimeout:   10,
-						ExpectContinueTimeout: 1,
-						TLSClientConfig:       &tls.Config{InsecureSkipVerify: true},
-						Protocols:             protos,
-						MaxConnsPerHost:       100,
-					},
-					ErrorLog: log.Default(),
+				for _, value := range values {
+					req.Out.Header.Add(key, value)
 				}
+			}
+			req.Out.URL.Scheme = u.Scheme
+			req.Out.URL.Host = u.Host
+			resp := &http.Response{
+				Status:        "200 OK",
+				StatusCode:    200,
+				Header:        req.Out.Header,
+				Body:          req.Out.Body,
+				ContentLength: req.Out.ContentLength,
+			}
+			req.Out.Response = resp
+
+			req.SetXForwarded()
+			req.SetURL(u)
+			req.Out.Host = req.In.Host
+
+			if route.RewriteTarget != "" {
+				req.Out.URL.Path = rewritePath(route, req.In.URL.Path)
+				req.Out.URL.RawPath = ""
+			}
+		},
+
+		// The transport replaces the Service address with the endpoint the
+		// balancer picks for each request.
+		Transport:    &routeTransport{route: route, upstream: upstream, balancer: balancer, affinity: affinity, retry: retry, budget: rt.budget, timeouts: timeouts},
+		ErrorHandler: proxyErrorHandler,
+		ErrorLog:     log.Default(),
+		// gRPC streams must reach the client as they are written.
+		FlushInterval: flushInterval(policy.backend),
+	}
+
+	route.Upstream = upstream
+	route.Balancer = balancer
+	route.Proxy = proxy
+	route.policy = policy
+	route.source = ingress
+	return true
+}
+
+// SetEndpointResolver makes the routing table proxy to pod endpoints. Without
+// a resolver every backend is reached through its Service DNS name.
+func (rt *routingTable) SetEndpointResolver(resolver *EndpointResolver) {
+	rt.resolver = resolver
+}
+
+// SetEventRecorder makes the routing table report Ingress problems as
+// Events on the Ingress.
+func (rt *routingTable) SetEventRecorder(recorder record.EventRecorder) {
+	rt.recorder = recorder
+}
+
+// warn logs a problem with ingress and reports it on the Ingress.
+func (rt *routingTable) warn(ingress *networkingv1.Ingress, reason, message string) {
+	l.Info(message, "ingress", ingress.Name, "namespace", ingress.Namespace, "reason", reason)
+	if rt.recorder != nil {
+		rt.recorder.Event(ingress, corev1.EventTypeWarning, reason, message)
+	}
+}
+
+// EndpointsHandler returns the event handler that keeps upstream endpoints in
+// sync with Services and EndpointSlices.
+func (rt *routingTable) EndpointsHandler() cache.ResourceEventHandler {
+	return &endpointsHandler{refresh: rt.refreshEndpoints}
+}
+
+// balancerFor returns a new balancer configured from the annotations of
+// ingress, falling back to the --load-balance algorithm.
+func (rt *routingTable) balancerFor(ingress *networkingv1.Ingress) Balancer {
+	cfg := balancerConfig{
+		algorithm: annotationString(ingress, AnnotationLoadBalance, rt.config.LoadBalance),
+		hashBy:    annotationString(ingress, AnnotationUpstreamHashBy, ""),
+	}
+
+	if value := annotationString(ingress, AnnotationUpstreamWeights, ""); value != "" {
+		weights, err := parseWeights(value)
+		if err != nil {
+			l.Info("Ignoring invalid annotation", "annotation", AnnotationUpstreamWeights, "ingress", ingress.Name, "namespace", ingress.Namespace, "error", err)
+		}
+		cfg.weights = weights
+	}
+
+	balancer, err := newBalancer(cfg)
+	if err != nil {
+		l.Info("Invalid load balancer, using round-robin", "ingress", ingress.Name, "namespace", ingress.Namespace, "error", err)
+		return &roundRobin{}
+	}
+	return balancer
+}
+
+// affinityFor returns the cookie affinity configured by the annotations of
+// ingress, or nil when affinity is off.
+func (rt *routingTable) affinityFor(ingress *networkingv1.Ingress) *cookieAffinity {
+	mode := annotationString(ingress, AnnotationAffinity, "")
+	if mode == "" {
+		return nil
+	}
+	if mode != AffinityCookie {
+		l.Info("Ignoring unsupported affinity mode", "mode", mode, "ingress", ingress.Name, "namespace", ingress.Namespace)
+		return nil
+	}
 
-				route := &Route{
-					Path:     path.Path,
-					PathType: string(*path.PathType),
-					Backend:  u,
-					Proxy:    proxy,
+	sameSite, ok := parseSameSite(annotationString(ingress, AnnotationSessionCookieSameSite, ""))
+	if !ok {
+		l.Info("Ignoring invalid annotation", "annotation", AnnotationSessionCookieSameSite, "ingress", ingress.Name, "namespace", ingress.Namespace)
+	}
+
+	return &cookieAffinity{
+		name:     annotationString(ingress, AnnotationSessionCookieName, defaultSessionCookieName),
+		path:     annotationString(ingress, AnnotationSessionCookiePath, defaultSessionCookiePath),
+		maxAge:   annotationInt(ingress, AnnotationSessionCookieMaxAge, 0),
+		sameSite: sameSite,
+		key:      rt.cookieKey,
+	}
+}
+
+// retryPolicyFor returns the retry policy configured by the annotations of
+// ingress and the controller defaults, or nil when retries are off.
+func (rt *routingTable) retryPolicyFor(ingress *networkingv1.Ingress) *RetryPolicy {
+	attempts := annotationInt(ingress, AnnotationRetryAttempts, rt.config.RetryAttempts)
+	if attempts <= 1 {
+		return nil
+	}
+
+	on, err := parseRetryOn(annotationString(ingress, AnnotationRetryOn, rt.config.RetryOn))
+	if err != nil {
+		l.Info("Ignoring invalid annotation", "annotation", AnnotationRetryOn, "ingress", ingress.Name, "namespace", ingress.Namespace, "error", err)
+		on, _ = parseRetryOn(rt.config.RetryOn)
+	}
+	if on == 0 {
+		return nil
+	}
+
+	return &RetryPolicy{
+		Attempts:      attempts,
+		On:            on,
+		PerTryTimeout: annotationDuration(ingress, AnnotationRetryPerTryTimeout, rt.config.RetryPerTryTimeout),
+		NonIdempotent: annotationBool(ingress, AnnotationRetryNonIdempotent, rt.config.RetryNonIdempotent),
+	}
+}
+
+// timeoutsFor returns the upstream timeouts configured by the annotations of
+// ingress and the controller defaults.
+func (rt *routingTable) timeoutsFor(ingress *networkingv1.Ingress) Timeouts {
+	return Timeouts{
+		Connect:        annotationDuration(ingress, AnnotationConnectTimeout, rt.config.UpstreamConnectTimeout),
+		ResponseHeader: annotationDuration(ingress, AnnotationResponseHeaderTimeout, rt.config.UpstreamResponseHeaderTimeout),
+		Request:        annotationDuration(ingress, AnnotationRequestTimeout, rt.config.UpstreamRequestTimeout),
+	}
+}
+
+// healthCheckFor returns the active health check configured by the
+// annotations of ingress and the controller defaults, or nil when off.
+func (rt *routingTable) healthCheckFor(ingress *networkingv1.Ingress) *HealthCheck {
+	path := annotationString(ingress, AnnotationHealthCheckPath, rt.config.HealthCheckPath)
+	if path == "" {
+		return nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	healthCheck := &HealthCheck{
+		Path:               path,
+		Interval:           annotationDuration(ingress, AnnotationHealthCheckInterval, rt.config.HealthCheckInterval),
+		Timeout:            annotationDuration(ingress, AnnotationHealthCheckTimeout, rt.config.HealthCheckTimeout),
+		HealthyThreshold:   annotationInt(ingress, AnnotationHealthCheckHealthyThreshold, rt.config.HealthCheckHealthyThreshold),
+		UnhealthyThreshold: annotationInt(ingress, AnnotationHealthCheckUnhealthyThreshold, rt.config.HealthCheckUnhealthyThreshold),
+	}
+
+	if healthCheck.Interval <= 0 {
+		healthCheck.Interval = 10 * time.Second
+	}
+	if healthCheck.Timeout <= 0 || healthCheck.Timeout > healthCheck.Interval {
+		healthCheck.Timeout = healthCheck.Interval
+	}
+	healthCheck.HealthyThreshold = max(healthCheck.HealthyThreshold, 1)
+	healthCheck.UnhealthyThreshold = max(healthCheck.UnhealthyThreshold, 1)
+
+	return healthCheck
+}
+
+// outlierDetectionFor returns the outlier detection configured by the
+// annotations of ingress and the controller defaults, or nil when off.
+func (rt *routingTable) outlierDetectionFor(ingress *networkingv1.Ingress) *OutlierDetection {
+	outlierDetection := &OutlierDetection{
+		ConsecutiveErrors:  annotationInt(ingress, AnnotationOutlierConsecutiveErrors, rt.config.OutlierConsecutiveErrors),
+		BaseEjectionTime:   annotationDuration(ingress, AnnotationOutlierBaseEjectionTime, rt.config.OutlierBaseEjectionTime),
+		MaxEjectionTime:    annotationDuration(ingress, AnnotationOutlierMaxEjectionTime, rt.config.OutlierMaxEjectionTime),
+		MaxEjectionPercent: annotationInt(ingress, AnnotationOutlierMaxEjectionPercent, rt.config.OutlierMaxEjectionPercent),
+	}
+	if outlierDetection.ConsecutiveErrors <= 0 {
+		return nil
+	}
+
+	if outlierDetection.BaseEjectionTime <= 0 {
+		outlierDetection.BaseEjectionTime = 30 * time.Second
+	}
+	if outlierDetection.MaxEjectionTime < outlierDetection.BaseEjectionTime {
+		outlierDetection.MaxEjectionTime = max(5*time.Minute, outlierDetection.BaseEjectionTime)
+	}
+	outlierDetection.MaxEjectionPercent = min(max(outlierDetection.MaxEjectionPercent, 0), 100)
+
+	return outlierDetection
+}
+
+// circuitBreakerFor returns the request limits configured by the annotations
+// of ingress and the controller defaults, or nil when unlimited.
+func (rt *routingTable) circuitBreakerFor(ingress *networkingv1.Ingress) *CircuitBreaker {
+	circuitBreaker := &CircuitBreaker{
+		MaxRequests:        annotationInt(ingress, AnnotationMaxConcurrentRequests, rt.config.MaxConcurrentRequests),
+		MaxPendingRequests: annotationInt(ingress, AnnotationMaxPendingRequests, rt.config.MaxPendingRequests),
+	}
+	if circuitBreaker.MaxRequests <= 0 {
+		return nil
+	}
+	circuitBreaker.MaxPendingRequests = max(circuitBreaker.MaxPendingRequests, 0)
+
+	return circuitBreaker
+}
+
+// backendSecretKey returns the key of the backend TLS Secret of ingress.
+// The Secret must live in the namespace of the Ingress.
+func backendSecretKey(ingress *networkingv1.Ingress) (string, bool) {
+	name := annotationString(ingress, AnnotationBackendTLSSecret, "")
+	if name == "" || strings.Contains(name, "/") {
+		return "", false
+	}
+	return secretKey(ingress.Namespace, name), true
+}
+
+// backendFor returns how the endpoints of Service service are spoken to,
+// from the annotations of ingress. Pod endpoints are verified against the
+// Service DNS name unless another server name is set.
+func (rt *routingTable) backendFor(ingress *networkingv1.Ingress, service string, serviceMode bool) Backend {
+	protocol, err := parseProtocol(annotationString(ingress, AnnotationBackendProtocol, ""))
+	if err != nil {
+		l.Info("Ignoring invalid annotation", "annotation", AnnotationBackendProtocol, "ingress", ingress.Name, "namespace", ingress.Namespace, "error", err)
+		protocol = ProtocolHTTP
+	}
+
+	backend := Backend{Protocol: protocol}
+	if !backend.TLS() {
+		return backend
+	}
+
+	if name := annotationString(ingress, AnnotationBackendTLSSecret, ""); name != "" {
+		key, ok := backendSecretKey(ingress)
+		if !ok {
+			l.Info("Ignoring invalid annotation, the secret must be in the namespace of the ingress", "annotation", AnnotationBackendTLSSecret, "ingress", ingress.Name, "namespace", ingress.Namespace)
+		}
+		backend.Secret = key
+	}
+
+	backend.ServerName = annotationString(ingress, AnnotationBackendTLSServerName, "")
+	if backend.ServerName == "" && !serviceMode {
+		backend.ServerName = fmt.Sprintf("%s.%s.svc", service, ingress.Namespace)
+	}
+	return backend
+}
+
+func flushInterval(backend Backend) time.Duration {
+	if backend.GRPC() {
+		return -1
+	}
+	return 0
+}
+
+// upstreamPolicy is the configuration of an upstream, as opposed to the
+// per-route balancing and affinity settings.
+type upstreamPolicy struct {
+	backend          Backend
+	healthCheck      *HealthCheck
+	outlierDetection *OutlierDetection
+	circuitBreaker   *CircuitBreaker
+}
+
+func (rt *routingTable) upstreamPolicyFor(ingress *networkingv1.Ingress, service string, serviceMode bool) upstreamPolicy {
+	return upstreamPolicy{
+		backend:          rt.backendFor(ingress, service, serviceMode),
+		healthCheck:      rt.healthCheckFor(ingress),
+		outlierDetection: rt.outlierDetectionFor(ingress),
+		circuitBreaker:   rt.circuitBreakerFor(ingress),
+	}
+}
+
+// reloadBackendSecret makes the upstreams using the backend TLS Secret key
+// pick up its new content.
+func (rt *routingTable) reloadBackendSecret(key string) {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+
+	for _, upstream := range rt.upstreams {
+		upstream.reloadBackendSecret(key)
+	}
+}
+
+// Upstreams returns the upstreams of the current table, sorted by key, so
+// callers can inspect the health of their endpoints.
+func (rt *routingTable) Upstreams() []*Upstream {
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+
+	upstreams := slices.Collect(maps.Values(rt.upstreams))
+	slices.SortFunc(upstreams, func(a, b *Upstream) int {
+		return strings.Compare(a.Key(), b.Key())
+	})
+	return upstreams
+}
+
+func (rt *routingTable) serviceUpstream(ingress *networkingv1.Ingress) bool {
+	if rt.resolver == nil {
+		return true
+	}
+	return annotationBool(ingress, AnnotationServiceUpstream, rt.config.ServiceUpstream)
+}
+
+// upstreamFor returns the upstream for the Service backend svc, reusing the
+// one from the current table so endpoint state and connections survive the
+// rebuild. serviceEndpoint is the Service address used in service mode. Its
+// policy is applied once the routes using it are swapped in.
+func (rt *routingTable) upstreamFor(upstreams map[string]*Upstream, namespace string, svc *networkingv1.IngressServiceBackend, serviceMode bool, serviceEndpoint *Endpoint) *Upstream {
+	key := upstreamKey(namespace, svc.Name, svc.Port, serviceMode)
+	if upstream, ok := upstreams[key]; ok {
+		return upstream
+	}
+
+	rt.mu.RLock()
+	upstream, ok := rt.upstreams[key]
+	rt.mu.RUnlock()
+	if !ok {
+		upstream = newUpstream(namespace, svc.Name, svc.Port, serviceMode)
+	}
+
+	if serviceMode {
+		upstream.SetEndpoints([]*Endpoint{serviceEndpoint})
+	} else {
+		endpoints, err := rt.resolver.Resolve(namespace, svc.Name, svc.Port)
+		if err != nil {
+			l.Info("Error resolving endpoints", "upstream", key, "error", err)
+		}
+		upstream.SetEndpoints(endpoints)
+	}
+
+	upstreams[key] = upstream
+	return upstream
+}
+
+// refreshEndpoints re-resolves the endpoints of every upstream of Service
+// namespace/service.
+func (rt *routingTable) refreshEndpoints(namespace, service string) {
+	if rt.resolver == nil {
+		return
+	}
+
+	rt.mu.RLock()
+	defer rt.mu.RUnlock()
+
+	for key, upstream := range rt.upstreams {
+		if upstream.ServiceMode || upstream.Namespace != namespace || upstream.Service != service {
+			continue
+		}
+
+		endpoints, err := rt.resolver.Resolve(namespace, service, upstream.Port)
+		if err != nil {
+			l.Info("Error resolving endpoints", "upstream", key, "error", err)
+		}
+		upstream.SetEndpoints(endpoints)
+		l.Info("Endpoints updated", "upstream", key, "endpoints", len(endpoints))
+	}
+}
+
+// referencedSecrets returns the keys of the Secrets used for TLS by ingresses,
+// towards clients and towards backends, plus the default certificate Secret
+// when one is configured.
+func referencedSecrets(ingresses []*networkingv1.Ingress, defaultSecret string) []string {
+	keys := make([]string, 0, len(ingresses)+1)
+	if defaultSecret != "" {
+		keys = append(keys, defaultSecret)
+	}
+	for _, ingress := range ingresses {
+		for _, ingressTLS := range ingress.Spec.TLS {
+			if ingressTLS.SecretName != "" {
+				keys = append(keys, secretKey(ingress.Namespace, ingressTLS.SecretName))
+			}
+		}
+		if key, ok := backendSecretKey(ingress); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// secretsLoaded reports whether the certificates of the spec.tls section of
+// ingress that list no hosts are loaded, as their hosts come from the
+// certificate.
+func (rt *routingTable) secretsLoaded(ingress *networkingv1.Ingress) bool {
+	for _, ingressTLS := range ingress.Spec.TLS {
+		if ingressTLS.SecretName != "" && len(ingressTLS.Hosts) == 0 && rt.certStore.Get(secretKey(ingress.Namespace, ingressTLS.SecretName)) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// addIngressCertificates registers the Secrets referenced by the spec.tls
+// section of ingress for their hosts.
+func (rt *routingTable) addIngressCertificates(certs *certificateTable, ingress *networkingv1.Ingress) {
+	for _, ingressTLS := range ingress.Spec.TLS {
+		if ingressTLS.SecretName == "" {
+			continue
+		}
+
+		key := secretKey(ingress.Namespace, ingressTLS.SecretName)
+		cert := rt.certStore.Get(key)
+		if cert == nil {
+			l.Info("TLS secret not loaded yet", "secret", key, "ingress", ingress.Name)
+		}
+
+		hosts := ingressTLS.Hosts
+		if len(hosts) == 0 && cert != nil && cert.Leaf != nil {
+			hosts = cert.Leaf.DNSNames
+		}
+
+		for _, host := range hosts {
+			if cert != nil && cert.Leaf != nil && !strings.HasPrefix(host, "*.") {
+				if err := cert.Leaf.VerifyHostname(host); err != nil {
+					l.Info("TLS certificate does not cover host", "host", host, "secret", key, "error", err)
 				}
-				newData[rule.Host] = append(newData[rule.Host], route)
 			}
+
+			if !certs.add(host, key) {
+				l.Info("Ignoring duplicate TLS host", "host", host, "secret", key, "ingress", ingress.Name)
+				continue
+			}
+			l.Info("Adding TLS certificate", "host", host, "secret", key)
 		}
 	}
+}
 
-	for h := range newData {
-		sort.Slice(newData[h], func(i, j int) bool {
-			return len(newData[h][i].Path) > len(newData[h][j].Path)
-		})
+func (rt *routingTable) getSecret(namespace, name string) (*corev1.Secret, error) {
+	resource, err := rt.kubeutils.GetResource(namespace, name, "secret")
+	if err != nil {
+		return nil, err
 	}
 
-	rt.mu.Lock()
-	defer rt.mu.Unlock()
-	rt.data = newData
+	secret, ok := resource.(*corev1.Secret)
+	if !ok {
+		return nil, fmt.Errorf("resource %s/%s is not a secret", namespace, name)
+	}
+
+	return secret, nil
+}
+
+// defaultSecretKey returns the key of the --default-tls-secret Secret, or an
+// empty string when it is unset or malformed.
+func (rt *routingTable) defaultSecretKey() string {
+	if rt.config.DefaultTLSSecret == "" {
+		return ""
+	}
+
+	namespace, name, ok := strings.Cut(rt.config.DefaultTLSSecret, "/")
+	if !ok || namespace == "" || name == "" {
+		l.Info("Invalid default TLS secret, expected namespace/name", "secret", rt.config.DefaultTLSSecret)
+		return ""
+	}
+
+	return secretKey(namespace, name)
+}
+
+// Certificates returns the store holding the certificates of referenced Secrets.
+func (rt *routingTable) Certificates() *CertificateStore {
+	return rt.certStore
+}
+
+// GetCertificate selects the certificate for a TLS handshake based on SNI. It
+// is meant to be used as tls.Config.GetCertificate.
+func (rt *routingTable) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	rt.mu.RLock()
+	certs := rt.certs
+	rt.mu.RUnlock()
+
+	if cert := rt.certStore.Get(certs.lookup(hello.ServerName)); cert != nil {
+		return cert, nil
+	}
+
+	if rt.fakeCert != nil {
+		return rt.fakeCert, nil
+	}
 
-	l.Info("Routing table updated", "data", rt.String())
+	return nil, fmt.Errorf("no certificate available for %q", hello.ServerName)
 }
 
 func (rt *routingTable) String() string {
 	var sb strings.Builder
-	for host, routes := range rt.ListAllRoutes() {
-		fmt.Fprintf(&sb, "Host: %s", host)
+	for ingress, routes := range rt.ListAllRoutes() {
+		fmt.Fprintf(&sb, "Ingress: %s", ingress)
 		fmt.Fprintln(&sb, "")
 		for _, route := range routes {
+			fmt.Fprintf(&sb, "  Host: %s,", route.Host)
+			fmt.Fprintln(&sb, "")
 			fmt.Fprintf(&sb, "  Path: %s,", route.Path)
 			fmt.Fprintln(&sb, "")
 			fmt.Fprintf(&sb, "  PathType: %s", route.PathType)
 			fmt.Fprintln(&sb, "")
-			fmt.Fprintf(&sb, "  Backend: %s", route.Backend.String())
+			fmt.Fprintf(&sb, "  Upstream: %s", route.Upstream.Key())
+			fmt.Fprintln(&sb, "")
+			fmt.Fprintf(&sb, "  Balancer: %s", route.Balancer.Name())
+			fmt.Fprintln(&sb, "")
+			fmt.Fprintf(&sb, "  Endpoints: %s", route.Upstream.String())
 			fmt.Fprintln(&sb, "")
 		}
 	}
 	return sb.String()
 }
 
+// Match returns the route serving reqPath on host. It reads the current
+// snapshot of the table without locking.
 func (rt *routingTable) Match(host, reqPath string) *Route {
-	routes, exists := rt.ListAllRoutes()[host]
-	if !exists {
-		return nil
+	route := rt.snapshot.Load().match(host, reqPath)
+	if route != nil && l.V(1).Enabled() {
+		l.V(1).Info("Matched route", "type", route.PathType, "host", host, "path", route.Path, "default", route.Default, "upstream", route.Upstream.Key())
 	}
-
-	for _, route := range routes {
-		switch route.PathType {
-		case string(networkingv1.PathTypeExact):
-			l.Info("Matched route", "type", route.PathType, "host", host, "path", route.Path, "backend", route.Backend)
-			if reqPath == route.Path {
-				return route
-			}
-		case string(networkingv1.PathTypePrefix):
-			l.Info("Matched route", "type", route.PathType, "host", host, "path", route.Path, "backend", route.Backend)
-			if strings.HasPrefix(reqPath, route.Path) {
-				return route
-			}
-		default:
-			l.Info("Matched route", "type", route.PathType, "host", host, "path", route.Path, "backend", route.Backend)
-			if strings.HasPrefix(reqPath, route.Path) {
-				return route
-			}
-		}
-	}
-
-	return nil
+	return route
 }
 
+// GetRoutes returns the routes of the Ingress with the namespace/name key.
 func (rt *routingTable) GetRoutes(ingressKey string) []*Route {
-	if _, exists := rt.ListAllRoutes()[ingressKey]; !exists {
-		return nil
-	}
-
-	return rt.ListAllRoutes()[ingressKey]
+	return rt.snapshot.Load().ingresses[ingressKey]
 }
 
+// SetRoutes replaces the routes of the Ingress with the namespace/name key.
 func (rt *routingTable) SetRoutes(ingressKey string, routes []*Route) {
-	rt.data[ingressKey] = routes
+	rt.updateRoutes(func(data map[string][]*Route) {
+		data[ingressKey] = slices.Clone(routes)
+	})
 }
 
+// DeleteRoutes removes the routes of the Ingress with the namespace/name key.
 func (rt *routingTable) DeleteRoutes(ingressKey string) {
-	delete(rt.data, ingressKey)
+	rt.updateRoutes(func(data map[string][]*Route) {
+		delete(data, ingressKey)
+	})
 }
 
+// updateRoutes swaps in a snapshot with the routes of the current one as
+// changed by update.
+func (rt *routingTable) updateRoutes(update func(data map[string][]*Route)) {
+	rt.updateMu.Lock()
+	defer rt.updateMu.Unlock()
+
+	current := rt.snapshot.Load()
+	data := maps.Clone(current.ingresses)
+	update(data)
+	rt.swap(data, current.fallback)
+}
+
+// ListAllRoutes returns the routes of the table keyed by Ingress.
 func (rt *routingTable) ListAllRoutes() map[string][]*Route {
 	// Create a copy to avoid external modification
-	copy := make(map[string][]*Route)
-	maps.Copy(copy, rt.data)
-	return copy
+	return maps.Clone(rt.snapshot.Load().ingresses)
 }
 
 func (rt *routingTable) Clear() {
-	rt.data = make(map[string][]*Route)
+	for _, upstream := range rt.upstreams {
+		upstream.Close()
+	}
+	rt.snapshot.Store(newRoutingSnapshot(make(map[string][]*Route), nil))
+	rt.upstreams = make(map[string]*Upstream)
+	rt.certs = newCertificateTable("")
 }
@@ -1,6 +1,16 @@
 package routing
 
-import "testing"
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/danCrespo/panacea-ingress-controller/config"
+	"github.com/go-logr/logr"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest"
+)
 
 func TestRoutingModel(t *testing.T) {
 	t.Run("hello world", func(t *testing.T) {
@@ -8,4 +18,233 @@ func TestRoutingModel(t *testing.T) {
 			t.Errorf("Expected 1 + 1 to equal 2")
 		}
 	})
-}
\ No newline at end of file
+}
+
+// fakeKubeutils stands in for the cluster in routing table tests.
+type fakeKubeutils struct{}
+
+func (fakeKubeutils) GetClusterConfig() (*rest.Config, error) { return nil, fmt.Errorf("no cluster") }
+func (fakeKubeutils) GetClusterName() (string, error)         { return "test", nil }
+func (fakeKubeutils) GetNamespace() (string, error)           { return "default", nil }
+func (fakeKubeutils) GetClusterDomain() (string, error)       { return "cluster.local", nil }
+func (fakeKubeutils) GetResource(_, _, _ string) (any, error) { return nil, fmt.Errorf("no cluster") }
+func (fakeKubeutils) GetServicePortByName(_, _, _ string) (int32, error) {
+	return 0, fmt.Errorf("no cluster")
+}
+func (fakeKubeutils) SetLogger(logr.Logger) {}
+
+func newTestRoutingTable(t *testing.T) *routingTable {
+	t.Helper()
+
+	rt := newRoutingTableWith(config.Config{IngressClass: "panacea"}, fakeKubeutils{})
+	t.Cleanup(rt.Clear)
+	return rt
+}
+
+type testPath struct {
+	path     string
+	pathType networkingv1.PathType
+	service  string
+}
+
+func newTestIngress(namespace, name string, created time.Time, host string, paths ...testPath) *networkingv1.Ingress {
+	class := "panacea"
+	ingressPaths := make([]networkingv1.HTTPIngressPath, 0, len(paths))
+	for _, p := range paths {
+		pathType := p.pathType
+		ingressPaths = append(ingressPaths, networkingv1.HTTPIngressPath{
+			Path:     p.path,
+			PathType: &pathType,
+			Backend: networkingv1.IngressBackend{
+				Service: &networkingv1.IngressServiceBackend{
+					Name: p.service,
+					Port: networkingv1.ServiceBackendPort{Number: 80},
+				},
+			},
+		})
+	}
+
+	return &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         namespace,
+			Name:              name,
+			CreationTimestamp: metav1.NewTime(created),
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: &class,
+			Rules: []networkingv1.IngressRule{{
+				Host: host,
+				IngressRuleValue: networkingv1.IngressRuleValue{
+					HTTP: &networkingv1.HTTPIngressRuleValue{Paths: ingressPaths},
+				},
+			}},
+		},
+	}
+}
+
+func TestRoutingTableMatchAcrossIngresses(t *testing.T) {
+	now := time.Now()
+	older := newTestIngress("team-b", "older", now.Add(-time.Hour), "app.example.com",
+		testPath{"/api", networkingv1.PathTypePrefix, "older"})
+	newer := newTestIngress("team-a", "newer", now, "app.example.com",
+		testPath{"/api", networkingv1.PathTypePrefix, "newer"},
+		testPath{"/api/v2", networkingv1.PathTypePrefix, "v2"})
+	sameAge := newTestIngress("team-a", "same-age", now.Add(-time.Hour), "app.example.com",
+		testPath{"/api", networkingv1.PathTypePrefix, "same-age"})
+
+	for _, order := range [][]*networkingv1.Ingress{
+		{older, newer, sameAge},
+		{newer, sameAge, older},
+		{sameAge, older, newer},
+	} {
+		rt := newTestRoutingTable(t)
+		rt.UpdateFromIngresses(order, testClasses(t))
+
+		tests := []struct {
+			path     string
+			expected string
+		}{
+			// team-a/same-age and team-b/older are as old, the namespace breaks the tie.
+			{"/api", "same-age"},
+			{"/api/users", "same-age"},
+			{"/api/v2/users", "v2"},
+			{"/apiv2", ""},
+		}
+
+		for _, tt := range tests {
+			route := rt.Match("app.example.com", tt.path)
+			got := ""
+			if route != nil {
+				got = route.Upstream.Service
+			}
+			if got != tt.expected {
+				t.Errorf("Match(%q): expected service %q, got %q", tt.path, tt.expected, got)
+			}
+		}
+	}
+}
+
+func TestRoutingTableMatchHosts(t *testing.T) {
+	now := time.Now()
+	rt := newTestRoutingTable(t)
+	rt.UpdateFromIngresses([]*networkingv1.Ingress{
+		newTestIngress("default", "exact", now, "app.example.com", testPath{"/api", networkingv1.PathTypePrefix, "exact"}),
+		newTestIngress("default", "wildcard", now, "*.example.com", testPath{"/", networkingv1.PathTypePrefix, "wildcard"}),
+		newTestIngress("default", "catch-all", now, "", testPath{"/", networkingv1.PathTypePrefix, "catch-all"}),
+	}, testClasses(t))
+
+	tests := []struct {
+		host     string
+		path     string
+		expected string
+	}{
+		{"app.example.com", "/api", "exact"},
+		{"app.example.com", "/", ""},
+		{"api.example.com", "/", "wildcard"},
+		{"a.b.example.com", "/", "catch-all"},
+		{"example.org", "/anything", "catch-all"},
+	}
+
+	for _, tt := range tests {
+		route := rt.Match(tt.host, tt.path)
+		got := ""
+		if route != nil {
+			got = route.Upstream.Service
+		}
+		if got != tt.expected {
+			t.Errorf("Match(%q, %q): expected service %q, got %q", tt.host, tt.path, tt.expected, got)
+		}
+	}
+}
+
+func TestRoutingTableIngressRoutes(t *testing.T) {
+	now := time.Now()
+	rt := newTestRoutingTable(t)
+	app := newTestIngress("default", "app", now, "app.example.com", testPath{"/", networkingv1.PathTypePrefix, "app"})
+	api := newTestIngress("default", "api", now, "app.example.com", testPath{"/api", networkingv1.PathTypePrefix, "api"})
+	rt.UpdateFromIngresses([]*networkingv1.Ingress{app}, testClasses(t))
+
+	if routes := rt.GetRoutes("default/app"); len(routes) != 1 || routes[0].Host != "app.example.com" {
+		t.Fatalf("Expected the route of default/app, got %v", routes)
+	}
+
+	rt.SetRoutes("default/api", rt.RoutesFor(api))
+	if route := rt.Match("app.example.com", "/api/users"); route == nil || route.Upstream.Service != "api" {
+		t.Errorf("Expected the route of default/api to be matched, got %v", route)
+	}
+	if route := rt.Match("app.example.com", "/"); route == nil || route.Upstream.Service != "app" {
+		t.Errorf("Expected the route of default/app to be kept, got %v", route)
+	}
+	if upstreams := rt.Upstreams(); len(upstreams) != 2 {
+		t.Errorf("Expected 2 upstreams, got %d", len(upstreams))
+	}
+
+	rt.DeleteRoutes("default/api")
+	if route := rt.Match("app.example.com", "/api/users"); route == nil || route.Upstream.Service != "app" {
+		t.Errorf("Expected the route of default/app after deleting default/api, got %v", route)
+	}
+	if upstreams := rt.Upstreams(); len(upstreams) != 1 || upstreams[0].Service != "app" {
+		t.Errorf("Expected the upstream of default/api to be dropped, got %v", upstreams)
+	}
+}
+
+func TestRoutingTableUpstreamPolicyFromOldestIngress(t *testing.T) {
+	now := time.Now()
+	rt := newTestRoutingTable(t)
+	older := newTestIngress("default", "older", now.Add(-time.Hour), "a.example.com", testPath{"/", networkingv1.PathTypePrefix, "shared"})
+	older.Annotations = map[string]string{AnnotationMaxConcurrentRequests: "10"}
+	newer := newTestIngress("default", "newer", now, "b.example.com", testPath{"/", networkingv1.PathTypePrefix, "shared"})
+	newer.Annotations = map[string]string{AnnotationMaxConcurrentRequests: "20"}
+
+	rt.SetRoutes("default/newer", rt.RoutesFor(newer))
+	rt.SetRoutes("default/older", rt.RoutesFor(older))
+
+	upstreams := rt.Upstreams()
+	if len(upstreams) != 1 {
+		t.Fatalf("Expected both Ingresses to share an upstream, got %d", len(upstreams))
+	}
+	if cb := upstreams[0].CircuitBreaker(); cb == nil || cb.MaxRequests != 10 {
+		t.Errorf("Expected the circuit breaker of the oldest Ingress, got %+v", cb)
+	}
+
+	rt.DeleteRoutes("default/older")
+	if cb := rt.Upstreams()[0].CircuitBreaker(); cb == nil || cb.MaxRequests != 20 {
+		t.Errorf("Expected the circuit breaker of the remaining Ingress, got %+v", cb)
+	}
+}
+
+func TestRouteUpToDate(t *testing.T) {
+	rt := newTestRoutingTable(t)
+
+	complete := newTestIngress("default", "complete", time.Now(), "app.example.com",
+		testPath{"/", networkingv1.PathTypePrefix, "app"})
+	complete.ResourceVersion = "1"
+	routes := rt.RoutesFor(complete)
+	if len(routes) != 1 || !routes[0].UpToDate(complete) {
+		t.Errorf("expected the routes of a resolved ingress to be up to date")
+	}
+
+	changed := complete.DeepCopy()
+	changed.ResourceVersion = "2"
+	if routes[0].UpToDate(changed) {
+		t.Errorf("expected the routes of a previous version not to be up to date")
+	}
+
+	// The Service of the named port does not exist yet.
+	partial := newTestIngress("default", "partial", time.Now(), "app.example.com",
+		testPath{"/", networkingv1.PathTypePrefix, "app"},
+		testPath{"/api", networkingv1.PathTypePrefix, "api"})
+	partial.Spec.Rules[0].HTTP.Paths[1].Backend.Service.Port = networkingv1.ServiceBackendPort{Name: "http"}
+	routes = rt.RoutesFor(partial)
+	if len(routes) != 1 || routes[0].UpToDate(partial) {
+		t.Errorf("expected the routes of an ingress with an unresolved backend to be rebuilt, got %d routes", len(routes))
+	}
+
+	// The hosts of the certificate are not known until the Secret is loaded.
+	tlsIngress := complete.DeepCopy()
+	tlsIngress.Spec.TLS = []networkingv1.IngressTLS{{SecretName: "app-tls"}}
+	routes = rt.RoutesFor(tlsIngress)
+	if len(routes) != 1 || routes[0].UpToDate(tlsIngress) {
+		t.Errorf("expected the routes of an ingress with a missing TLS secret to be rebuilt")
+	}
+}
@@ -0,0 +1,154 @@
+package routing
+
+import (
+	"strings"
+
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+// routingSnapshot is an immutable view of the routing table. Updates build a
+// new snapshot and swap it in, so requests match without taking a lock.
+type routingSnapshot struct {
+	ingresses map[string][]*Route // Keyed by namespace/name of the Ingress
+	routes    map[string][]*Route // Keyed by host, sorted by precedence
+	trees     map[string]*routeTree
+	fallback  *Route // The --default-backend-service route, if any
+}
+
+// newRoutingSnapshot builds the snapshot of the routes of the Ingresses in
+// ingresses. The maps and slices of ingresses must not be modified
+// afterwards.
+func newRoutingSnapshot(ingresses map[string][]*Route, fallback *Route) *routingSnapshot {
+	s := &routingSnapshot{
+		ingresses: ingresses,
+		routes:    make(map[string][]*Route),
+		trees:     make(map[string]*routeTree),
+		fallback:  fallback,
+	}
+	for _, routes := range ingresses {
+		for _, route := range routes {
+			s.routes[route.Host] = append(s.routes[route.Host], route)
+		}
+	}
+	for host, routes := range s.routes {
+		sortRoutes(routes)
+		s.trees[host] = newRouteTree(routes)
+	}
+	return s
+}
+
+// len returns the number of routes of the snapshot, the fallback included.
+func (s *routingSnapshot) len() int {
+	n := 0
+	for _, routes := range s.routes {
+		n += len(routes)
+	}
+	if s.fallback != nil {
+		n++
+	}
+	return n
+}
+
+// match returns the route of host serving reqPath, or the fallback route.
+func (s *routingSnapshot) match(host, reqPath string) *Route {
+	if tree := lookupHost(s.trees, host); tree != nil {
+		if route := tree.match(reqPath); route != nil {
+			return route
+		}
+	}
+	return s.fallback
+}
+
+// routeTree finds the route of a host for a path in time proportional to the
+// length of the path rather than to the number of routes. Prefix paths are
+// stored in a tree of their "/"-separated segments, Exact paths by path.
+// Regular expressions cannot be indexed and are tried in order of precedence.
+type routeTree struct {
+	root         routeNode
+	exact        map[string]*Route
+	regex        []*Route
+	defaultRoute *Route
+}
+
+type routeNode struct {
+	children map[string]*routeNode
+	// route is the Prefix route of highest precedence ending at the node.
+	route *Route
+}
+
+// newRouteTree indexes routes, which must be sorted by precedence, keeping
+// the first of the routes competing for a path.
+func newRouteTree(routes []*Route) *routeTree {
+	t := &routeTree{exact: make(map[string]*Route)}
+	for _, route := range routes {
+		switch {
+		case route.Default:
+			if t.defaultRoute == nil {
+				t.defaultRoute = route
+			}
+		case route.Regex != nil:
+			t.regex = append(t.regex, route)
+		case route.PathType == string(networkingv1.PathTypeExact):
+			if _, ok := t.exact[route.Path]; !ok {
+				t.exact[route.Path] = route
+			}
+		default:
+			node := &t.root
+			if prefix := strings.TrimRight(route.Path, "/"); prefix != "" {
+				for segment := range strings.SplitSeq(prefix, "/") {
+					child, ok := node.children[segment]
+					if !ok {
+						if node.children == nil {
+							node.children = make(map[string]*routeNode)
+						}
+						child = &routeNode{}
+						node.children[segment] = child
+					}
+					node = child
+				}
+			}
+			if node.route == nil {
+				node.route = route
+			}
+		}
+	}
+	return t
+}
+
+// match returns the route of highest precedence matching reqPath, as
+// matchRoutes does over the sorted routes.
+func (t *routeTree) match(reqPath string) *Route {
+	best := t.exact[reqPath]
+	if route := t.matchPrefix(reqPath); route != nil && (best == nil || compareRoutes(route, best) < 0) {
+		best = route
+	}
+	for _, route := range t.regex {
+		if best != nil && compareRoutes(route, best) > 0 {
+			break
+		}
+		if route.Regex.MatchString(reqPath) {
+			best = route
+			break
+		}
+	}
+	if best == nil {
+		return t.defaultRoute
+	}
+	return best
+}
+
+// matchPrefix returns the route of the deepest node on the path of reqPath,
+// which is the longest matching prefix.
+func (t *routeTree) matchPrefix(reqPath string) *Route {
+	node := &t.root
+	route := node.route
+	for segment := range strings.SplitSeq(reqPath, "/") {
+		if node = node.children[segment]; node == nil {
+			break
+		}
+		if node.route != nil {
+			route = node.route
+		}
+	}
+	return route
+}
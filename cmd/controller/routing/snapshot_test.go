@@ -0,0 +1,185 @@
+package routing
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danCrespo/panacea-ingress-controller/config"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+// TestRouteTreeMatchesSortedRoutes checks the route tree against the linear
+// scan of sorted routes it replaces.
+func TestRouteTreeMatchesSortedRoutes(t *testing.T) {
+	now := time.Now()
+	newRoute := func(path string, pathType networkingv1.PathType, ingress string, age time.Duration) *Route {
+		return &Route{Path: path, PathType: string(pathType), Namespace: "default", Ingress: ingress, CreationTimestamp: now.Add(-age)}
+	}
+	regexRoute := func(path, ingress string, age time.Duration) *Route {
+		route := newRoute(path, networkingv1.PathTypeImplementationSpecific, ingress, age)
+		route.Regex = regexp.MustCompile("^(?:" + path + ")")
+		return route
+	}
+	defaultRoute := newRoute("/", networkingv1.PathTypePrefix, "default", 0)
+	defaultRoute.Default = true
+
+	routes := []*Route{
+		newRoute("/", networkingv1.PathTypePrefix, "a", time.Hour),
+		newRoute("/api", networkingv1.PathTypePrefix, "a", time.Hour),
+		newRoute("/api/", networkingv1.PathTypePrefix, "b", 2*time.Hour),
+		newRoute("/api", networkingv1.PathTypeExact, "c", 0),
+		newRoute("/api/", networkingv1.PathTypeExact, "c", 0),
+		newRoute("/api/v1", networkingv1.PathTypeImplementationSpecific, "d", time.Hour),
+		newRoute("/api/v1/users", networkingv1.PathTypePrefix, "d", time.Hour),
+		newRoute("/api/v1/users", networkingv1.PathTypeExact, "e", time.Hour),
+		newRoute("//double", networkingv1.PathTypePrefix, "f", time.Hour),
+		newRoute("relative", networkingv1.PathTypePrefix, "f", time.Hour),
+		regexRoute("/api/v[0-9]+/items", "g", time.Hour),
+		regexRoute("/api/v1/u", "g", time.Hour),
+		regexRoute("/a.*", "h", 0),
+		defaultRoute,
+	}
+
+	requests := []string{
+		"", "/", "/api", "/api/", "/apis", "/api/v1", "/api/v1/", "/api/v1/users", "/api/v1/users/1",
+		"/api/v1/usersx", "/api/v2/items", "/api/v22/items/1", "/api/v1/items", "/about", "//double/x",
+		"/double", "relative", "relative/x", "/relative",
+	}
+
+	for _, withDefault := range []bool{false, true} {
+		for n := range len(routes) - 1 {
+			// Drop one route at a time so every route gets to be the best match.
+			candidates := make([]*Route, 0, len(routes))
+			for i, route := range routes {
+				if i != n && (withDefault || !route.Default) {
+					candidates = append(candidates, route)
+				}
+			}
+			sortRoutes(candidates)
+			tree := newRouteTree(candidates)
+
+			for _, req := range requests {
+				expected := matchRoutes(candidates, req)
+				if got := tree.match(req); got != expected {
+					t.Errorf("without route %d, default %t: match(%q) = %v, expected %v", n, withDefault, req, got, expected)
+				}
+			}
+		}
+	}
+}
+
+func TestRoutingTableMatchDuringUpdates(t *testing.T) {
+	rt := newTestRoutingTable(t)
+	ingresses := []*networkingv1.Ingress{
+		newTestIngress("default", "app", time.Now(), "app.example.com", testPath{"/", networkingv1.PathTypePrefix, "app"}),
+	}
+	rt.UpdateFromIngresses(ingresses, testClasses(t))
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for range 4 {
+		wg.Go(func() {
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if route := rt.Match("app.example.com", "/users"); route == nil || route.Upstream.Service != "app" {
+					t.Errorf("Expected every lookup to see a complete table, got %v", route)
+					return
+				}
+			}
+		})
+	}
+
+	for range 20 {
+		rt.UpdateFromIngresses(ingresses, testClasses(t))
+		rt.SetRoutes("other.example.com", nil)
+		rt.DeleteRoutes("other.example.com")
+	}
+	close(stop)
+	wg.Wait()
+}
+
+// benchmarkIngresses returns hosts Ingresses with paths paths each, for
+// a total of hosts*paths routes.
+func benchmarkIngresses(hosts, paths int) []*networkingv1.Ingress {
+	now := time.Now()
+	ingresses := make([]*networkingv1.Ingress, 0, hosts)
+	for h := range hosts {
+		ingressPaths := make([]testPath, 0, paths)
+		for p := range paths {
+			pathType := networkingv1.PathTypePrefix
+			if p%3 == 0 {
+				pathType = networkingv1.PathTypeExact
+			}
+			ingressPaths = append(ingressPaths, testPath{fmt.Sprintf("/team-%d/service-%d", p%10, p), pathType, fmt.Sprintf("svc-%d", h%10)})
+		}
+		ingresses = append(ingresses, newTestIngress("default", fmt.Sprintf("ingress-%d", h), now, fmt.Sprintf("host-%d.example.com", h), ingressPaths...))
+	}
+	return ingresses
+}
+
+// BenchmarkMatch compares the lookups of the route tree with copying the
+// table and scanning the sorted routes of the host, for 3,000 paths. The
+// lookups leave out the logging of Match.
+func BenchmarkMatch(b *testing.B) {
+	rt := newRoutingTableWith(config.Config{IngressClass: "panacea"}, fakeKubeutils{})
+	b.Cleanup(rt.Clear)
+	rt.UpdateFromIngresses(benchmarkIngresses(100, 30), testClasses(b))
+
+	const host, reqPath = "host-42.example.com", "/team-9/service-29/orders/1"
+
+	b.Run("tree", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if rt.snapshot.Load().match(host, reqPath) == nil {
+				b.Fatal("no route matched")
+			}
+		}
+	})
+
+	b.Run("linear", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			routes := lookupHost(maps.Clone(rt.snapshot.Load().routes), host)
+			if matchRoutes(routes, reqPath) == nil {
+				b.Fatal("no route matched")
+			}
+		}
+	})
+}
+
+// BenchmarkMatchSingleHost matches on one host holding all 3,000 paths, the
+// worst case of the linear scan.
+func BenchmarkMatchSingleHost(b *testing.B) {
+	rt := newRoutingTableWith(config.Config{IngressClass: "panacea"}, fakeKubeutils{})
+	b.Cleanup(rt.Clear)
+	rt.UpdateFromIngresses(benchmarkIngresses(1, 3000), testClasses(b))
+
+	const host, reqPath = "host-0.example.com", "/team-1/service-1/orders/1"
+	snapshot := rt.snapshot.Load()
+
+	b.Run("tree", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if snapshot.match(host, reqPath) == nil {
+				b.Fatal("no route matched")
+			}
+		}
+	})
+
+	b.Run("linear", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if matchRoutes(snapshot.routes[host], reqPath) == nil {
+				b.Fatal("no route matched")
+			}
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// errUpstreamTimeout is returned when an attempt gets no response headers in
+// time, either within the response header timeout of its route or within the
+// per-try timeout of its retry policy.
+var errUpstreamTimeout = errors.New("upstream timeout")
+
+// Timeouts bounds the requests of a route to its upstream.
+type Timeouts struct {
+	// Connect bounds the connection to an endpoint.
+	Connect time.Duration
+	// ResponseHeader bounds the wait for response headers of each attempt.
+	ResponseHeader time.Duration
+	// Request bounds the whole request, retries and response body included.
+	Request time.Duration
+}
+
+const defaultConnectTimeout = 30 * time.Second
+
+type connectTimeoutKey struct{}
+
+// withConnectTimeout makes the dials made for requests carrying ctx give up
+// after d. Upstream transports are shared by routes with different timeouts,
+// so the timeout travels with the request.
+func withConnectTimeout(ctx context.Context, d time.Duration) context.Context {
+	if d <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, connectTimeoutKey{}, d)
+}
+
+// dialContext dials with the connect timeout of the request, if any.
+func dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: defaultConnectTimeout, KeepAlive: 30 * time.Second}
+	if d, ok := ctx.Value(connectTimeoutKey{}).(time.Duration); ok {
+		dialer.Timeout = d
+	}
+	return dialer.DialContext(ctx, network, address)
+}
+
+// isTimeout reports whether err is an upstream timeout the client should see
+// as a 504.
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, errUpstreamTimeout) ||
+		errors.Is(err, context.DeadlineExceeded) ||
+		(errors.As(err, &netErr) && netErr.Timeout())
+}
@@ -0,0 +1,118 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+func TestWithConnectTimeout(t *testing.T) {
+	ctx := withConnectTimeout(context.Background(), time.Second)
+	if d, ok := ctx.Value(connectTimeoutKey{}).(time.Duration); !ok || d != time.Second {
+		t.Errorf("expected a connect timeout of 1s, got %v", d)
+	}
+
+	if ctx := withConnectTimeout(context.Background(), 0); ctx.Value(connectTimeoutKey{}) != nil {
+		t.Errorf("expected no connect timeout")
+	}
+}
+
+func TestIsTimeout(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{fmt.Errorf("web: %w", errUpstreamTimeout), true},
+		{context.DeadlineExceeded, true},
+		{context.Canceled, false},
+		{errNoEndpoints, false},
+	}
+
+	for _, tt := range tests {
+		if got := isTimeout(tt.err); got != tt.expected {
+			t.Errorf("isTimeout(%v): expected %v, got %v", tt.err, tt.expected, got)
+		}
+	}
+}
+
+func TestRouteTransportTimeouts(t *testing.T) {
+	unblock := make(chan struct{})
+	defer close(unblock)
+
+	slowHeaders := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-unblock:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slowHeaders.Close()
+
+	slowBody := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		select {
+		case <-unblock:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slowBody.Close()
+
+	newTransport := func(url string, timeouts Timeouts) *routeTransport {
+		upstream := newUpstream("default", "web", networkingv1.ServiceBackendPort{Number: 80}, false)
+		upstream.SetEndpoints([]*Endpoint{testEndpoint(t, url)})
+		return &routeTransport{upstream: upstream, balancer: &roundRobin{}, timeouts: timeouts}
+	}
+
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "http://web.default.svc.cluster.local/", nil)
+		req.RequestURI = ""
+		req.Body = nil
+		return req
+	}
+
+	t.Run("response header timeout", func(t *testing.T) {
+		transport := newTransport(slowHeaders.URL, Timeouts{ResponseHeader: 20 * time.Millisecond})
+		_, err := transport.RoundTrip(newRequest())
+		if !errors.Is(err, errUpstreamTimeout) {
+			t.Fatalf("expected %v, got %v", errUpstreamTimeout, err)
+		}
+
+		rec := httptest.NewRecorder()
+		proxyErrorHandler(rec, newRequest(), err)
+		if rec.Code != http.StatusGatewayTimeout {
+			t.Errorf("expected %d, got %d", http.StatusGatewayTimeout, rec.Code)
+		}
+	})
+
+	t.Run("response header timeout leaves the body alone", func(t *testing.T) {
+		transport := newTransport(slowBody.URL, Timeouts{ResponseHeader: 20 * time.Millisecond, Request: 100 * time.Millisecond})
+		resp, err := transport.RoundTrip(newRequest())
+		if err != nil {
+			t.Fatalf("RoundTrip() returned an error: %v", err)
+		}
+		defer resp.Body.Close()
+
+		start := time.Now()
+		_, err = resp.Body.Read(make([]byte, 1))
+		if err == nil {
+			t.Fatalf("expected the request timeout to interrupt the body")
+		}
+		if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+			t.Errorf("expected the body to outlive the response header timeout, interrupted after %v", elapsed)
+		}
+	})
+
+	t.Run("request timeout", func(t *testing.T) {
+		transport := newTransport(slowHeaders.URL, Timeouts{Request: 20 * time.Millisecond})
+		_, err := transport.RoundTrip(newRequest())
+		if !isTimeout(err) {
+			t.Fatalf("expected a timeout, got %v", err)
+		}
+	})
+}
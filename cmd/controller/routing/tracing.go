@@ -0,0 +1,58 @@
+package routing
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/danCrespo/panacea-ingress-controller/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// startAttempt starts the span of an attempt of req to ep and returns a copy
+// of req carrying it, with its trace context set to the headers sent
+// upstream. The headers of req are left as they are.
+func (t *routeTransport) startAttempt(req *http.Request, ep *Endpoint, attempt int) (*http.Request, trace.Span) {
+	ctx, span := tracing.Tracer().Start(req.Context(), req.Method, trace.WithSpanKind(trace.SpanKindClient))
+	req = req.Clone(ctx)
+	tracing.Inject(ctx, req.Header)
+
+	if span.IsRecording() {
+		host, port, _ := net.SplitHostPort(ep.Host())
+		portNumber, _ := strconv.Atoi(port)
+		// The query is left out, it may hold credentials.
+		span.SetAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.URLFull(t.upstream.scheme()+"://"+ep.Host()+req.URL.Path),
+			semconv.ServerAddress(host),
+			semconv.ServerPort(portNumber),
+			semconv.K8SNamespaceName(t.upstream.Namespace),
+			attribute.String("k8s.service.name", t.upstream.Service),
+		)
+		if attempt > 1 {
+			span.SetAttributes(semconv.HTTPRequestResendCount(attempt - 1))
+		}
+	}
+	return req, span
+}
+
+// endAttempt ends the span of an attempt once the response headers arrived
+// or the attempt failed. Client and server errors fail the span.
+func endAttempt(span trace.Span, resp *http.Response, err error) {
+	defer span.End()
+
+	switch {
+	case err != nil:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.SetAttributes(semconv.ErrorTypeKey.String(upstreamErrorReason(err)))
+	case resp != nil:
+		span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+		if resp.StatusCode >= http.StatusBadRequest {
+			span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package routing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+func TestRouteTransportSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	}()
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	var traceparent string
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("Traceparent")
+	}))
+	defer working.Close()
+
+	on, _ := parseRetryOn("503")
+	upstream := newUpstream("default", "web", networkingv1.ServiceBackendPort{Number: 80}, false)
+	upstream.SetEndpoints([]*Endpoint{testEndpoint(t, failing.URL), testEndpoint(t, working.URL)})
+	transport := &routeTransport{upstream: upstream, balancer: &roundRobin{}, retry: &RetryPolicy{Attempts: 2, On: on}, budget: newRetryBudget(20, 3)}
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "GET /", trace.WithSpanKind(trace.SpanKindServer))
+	req := httptest.NewRequest(http.MethodGet, "http://web.default.svc.cluster.local/", nil).WithContext(ctx)
+	req.RequestURI = ""
+	req.Body = nil
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip() returned an error: %v", err)
+	}
+	resp.Body.Close()
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("expected a span per attempt and the parent, got %d spans", len(spans))
+	}
+	first, second := spans[0], spans[1]
+	for _, span := range []sdktrace.ReadOnlySpan{first, second} {
+		if span.SpanKind() != trace.SpanKindClient || span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("expected client spans children of the server span, got %s child of %s", span.SpanKind(), span.Parent().SpanID())
+		}
+	}
+	if first.Status().Code != codes.Error {
+		t.Errorf("expected the 503 attempt to fail its span")
+	}
+	if second.Status().Code == codes.Error || !hasAttribute(second, semconv.HTTPRequestResendCount(1)) {
+		t.Errorf("expected the retry to succeed with a resend count of 1, got %v", second.Attributes())
+	}
+
+	// The upstream continues the trace from the span of its attempt.
+	expected := "00-" + second.SpanContext().TraceID().String() + "-" + second.SpanContext().SpanID().String() + "-01"
+	if traceparent != expected {
+		t.Errorf("expected the upstream to receive traceparent %s, got %s", expected, traceparent)
+	}
+	if got := req.Header.Get("Traceparent"); got != "" {
+		t.Errorf("expected the request of the caller to be left as it is, got traceparent %s", got)
+	}
+}
+
+func hasAttribute(span sdktrace.ReadOnlySpan, expected attribute.KeyValue) bool {
+	for _, attr := range span.Attributes() {
+		if attr == expected {
+			return true
+		}
+	}
+	return false
+}
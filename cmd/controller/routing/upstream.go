@@ -0,0 +1,424 @@
+package routing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/danCrespo/panacea-ingress-controller/accesslog"
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+// errNoEndpoints is returned by Upstream.RoundTrip when the Service has no
+// ready endpoint to send the request to.
+var errNoEndpoints = errors.New("no ready endpoints")
+
+// Upstream is the set of endpoints a Service backend port resolves to. An
+// Upstream is shared by every route that targets the same Service port and
+// outlives routing table rebuilds, so its connection pool and endpoint state
+// are kept across Ingress changes.
+type Upstream struct {
+	Namespace string
+	Service   string
+	Port      networkingv1.ServiceBackendPort
+	// ServiceMode upstreams proxy to the Service DNS name and leave load
+	// balancing to kube-proxy.
+	ServiceMode bool
+
+	endpoints atomic.Pointer[[]*Endpoint]
+	transport atomic.Pointer[http.Transport]
+
+	backendMu sync.Mutex // Serializes backend changes
+	backend   atomic.Pointer[Backend]
+	certs     *CertificateStore
+
+	availableMu sync.Mutex
+	available   atomic.Pointer[[]*Endpoint]
+
+	checkerMu sync.Mutex
+	checker   *healthChecker
+
+	outlierMu        sync.Mutex
+	outlierDetection atomic.Pointer[OutlierDetection]
+	breaker          atomic.Pointer[circuitBreaker]
+}
+
+func upstreamKey(namespace, service string, port networkingv1.ServiceBackendPort, serviceMode bool) string {
+	key := fmt.Sprintf("%s/%s:%s", namespace, service, backendPortString(port))
+	if serviceMode {
+		key += "#service"
+	}
+	return key
+}
+
+func newUpstream(namespace, service string, port networkingv1.ServiceBackendPort, serviceMode bool) *Upstream {
+	u := &Upstream{
+		Namespace:   namespace,
+		Service:     service,
+		Port:        port,
+		ServiceMode: serviceMode,
+	}
+	u.backend.Store(&Backend{Protocol: ProtocolHTTP})
+	u.transport.Store(u.Backend().transport(nil))
+	u.endpoints.Store(&[]*Endpoint{})
+	u.available.Store(&[]*Endpoint{})
+	return u
+}
+
+// Key identifies the Upstream in the routing table.
+func (u *Upstream) Key() string {
+	return upstreamKey(u.Namespace, u.Service, u.Port, u.ServiceMode)
+}
+
+// Endpoints returns the current endpoint set. The slice must not be modified.
+func (u *Upstream) Endpoints() []*Endpoint {
+	return *u.endpoints.Load()
+}
+
+// SetEndpoints replaces the endpoint set. Endpoints already known by host
+// are kept as they are so their state is preserved.
+func (u *Upstream) SetEndpoints(endpoints []*Endpoint) {
+	current := make(map[string]*Endpoint)
+	for _, ep := range u.Endpoints() {
+		current[ep.Host()] = ep
+	}
+
+	next := make([]*Endpoint, 0, len(endpoints))
+	for _, ep := range endpoints {
+		if existing, ok := current[ep.Host()]; ok {
+			next = append(next, existing)
+			continue
+		}
+		next = append(next, ep)
+	}
+
+	u.endpoints.Store(&next)
+	u.refreshAvailable()
+}
+
+// Available returns the endpoints requests can be sent to: the healthy ones
+// that are not ejected, or all of them when there is none, so a broken health
+// check cannot take the whole backend down. The slice must not be modified.
+func (u *Upstream) Available() []*Endpoint {
+	return *u.available.Load()
+}
+
+func (u *Upstream) refreshAvailable() {
+	u.availableMu.Lock()
+	defer u.availableMu.Unlock()
+
+	endpoints := u.Endpoints()
+	available := make([]*Endpoint, 0, len(endpoints))
+	now := time.Now()
+	for _, ep := range endpoints {
+		if ep.Healthy() && !ep.ejected(now) {
+			available = append(available, ep)
+		}
+	}
+
+	if len(available) == 0 && len(endpoints) > 0 {
+		l.Info("No healthy endpoints, sending traffic to all of them", "upstream", u.Key())
+		available = endpoints
+	}
+	u.available.Store(&available)
+}
+
+// HealthCheck returns the active health check of the upstream, or nil.
+func (u *Upstream) HealthCheck() *HealthCheck {
+	u.checkerMu.Lock()
+	defer u.checkerMu.Unlock()
+
+	if u.checker == nil {
+		return nil
+	}
+	config := u.checker.config
+	return &config
+}
+
+// SetHealthCheck starts, restarts or, when config is nil, stops the active
+// health checking of the upstream endpoints.
+func (u *Upstream) SetHealthCheck(config *HealthCheck) {
+	u.checkerMu.Lock()
+	defer u.checkerMu.Unlock()
+
+	if u.checker != nil {
+		if config != nil && *config == u.checker.config {
+			return
+		}
+		u.checker.close()
+		u.checker = nil
+	}
+
+	if config == nil {
+		for _, ep := range u.Endpoints() {
+			ep.resetHealth()
+		}
+		u.refreshAvailable()
+		return
+	}
+
+	u.checker = newHealthChecker(u, *config)
+	go u.checker.run()
+}
+
+// Close stops the background work of the upstream and closes its idle
+// connections.
+func (u *Upstream) Close() {
+	u.checkerMu.Lock()
+	defer u.checkerMu.Unlock()
+
+	if u.checker != nil {
+		u.checker.close()
+		u.checker = nil
+	}
+	if transport := u.transport.Load(); transport != nil {
+		transport.CloseIdleConnections()
+	}
+}
+
+// scheme is the URL scheme used to reach the endpoints.
+func (u *Upstream) scheme() string {
+	return u.Backend().scheme()
+}
+
+// send forwards req to ep, tracking the requests in flight and the latency
+// of the endpoint for the balancers, and its errors for outlier detection.
+func (u *Upstream) send(req *http.Request, ep *Endpoint) (*http.Response, error) {
+	out := *req
+	target := *req.URL
+	target.Scheme = u.scheme()
+	target.Host = ep.Host()
+	out.URL = &target
+
+	ep.active.Add(1)
+	start := time.Now()
+	resp, err := u.transport.Load().RoundTrip(&out)
+	if err != nil {
+		ep.active.Add(-1)
+		// Requests cancelled by the client say nothing about the endpoint,
+		// unlike attempts that timed out waiting for it.
+		ctx := req.Context()
+		if ctx.Err() == nil || errors.Is(context.Cause(ctx), errUpstreamTimeout) {
+			u.observe(ep, true)
+		}
+		return nil, err
+	}
+
+	ep.observeLatency(time.Since(start))
+	u.observe(ep, resp.StatusCode >= http.StatusInternalServerError)
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: func() { ep.active.Add(-1) }}
+	return resp, nil
+}
+
+// releaseBody calls release once the response has been fully handed to the
+// client, to free what the request held.
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+	done    atomic.Bool
+}
+
+func (b *releaseBody) Close() error {
+	if b.done.CompareAndSwap(false, true) {
+		b.release()
+	}
+	return b.ReadCloser.Close()
+}
+
+// routeTransport sends the requests of a route to the endpoint picked by the
+// route's balancer, or to the endpoint pinned by its affinity cookie, within
+// the limits of the upstream circuit breaker and the route timeouts. Failed
+// attempts are retried on another endpoint as the retry policy and budget
+// allow.
+type routeTransport struct {
+	route    *Route // Labels the metrics of the attempts
+	upstream *Upstream
+	balancer Balancer
+	affinity *cookieAffinity
+	retry    *RetryPolicy
+	budget   *retryBudget
+	timeouts Timeouts
+}
+
+var _ http.RoundTripper = (*routeTransport)(nil)
+
+func (t *routeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := withConnectTimeout(req.Context(), t.timeouts.Connect), context.CancelFunc(func() {})
+	if t.timeouts.Request > 0 {
+		ctx, cancel = context.WithTimeout(ctx, t.timeouts.Request)
+	}
+	req = req.WithContext(ctx)
+
+	release, err := t.upstream.acquire(ctx)
+	if err != nil {
+		cancel()
+		err = fmt.Errorf("%s: %w", t.upstream.Key(), err)
+		t.recordError(req, err)
+		return nil, err
+	}
+
+	resp, ep, pinned, err := t.roundTrip(req)
+	if err != nil {
+		release()
+		cancel()
+		return nil, err
+	}
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: func() {
+		release()
+		cancel()
+	}}
+
+	if t.affinity != nil && !pinned {
+		resp.Header.Add("Set-Cookie", t.affinity.cookie(t.upstream.Key(), ep, req.TLS != nil).String())
+	}
+	return resp, nil
+}
+
+// roundTrip sends req until an attempt succeeds, is not retryable or the
+// attempts run out. It returns the endpoint of the last attempt, and whether
+// it was pinned by the affinity cookie.
+func (t *routeTransport) roundTrip(req *http.Request) (*http.Response, *Endpoint, bool, error) {
+	attempts := t.retry.attemptsFor(req)
+	if attempts > 1 {
+		t.budget.begin()
+		defer t.budget.end()
+	}
+
+	var tried []*Endpoint
+	for attempt := 1; ; attempt++ {
+		ep, pinned := t.pick(req, tried)
+		if ep == nil {
+			err := fmt.Errorf("%s: %w", t.upstream.Key(), errNoEndpoints)
+			t.recordError(req, err)
+			return nil, nil, false, err
+		}
+		tried = append(tried, ep)
+
+		out := req
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, nil, false, err
+			}
+			out = req.Clone(req.Context())
+			out.Body = body
+		}
+
+		start := time.Now()
+		out, span := t.startAttempt(out, ep, attempt)
+		resp, err := t.try(out, ep)
+		endAttempt(span, resp, err)
+		accesslog.ObserveUpstream(req.Context(), ep.Host(), responseStatus(resp), time.Since(start))
+		if err != nil {
+			t.recordError(req, err)
+		}
+		if attempt > 1 {
+			t.budget.done()
+		}
+
+		if attempt >= attempts || req.Context().Err() != nil || !t.retry.retryable(resp, err) {
+			return resp, ep, pinned, err
+		}
+		if !t.budget.allow() {
+			l.Info("Retry budget exhausted", "upstream", t.upstream.Key(), "endpoint", ep.Host())
+			return resp, ep, pinned, err
+		}
+
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		l.Info("Retrying request", "upstream", t.upstream.Key(), "endpoint", ep.Host(), "attempt", attempt, "error", err)
+	}
+}
+
+// pick returns the endpoint of the next attempt, preferring endpoints that
+// have not been tried yet, and whether the affinity cookie pinned it.
+func (t *routeTransport) pick(req *http.Request, tried []*Endpoint) (*Endpoint, bool) {
+	endpoints := t.upstream.Available()
+
+	if len(tried) == 0 && t.affinity != nil {
+		if ep := t.affinity.endpoint(req, t.upstream.Key(), endpoints); ep != nil {
+			return ep, true
+		}
+	}
+
+	if len(tried) > 0 {
+		untried := slices.DeleteFunc(slices.Clone(endpoints), func(ep *Endpoint) bool {
+			return slices.Contains(tried, ep)
+		})
+		if len(untried) > 0 {
+			endpoints = untried
+		}
+	}
+	return t.balancer.Pick(req, endpoints), false
+}
+
+// headerTimeout returns how long an attempt may wait for response headers:
+// the shorter of the response header timeout and the per-try timeout.
+func (t *routeTransport) headerTimeout() time.Duration {
+	d := t.timeouts.ResponseHeader
+	if t.retry != nil && t.retry.PerTryTimeout > 0 && (d <= 0 || t.retry.PerTryTimeout < d) {
+		d = t.retry.PerTryTimeout
+	}
+	return d
+}
+
+// try sends a single attempt to ep, bounded by the header timeout until the
+// response headers arrive.
+func (t *routeTransport) try(req *http.Request, ep *Endpoint) (*http.Response, error) {
+	d := t.headerTimeout()
+	if d <= 0 {
+		return t.upstream.send(req, ep)
+	}
+
+	// The timeout is the cause of the cancellation, so that send tells the
+	// attempt apart from a request cancelled by the client.
+	ctx, cancel := context.WithCancelCause(req.Context())
+	timer := time.AfterFunc(d, func() { cancel(errUpstreamTimeout) })
+
+	resp, err := t.upstream.send(req.WithContext(ctx), ep)
+	timedOut := !timer.Stop()
+	if err != nil {
+		cancel(nil)
+		if timedOut && req.Context().Err() == nil {
+			return nil, fmt.Errorf("%s: %w", ep.Host(), errUpstreamTimeout)
+		}
+		return nil, err
+	}
+
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: func() { cancel(nil) }}
+	return resp, nil
+}
+
+// responseStatus returns the status of resp, 0 without a response.
+func responseStatus(resp *http.Response) int {
+	if resp == nil {
+		return 0
+	}
+	return resp.StatusCode
+}
+
+// proxyErrorHandler answers requests the upstream could not serve.
+func proxyErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusBadGateway
+	switch {
+	case errors.Is(err, errNoEndpoints), errors.Is(err, errCircuitOpen):
+		status = http.StatusServiceUnavailable
+	case isTimeout(err):
+		status = http.StatusGatewayTimeout
+	}
+
+	l.Info("Proxy error", "host", r.Host, "path", r.URL.Path, "status", status, "error", err)
+	w.WriteHeader(status)
+}
+
+func (u *Upstream) String() string {
+	return fmt.Sprintf("%s %v (%d available)", u.Key(), u.Endpoints(), len(u.Available()))
+}
@@ -0,0 +1,83 @@
+package routing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	networkingv1 "k8s.io/api/networking/v1"
+)
+
+func testEndpoint(t *testing.T, rawURL string) *Endpoint {
+	t.Helper()
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatalf("error parsing %s: %v", rawURL, err)
+	}
+	port, _ := strconv.Atoi(u.Port())
+	return &Endpoint{Address: u.Hostname(), Port: int32(port)}
+}
+
+func TestUpstreamSetEndpointsKeepsExisting(t *testing.T) {
+	upstream := newUpstream("default", "web", networkingv1.ServiceBackendPort{Number: 80}, false)
+
+	first := &Endpoint{Address: "10.0.0.1", Port: 8080}
+	upstream.SetEndpoints([]*Endpoint{first})
+	upstream.SetEndpoints([]*Endpoint{{Address: "10.0.0.1", Port: 8080}, {Address: "10.0.0.2", Port: 8080}})
+
+	endpoints := upstream.Endpoints()
+	if len(endpoints) != 2 {
+		t.Fatalf("expected 2 endpoints, got %d", len(endpoints))
+	}
+	if endpoints[0] != first {
+		t.Errorf("expected existing endpoint to be reused")
+	}
+}
+
+func TestRouteTransportRoundTrip(t *testing.T) {
+	hits := make(map[string]int)
+	handler := func(name string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits[name]++
+		})
+	}
+
+	a := httptest.NewServer(handler("a"))
+	defer a.Close()
+	b := httptest.NewServer(handler("b"))
+	defer b.Close()
+
+	upstream := newUpstream("default", "web", networkingv1.ServiceBackendPort{Number: 80}, false)
+	transport := &routeTransport{upstream: upstream, balancer: &roundRobin{}}
+
+	req := httptest.NewRequest(http.MethodGet, "http://web.default.svc.cluster.local/", nil)
+	req.RequestURI = ""
+	if _, err := transport.RoundTrip(req); err == nil {
+		t.Fatalf("expected an error without endpoints")
+	}
+
+	upstream.SetEndpoints([]*Endpoint{testEndpoint(t, a.URL), testEndpoint(t, b.URL)})
+	for range 4 {
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("RoundTrip() returned an error: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	for _, ep := range upstream.Endpoints() {
+		if ep.Active() != 0 {
+			t.Errorf("expected no requests in flight to %s, got %d", ep, ep.Active())
+		}
+	}
+
+	if hits["a"] != 2 || hits["b"] != 2 {
+		t.Errorf("expected requests to be spread evenly, got %v", hits)
+	}
+	if req.URL.Host != "web.default.svc.cluster.local" {
+		t.Errorf("expected the original request to be left untouched, got host %s", req.URL.Host)
+	}
+}
@@ -0,0 +1,155 @@
+// Package tracing sets up the OpenTelemetry tracing of the proxied requests:
+// the exporter the spans are sent to, their sampling, and the formats the
+// trace context is propagated in.
+//
+// The tracer provider and the propagator are installed globally. Until Start
+// is called they are no-ops, and the trace headers of the requests reach the
+// upstreams as the clients sent them.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/danCrespo/panacea-ingress-controller"
+
+// Config configures the tracing of the proxied requests.
+type Config struct {
+	// Exporter is otlp-grpc or otlp-http.
+	Exporter string
+	// Endpoint is the host:port or the URL of the collector. The exporter
+	// default is used when empty.
+	Endpoint string
+	// Insecure sends the spans without TLS.
+	Insecure bool
+	// SamplePercent is the percentage of the traces started by the
+	// controller that are sampled. Requests part of a trace follow the
+	// sampling decision of their parent.
+	SamplePercent int
+	// Propagators are the formats of the trace context: tracecontext,
+	// baggage, b3 and b3multi.
+	Propagators []string
+	ServiceName string
+}
+
+// Start installs the tracer provider and the propagator of cfg, and returns
+// the function flushing the pending spans and stopping the exporter.
+func Start(ctx context.Context, cfg Config, log logr.Logger) (func(context.Context) error, error) {
+	propagator, err := NewPropagator(cfg.Propagators)
+	if err != nil {
+		return nil, err
+	}
+
+	exporter, err := newExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithAttributes(semconv.ServiceName(cfg.ServiceName)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating tracing resource: %v", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(float64(cfg.SamplePercent)/100))),
+	)
+
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		log.Error(err, "error exporting traces")
+	}))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+	return provider.Shutdown, nil
+}
+
+func newExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, error) {
+	url := strings.Contains(cfg.Endpoint, "://")
+
+	switch cfg.Exporter {
+	case "otlp-grpc":
+		var opts []otlptracegrpc.Option
+		switch {
+		case url:
+			opts = append(opts, otlptracegrpc.WithEndpointURL(cfg.Endpoint))
+		case cfg.Endpoint != "":
+			opts = append(opts, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	case "otlp-http":
+		var opts []otlptracehttp.Option
+		switch {
+		case url:
+			opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+		case cfg.Endpoint != "":
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q, expected otlp-grpc or otlp-http", cfg.Exporter)
+	}
+}
+
+// NewPropagator returns the propagator of the formats named tracecontext
+// (W3C Trace Context), baggage (W3C Baggage), b3 (B3 single header) and
+// b3multi (B3 multiple headers). B3 is extracted from both encodings.
+func NewPropagator(names []string) (propagation.TextMapPropagator, error) {
+	var propagators []propagation.TextMapPropagator
+	for _, name := range names {
+		switch strings.TrimSpace(name) {
+		case "tracecontext":
+			propagators = append(propagators, propagation.TraceContext{})
+		case "baggage":
+			propagators = append(propagators, propagation.Baggage{})
+		case "b3":
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3SingleHeader)))
+		case "b3multi":
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)))
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown propagator %q, expected tracecontext, baggage, b3 or b3multi", name)
+		}
+	}
+	return propagation.NewCompositeTextMapPropagator(propagators...), nil
+}
+
+// Tracer returns the tracer of the controller.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Extract returns a copy of ctx carrying the trace context of header.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// Inject sets the trace context of ctx to header.
+func Inject(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
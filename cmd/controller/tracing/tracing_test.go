@@ -0,0 +1,245 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// collector is a stand-in for an OpenTelemetry collector, keeping the spans
+// it receives over OTLP.
+type collector struct {
+	collectortrace.UnimplementedTraceServiceServer
+
+	mu       sync.Mutex
+	spans    []*tracepb.Span
+	services []string
+}
+
+func (c *collector) Export(_ context.Context, req *collectortrace.ExportTraceServiceRequest) (*collectortrace.ExportTraceServiceResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, rs := range req.ResourceSpans {
+		for _, attr := range rs.GetResource().GetAttributes() {
+			if attr.Key == "service.name" {
+				c.services = append(c.services, attr.GetValue().GetStringValue())
+			}
+		}
+		for _, ss := range rs.ScopeSpans {
+			c.spans = append(c.spans, ss.Spans...)
+		}
+	}
+	return &collectortrace.ExportTraceServiceResponse{}, nil
+}
+
+// ServeHTTP receives the spans of the OTLP/HTTP exporter.
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil || r.URL.Path != "/v1/traces" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	req := &collectortrace.ExportTraceServiceRequest{}
+	if err := proto.Unmarshal(body, req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	resp, _ := c.Export(r.Context(), req)
+	out, _ := proto.Marshal(resp)
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	_, _ = w.Write(out)
+}
+
+func (c *collector) received() ([]*tracepb.Span, []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.spans, c.services
+}
+
+// startGRPCCollector serves c over OTLP/gRPC until the test ends and returns
+// its address.
+func startGRPCCollector(t *testing.T, c *collector) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	srv := grpc.NewServer()
+	collectortrace.RegisterTraceServiceServer(srv, c)
+	go func() { _ = srv.Serve(listener) }()
+	t.Cleanup(srv.Stop)
+	return listener.Addr().String()
+}
+
+// resetGlobals restores the no-op tracer provider and propagator when the
+// test ends.
+func resetGlobals(t *testing.T) {
+	t.Cleanup(func() {
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	})
+}
+
+func TestStart(t *testing.T) {
+	tests := []struct {
+		name     string
+		exporter string
+		endpoint func(t *testing.T, c *collector) string
+	}{
+		{name: "otlp-grpc", exporter: "otlp-grpc", endpoint: startGRPCCollector},
+		{name: "otlp-http", exporter: "otlp-http", endpoint: func(t *testing.T, c *collector) string {
+			srv := httptest.NewServer(c)
+			t.Cleanup(srv.Close)
+			return srv.Listener.Addr().String()
+		}},
+		{name: "otlp-http with a URL", exporter: "otlp-http", endpoint: func(t *testing.T, c *collector) string {
+			srv := httptest.NewServer(c)
+			t.Cleanup(srv.Close)
+			return srv.URL + "/v1/traces"
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetGlobals(t)
+			c := &collector{}
+			stop, err := Start(context.Background(), Config{
+				Exporter:      tt.exporter,
+				Endpoint:      tt.endpoint(t, c),
+				Insecure:      true,
+				SamplePercent: 100,
+				Propagators:   []string{"tracecontext"},
+				ServiceName:   "panacea-test",
+			}, logr.Discard())
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			_, span := Tracer().Start(context.Background(), "GET /api", trace.WithSpanKind(trace.SpanKindServer))
+			span.End()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := stop(ctx); err != nil {
+				t.Fatalf("Unexpected error flushing the spans: %v", err)
+			}
+
+			spans, services := c.received()
+			if len(spans) != 1 || spans[0].Name != "GET /api" || spans[0].Kind != tracepb.Span_SPAN_KIND_SERVER {
+				t.Fatalf("Expected the server span to reach the collector, got %v", spans)
+			}
+			if len(services) != 1 || services[0] != "panacea-test" {
+				t.Errorf("Expected the service name panacea-test, got %v", services)
+			}
+		})
+	}
+
+	t.Run("sampling", func(t *testing.T) {
+		resetGlobals(t)
+		c := &collector{}
+		stop, err := Start(context.Background(), Config{
+			Exporter:      "otlp-grpc",
+			Endpoint:      startGRPCCollector(t, c),
+			Insecure:      true,
+			SamplePercent: 0,
+			Propagators:   []string{"tracecontext"},
+		}, logr.Discard())
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		_, root := Tracer().Start(context.Background(), "unsampled")
+		root.End()
+
+		// A sampled caller decides for the spans of the controller.
+		header := http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}
+		_, child := Tracer().Start(Extract(context.Background(), header), "sampled")
+		child.End()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := stop(ctx); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		spans, _ := c.received()
+		if len(spans) != 1 || spans[0].Name != "sampled" {
+			t.Errorf("Expected only the span of the sampled caller, got %v", spans)
+		}
+	})
+
+	t.Run("unknown exporter", func(t *testing.T) {
+		if _, err := Start(context.Background(), Config{Exporter: "zipkin"}, logr.Discard()); err == nil {
+			t.Errorf("Expected an error for an unknown exporter")
+		}
+	})
+}
+
+func TestNewPropagator(t *testing.T) {
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	parent := http.Header{"Traceparent": {"00-" + traceID + "-00f067aa0ba902b7-01"}}
+
+	tests := []struct {
+		name     string
+		names    []string
+		expected string
+	}{
+		{name: "W3C trace context", names: []string{"tracecontext"}, expected: "Traceparent"},
+		{name: "B3 single header", names: []string{"tracecontext", "b3"}, expected: "B3"},
+		{name: "B3 multiple headers", names: []string{"tracecontext", " b3multi"}, expected: "X-B3-Traceid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			propagator, err := NewPropagator(tt.names)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			ctx := propagator.Extract(context.Background(), propagation.HeaderCarrier(parent))
+			header := http.Header{}
+			propagator.Inject(ctx, propagation.HeaderCarrier(header))
+			if header.Get(tt.expected) == "" {
+				t.Errorf("Expected the %s header, got %v", tt.expected, header)
+			}
+		})
+	}
+
+	t.Run("B3 is extracted from both encodings", func(t *testing.T) {
+		propagator, err := NewPropagator([]string{"b3"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		multi := http.Header{
+			"X-B3-Traceid": {traceID},
+			"X-B3-Spanid":  {"00f067aa0ba902b7"},
+			"X-B3-Sampled": {"1"},
+		}
+		ctx := propagator.Extract(context.Background(), propagation.HeaderCarrier(multi))
+		if sc := trace.SpanContextFromContext(ctx); sc.TraceID().String() != traceID {
+			t.Errorf("Expected trace %s, got %s", traceID, sc.TraceID())
+		}
+	})
+
+	t.Run("unknown propagator", func(t *testing.T) {
+		if _, err := NewPropagator([]string{"jaeger"}); err == nil {
+			t.Errorf("Expected an error for an unknown propagator")
+		}
+	})
+}